@@ -17,6 +17,25 @@ async function loadWasm(wasm, target) {
 function attachRomUploadListeners() {
   const handleFile = (file) => {
     const reader = new FileReader();
+    if (file.name.toLowerCase().endsWith('.csmv')) {
+      reader.onload = function(e) {
+        const error = emulator.playMovie(new Uint8Array(e.target.result));
+        if (error) {
+          alert(`Movie playback failed: ${error}`);
+        }
+        document.body.style.backgroundColor = '#000';
+      };
+      reader.readAsArrayBuffer(file);
+      return;
+    }
+    if (file.name.toLowerCase().endsWith('.o8')) {
+      reader.onload = function(e) {
+        loadRomFromText(e.target.result);
+        document.body.style.backgroundColor = '#000';
+      };
+      reader.readAsText(file);
+      return;
+    }
     reader.onload = function(e) {
       const arrayBuffer = e.target.result;
       const uint8Array = new Uint8Array(arrayBuffer);
@@ -65,6 +84,14 @@ function attachRomUploadListeners() {
   return { dragOverListener, dragLeaveListener, dropListener };
 }
 
+function loadRomFromText(text) {
+  const error = emulator.loadSource(text);
+  if (error) {
+    console.error(`Octo assembly failed: ${error}`);
+    alert(`Octo assembly failed: ${error}`);
+  }
+}
+
 function attachVisibilityListener() {
   let runningOnHide = false;
 
@@ -98,6 +125,39 @@ function downloadRom() {
   document.body.removeChild(a);
 }
 
+function downloadMovie(movie) {
+  const blob = new Blob([movie], { type: 'application/octet-stream' });
+  const url = URL.createObjectURL(blob);
+  const a = document.createElement('a');
+  a.href = url;
+  a.download = 'movie.csmv';
+  document.body.appendChild(a);
+  a.click();
+  document.body.removeChild(a);
+}
+
+function downloadScreenshot(image) {
+  const blob = new Blob([image], { type: 'image/png' });
+  const url = URL.createObjectURL(blob);
+  const a = document.createElement('a');
+  a.href = url;
+  a.download = 'screenshot.png';
+  document.body.appendChild(a);
+  a.click();
+  document.body.removeChild(a);
+}
+
+function downloadVideo(video, ext) {
+  const blob = new Blob([video], { type: ext === 'gif' ? 'image/gif' : 'image/apng' });
+  const url = URL.createObjectURL(blob);
+  const a = document.createElement('a');
+  a.href = url;
+  a.download = 'recording.' + ext;
+  document.body.appendChild(a);
+  a.click();
+  document.body.removeChild(a);
+}
+
 (async () => {
   await loadWasm("main.wasm", "chip8-ui");
   attachVisibilityListener();
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mrchip53/chip-station/cores/chip8"
+	"github.com/mrchip53/chip-station/cores/chip8/octo"
+	"github.com/mrchip53/chip-station/cores/chip8/render"
+)
+
+type keyEvent struct {
+	key   uint8
+	state uint8
+}
+
+type pokeFlag []string
+
+func (p *pokeFlag) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *pokeFlag) Set(v string) error {
+	*p = append(*p, v)
+	return nil
+}
+
+type registerDump struct {
+	Reason     string   `json:"reason"`
+	Frames     int      `json:"frames"`
+	Cycles     uint64   `json:"cycles"`
+	PC         uint16   `json:"pc"`
+	StopPC     uint16   `json:"stop_pc,omitempty"`
+	Opcode     uint16   `json:"opcode"`
+	I          uint16   `json:"i"`
+	V          []int    `json:"v"`
+	Stack      []uint16 `json:"stack"`
+	DelayTimer uint8    `json:"delay_timer"`
+	SoundTimer uint8    `json:"sound_timer"`
+	Width      int      `json:"width"`
+	Height     int      `json:"height"`
+	Fault      string   `json:"fault,omitempty"`
+}
+
+func main() {
+	var pokes pokeFlag
+
+	romPath := flag.String("rom", "", "ROM file or Octo source to run")
+	quirksName := flag.String("quirks", "vip", "quirks preset: vip, schip-legacy, schip-modern or xochip")
+	ipf := flag.Int("ipf", chip8.IPF, "instructions per frame")
+	timingName := flag.String("timing", "fixed", "timing model: fixed runs -ipf instructions per frame, vip uses COSMAC VIP cycle costs")
+	deflickerName := flag.String("deflicker", "off", "flicker reduction of captured frames: off, decay, blend or clear")
+	frames := flag.Int("frames", 600, "maximum number of frames to run")
+	untilLoop := flag.Bool("until-loop", false, "stop when the program jumps to itself")
+	untilOpcode := flag.String("until-opcode", "", "stop before executing this opcode, e.g. 0x00FD")
+	opcodeMask := flag.String("opcode-mask", "0xFFFF", "mask applied to opcodes compared against -until-opcode")
+	timeout := flag.Duration("timeout", 0, "stop after this much wall-clock time")
+	keys := flag.String("keys", "", "scripted input as frame:key:state entries, e.g. 30:5:1,40:5:0")
+	pngPath := flag.String("png", "", "write the final display to this PNG file")
+	captureDir := flag.String("capture", "", "write every frame the display changed in to a PNG file in this directory")
+	videoPath := flag.String("video", "", "record the run as an animated GIF, or APNG for a .png or .apng file")
+	paletteName := flag.String("palette", "highcontrast", "palette of written images: amber, octo, lcd, gameboy, highcontrast or 2 or 4 hex colors, e.g. 000000,FFFFFF; the ROM metadata's palette wins unless this is set")
+	romDbPath := flag.String("romdb", "", "JSON file of ROM metadata by SHA-256, e.g. palettes to apply")
+	scale := flag.Int("scale", 1, "size of a CHIP-8 pixel in written images")
+	scanlines := flag.Float64("scanlines", 0, "strength of the scanline effect in written images, e.g. 0.2")
+	grid := flag.Bool("grid", false, "draw a pixel grid in written images")
+	curvature := flag.Float64("curvature", 0, "CRT curvature of written images, e.g. 0.1")
+	jsonPath := flag.String("json", "", "write a JSON dump of the registers to this file, - for stdout")
+	tracePath := flag.String("trace", "", "write an instruction trace to this file, - for stdout")
+	traceFormat := flag.String("trace-format", "text", "trace format: text or binary")
+	tracePc := flag.String("trace-pc", "", "only trace instructions in this address range, e.g. 0x200-0x2FF")
+	traceClasses := flag.String("trace-class", "", "only trace these opcode classes (high nibbles), e.g. D,F")
+	seed := flag.Int64("seed", 0, "random number seed")
+	moviePath := flag.String("movie", "", "play back this movie, which also sets the quirks, IPF, timing and seed")
+	recordPath := flag.String("record", "", "record the run, including -keys input, to this movie file")
+	flag.Var(&pokes, "poke", "set a byte before running as address=value, may be repeated")
+	flag.Parse()
+
+	if *romPath == "" && flag.NArg() > 0 {
+		*romPath = flag.Arg(0)
+	}
+	if *romPath == "" {
+		log.Fatal("Usage: chipstation-headless [flags] -rom <rom file>")
+	}
+
+	rom, err := octo.ReadROM(*romPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	quirks, ok := chip8.GetQuirksPreset(*quirksName)
+	if !ok {
+		log.Fatalf("unknown quirks preset: %s", *quirksName)
+	}
+	timing, ok := chip8.ParseTiming(*timingName)
+	if !ok {
+		log.Fatalf("unknown timing model: %s", *timingName)
+	}
+
+	deflicker, ok := chip8.ParseDeflicker(*deflickerName)
+	if !ok {
+		log.Fatalf("unknown deflicker mode: %s", *deflickerName)
+	}
+
+	palette, err := chip8.ParsePalette(*paletteName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var romDb chip8.RomDatabase
+	if *romDbPath != "" {
+		data, err := os.ReadFile(*romDbPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if romDb, err = chip8.ParseRomDatabase(data); err != nil {
+			log.Fatalf("%s: %v", *romDbPath, err)
+		}
+	}
+
+	script, err := parseKeys(*keys)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var stopOpcode, stopMask uint64
+	if *untilOpcode != "" {
+		if stopOpcode, err = strconv.ParseUint(*untilOpcode, 0, 16); err != nil {
+			log.Fatalf("invalid opcode %q: %v", *untilOpcode, err)
+		}
+		if stopMask, err = strconv.ParseUint(*opcodeMask, 0, 16); err != nil {
+			log.Fatalf("invalid opcode mask %q: %v", *opcodeMask, err)
+		}
+	}
+
+	if *captureDir != "" {
+		if err := os.MkdirAll(*captureDir, 0755); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	options := render.Options{Scale: *scale, Scanlines: *scanlines, Grid: *grid, Curvature: *curvature}
+
+	// colors follows the palette of the emulator, which the ROM metadata
+	// can change.
+	colors := render.GrayPalette
+	var recorder *render.Recorder
+
+	reason := ""
+	var stopPc uint16
+	e := chip8.NewChip8Emulator(chip8.Hooks{
+		Palette: func(p chip8.Palette) {
+			colors = render.NewPalette(p.Expand())
+		},
+		Frame: func(f *chip8.Frame) {
+			if *captureDir != "" {
+				path := filepath.Join(*captureDir, fmt.Sprintf("frame-%06d.png", f.Number))
+				if err := savePNG(render.Render(f, colors, options), path); err != nil {
+					log.Fatal(err)
+				}
+			}
+		},
+		Decode: func(pc uint16, opcode uint16, drawCount uint64) bool {
+			if *untilOpcode != "" && uint64(opcode)&stopMask == stopOpcode&stopMask {
+				reason, stopPc = "opcode", pc
+				return true
+			}
+			if *untilLoop && opcode&0xF000 == 0x1000 && opcode&0x0FFF == pc {
+				reason, stopPc = "loop", pc
+			}
+			return false
+		},
+	}, quirks)
+
+	e.SetSeed(*seed)
+	e.SetPalette(palette)
+	e.SetRomDatabase(romDb)
+	e.SwapROM(rom)
+	if isFlagSet("palette") {
+		e.SetPalette(palette)
+	}
+	// Pokes go in one message, however many there are, as nothing drains
+	// the queue before the first frame.
+	values := make(map[uint16]uint8, len(pokes))
+	for _, p := range pokes {
+		address, value, err := parsePoke(p)
+		if err != nil {
+			log.Fatal(err)
+		}
+		values[address] = value
+	}
+	if len(values) > 0 {
+		e.Poke(values)
+	}
+	e.SetIPF(*ipf)
+	e.SetTiming(timing)
+	e.SetDeflicker(deflicker)
+
+	if *moviePath != "" {
+		data, err := os.ReadFile(*moviePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		movie, err := chip8.UnmarshalMovie(data)
+		if err != nil {
+			log.Fatalf("%s: %v", *moviePath, err)
+		}
+		if err := e.PlayMovie(movie, rom); err != nil {
+			log.Fatal(err)
+		}
+	} else if *recordPath != "" {
+		e.StartRecording()
+	}
+
+	var traceOut *bufio.Writer
+	var tracer *chip8.Tracer
+	if *tracePath != "" {
+		filter, err := parseTraceFilter(*tracePc, *traceClasses)
+		if err != nil {
+			log.Fatal(err)
+		}
+		format := chip8.TraceText
+		switch *traceFormat {
+		case "text":
+		case "binary":
+			format = chip8.TraceBinary
+		default:
+			log.Fatalf("unknown trace format: %s", *traceFormat)
+		}
+		w := os.Stdout
+		if *tracePath != "-" {
+			if w, err = os.Create(*tracePath); err != nil {
+				log.Fatal(err)
+			}
+			defer w.Close()
+		}
+		traceOut = bufio.NewWriter(w)
+		tracer = chip8.NewTracer(traceOut, format, filter)
+		e.SetTracer(tracer)
+	}
+	e.Resume()
+
+	start := time.Now()
+	frame := 0
+	for ; frame < *frames && reason == ""; frame++ {
+		for _, k := range script[frame] {
+			e.SetKeyState(k.key, k.state)
+		}
+		if !e.Cycle(float64(frame) * 1000 / 60) {
+			break
+		}
+		if f := e.GetFrame(); *videoPath != "" && f != nil {
+			if recorder == nil {
+				recorder = render.NewRecorder(colors, options)
+			}
+			recorder.Add(f)
+		}
+		if e.GetFault() != nil {
+			reason = "fault"
+		} else if e.IsPaused() && reason == "" {
+			reason = "exit"
+		} else if *timeout > 0 && time.Since(start) > *timeout {
+			reason = "timeout"
+		}
+	}
+	if reason == "" {
+		reason = "frames"
+	}
+	if dropped := e.GetDroppedMessages(); dropped > 0 {
+		log.Printf("Dropped %d scripted key changes, the message queue was full", dropped)
+	}
+
+	if movie := e.StopRecording(); movie != nil {
+		if err := os.WriteFile(*recordPath, movie.Marshal(), 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if tracer != nil {
+		if err := tracer.Err(); err != nil {
+			log.Fatalf("writing trace: %v", err)
+		}
+		if err := traceOut.Flush(); err != nil {
+			log.Fatalf("writing trace: %v", err)
+		}
+	}
+
+	if recorder != nil {
+		if err := saveVideo(recorder, *videoPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	display := e.GetDisplay()
+	if *pngPath != "" {
+		if err := savePNG(render.Render(&display, colors, options), *pngPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *jsonPath != "" {
+		var v []int
+		for _, r := range e.GetV() {
+			v = append(v, int(r))
+		}
+		dump := registerDump{
+			Reason:     reason,
+			Frames:     frame,
+			Cycles:     e.GetCycleCount(),
+			PC:         e.GetPc(),
+			StopPC:     stopPc,
+			Opcode:     e.GetOpCode(),
+			I:          e.GetI(),
+			V:          v,
+			Stack:      e.GetStack(),
+			DelayTimer: e.GetDelayTimer(),
+			SoundTimer: e.GetSoundTimer(),
+			Width:      display.Width(),
+			Height:     display.Height(),
+		}
+		if fault := e.GetFault(); fault != nil {
+			dump.Fault = fault.Error()
+		}
+		if err := writeJSON(*jsonPath, dump); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if fault := e.GetFault(); fault != nil {
+		log.Printf("Emulator halted: %v", fault)
+		os.Exit(1)
+	}
+}
+
+// parseKeys reads a comma separated list of frame:key:state entries, where
+// state is 1/down or 0/up.
+func parseKeys(script string) (map[int][]keyEvent, error) {
+	events := make(map[int][]keyEvent)
+	if script == "" {
+		return events, nil
+	}
+	for _, entry := range strings.Split(script, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid key entry %q", entry)
+		}
+		frame, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid frame in key entry %q", entry)
+		}
+		key, err := strconv.ParseUint(parts[1], 16, 8)
+		if err != nil || key >= chip8.NUM_KEYS {
+			return nil, fmt.Errorf("invalid key in key entry %q", entry)
+		}
+		var state uint8
+		switch parts[2] {
+		case "1", "down":
+			state = 1
+		case "0", "up":
+			state = 0
+		default:
+			return nil, fmt.Errorf("invalid state in key entry %q", entry)
+		}
+		events[frame] = append(events[frame], keyEvent{key: uint8(key), state: state})
+	}
+	return events, nil
+}
+
+func parsePoke(poke string) (uint16, uint8, error) {
+	address, value, ok := strings.Cut(poke, "=")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid poke %q", poke)
+	}
+	a, err := strconv.ParseUint(address, 0, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid poke address %q", address)
+	}
+	v, err := strconv.ParseUint(value, 0, 8)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid poke value %q", value)
+	}
+	return uint16(a), uint8(v), nil
+}
+
+// parseTraceFilter reads an address range such as 0x200-0x2FF and a comma
+// separated list of opcode classes in hex.
+func parseTraceFilter(pcRange, classes string) (chip8.TraceFilter, error) {
+	var filter chip8.TraceFilter
+	if pcRange != "" {
+		start, end, ok := strings.Cut(pcRange, "-")
+		if !ok {
+			return filter, fmt.Errorf("invalid trace range %q", pcRange)
+		}
+		s, err := strconv.ParseUint(start, 0, 16)
+		if err != nil {
+			return filter, fmt.Errorf("invalid trace range start %q", start)
+		}
+		e, err := strconv.ParseUint(end, 0, 16)
+		if err != nil || e < s {
+			return filter, fmt.Errorf("invalid trace range end %q", end)
+		}
+		filter.StartPC, filter.EndPC = uint16(s), uint16(e)
+	}
+	if classes != "" {
+		for _, class := range strings.Split(classes, ",") {
+			c, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(class), "0x"), 16, 4)
+			if err != nil {
+				return filter, fmt.Errorf("invalid opcode class %q", class)
+			}
+			filter.Classes |= 1 << c
+		}
+	}
+	return filter, nil
+}
+
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func savePNG(img image.Image, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// saveVideo encodes the recording as an APNG for .png and .apng files and
+// as a GIF otherwise.
+func saveVideo(r *render.Recorder, path string) error {
+	format := render.FormatGIF
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png", ".apng":
+		format = render.FormatAPNG
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := r.Encode(w, format); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if path == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/mrchip53/chip-station/cores/chip8/octo"
+)
+
+func main() {
+	outPath := flag.String("o", "", "output ROM file, defaults to the source with a .ch8 extension")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		log.Fatal("Usage: chipstation-octo [-o <rom file>] <source.o8>")
+	}
+	srcPath := flag.Arg(0)
+
+	source, err := os.ReadFile(srcPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p, err := octo.Assemble(string(source))
+	if err != nil {
+		log.Fatalf("%s: %v", srcPath, err)
+	}
+
+	if *outPath == "" {
+		*outPath = strings.TrimSuffix(srcPath, ".o8") + ".ch8"
+	}
+	if err := os.WriteFile(*outPath, p.ROM, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
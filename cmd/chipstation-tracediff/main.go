@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/mrchip53/chip-station/cores/chip8"
+)
+
+// chipstation-tracediff compares two instruction traces, in either the text
+// or binary format, and reports the first record they disagree on. It exits
+// with status 1 when the traces diverge.
+func main() {
+	if len(os.Args) != 3 {
+		log.Fatal("Usage: chipstation-tracediff <trace a> <trace b>")
+	}
+
+	a, err := openTrace(os.Args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+	b, err := openTrace(os.Args[2])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	d, err := chip8.DiffTraces(a, b)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if d == nil {
+		fmt.Println("traces are identical")
+		return
+	}
+	fmt.Println(d)
+	os.Exit(1)
+}
+
+func openTrace(path string) (*chip8.TraceReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := chip8.NewTraceReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return r, nil
+}
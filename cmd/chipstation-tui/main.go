@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/mrchip53/chip-station/cores/chip8"
+	"github.com/mrchip53/chip-station/cores/chip8/octo"
+)
+
+const (
+	escape    = 0x1B
+	ctrlC     = 0x03
+	upperHalf = "▀"
+)
+
+type rgb struct {
+	r, g, b uint8
+}
+
+func newRGB(c uint32) rgb {
+	return rgb{r: uint8(c >> 16), g: uint8(c >> 8), b: uint8(c)}
+}
+
+// Terminals only report key presses, so a key counts as held until no
+// press or auto-repeat for it has arrived for the release delay.
+type keyTracker struct {
+	e        *chip8.Chip8Emulator
+	delay    time.Duration
+	lastSeen map[uint8]time.Time
+}
+
+func (k *keyTracker) press(key uint8, now time.Time) {
+	if _, held := k.lastSeen[key]; !held {
+		k.e.SetKeyState(key, 1)
+	}
+	k.lastSeen[key] = now
+}
+
+func (k *keyTracker) releaseStale(now time.Time) {
+	for key, seen := range k.lastSeen {
+		if now.Sub(seen) >= k.delay {
+			k.e.SetKeyState(key, 0)
+			delete(k.lastSeen, key)
+		}
+	}
+}
+
+type screen struct {
+	out       *bufio.Writer
+	palette   [4]rgb
+	last      chip8.Display
+	drawn     bool
+	showStats bool
+}
+
+func (s *screen) draw(e *chip8.Chip8Emulator, force bool) {
+	display := e.GetDisplay()
+	if s.drawn && !force && display == s.last {
+		s.drawStats(e, display.Height())
+		return
+	}
+	s.last = display
+	s.drawn = true
+
+	fmt.Fprint(s.out, "\x1b[H")
+	w, h := display.Width(), display.Height()
+	for y := 0; y < h; y += 2 {
+		var fg, bg rgb
+		first := true
+		for x := 0; x < w; x++ {
+			top := s.palette[display.Pixel(x, y)&0x3]
+			bottom := s.palette[display.Pixel(x, y+1)&0x3]
+			if first || top != fg {
+				fmt.Fprintf(s.out, "\x1b[38;2;%d;%d;%dm", top.r, top.g, top.b)
+				fg = top
+			}
+			if first || bottom != bg {
+				fmt.Fprintf(s.out, "\x1b[48;2;%d;%d;%dm", bottom.r, bottom.g, bottom.b)
+				bg = bottom
+			}
+			first = false
+			fmt.Fprint(s.out, upperHalf)
+		}
+		fmt.Fprint(s.out, "\x1b[0m\x1b[K\r\n")
+	}
+	fmt.Fprint(s.out, "\x1b[J")
+	s.drawStats(e, h)
+}
+
+// drawStats mirrors the overlay window of the WebGL frontend below the
+// display.
+func (s *screen) drawStats(e *chip8.Chip8Emulator, height int) {
+	fmt.Fprintf(s.out, "\x1b[%d;1H\x1b[0m", height/2+1)
+	if s.showStats {
+		fmt.Fprintf(s.out, "FPS: %.2f  PC: 0x%04X  Opcode: 0x%04X  IPF: %d cycles/frame  ROM Size: %d bytes  Dropped Input: %d\x1b[K\r\n",
+			e.GetFps(), e.GetPc(), e.GetOpCode(), e.GetIPF(), e.GetRomSize(), e.GetDroppedMessages())
+		status := "Running"
+		if fault := e.GetFault(); fault != nil {
+			status = "Halted: " + fault.Error()
+		} else if e.IsPaused() {
+			status = "Paused"
+		}
+		fmt.Fprintf(s.out, "%s  |  Toggle stats: 'u'  Pause: 'p'  Quit: Esc\x1b[K", status)
+	} else {
+		fmt.Fprint(s.out, "\x1b[J")
+	}
+	s.out.Flush()
+}
+
+func parseColor(value string) (uint32, error) {
+	c, err := strconv.ParseUint(strings.TrimPrefix(value, "#"), 16, 24)
+	return uint32(c), err
+}
+
+func main() {
+	romPath := flag.String("rom", "", "ROM file or Octo source to run")
+	quirksName := flag.String("quirks", "vip", "quirks preset: vip, schip-legacy, schip-modern or xochip")
+	ipf := flag.Int("ipf", chip8.IPF, "instructions per frame")
+	timingName := flag.String("timing", "fixed", "timing model: fixed runs -ipf instructions per frame, vip uses COSMAC VIP cycle costs")
+	release := flag.Duration("release", 150*time.Millisecond, "time without a key press before the key counts as released")
+	onColor := flag.String("on", "F2CE03", "color of lit pixels")
+	offColor := flag.String("off", "8E6903", "color of unlit pixels")
+	flag.Parse()
+
+	if *romPath == "" && flag.NArg() > 0 {
+		*romPath = flag.Arg(0)
+	}
+	if *romPath == "" {
+		log.Fatal("Usage: chipstation-tui [flags] -rom <rom file>")
+	}
+
+	rom, err := octo.ReadROM(*romPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	quirks, ok := chip8.GetQuirksPreset(*quirksName)
+	if !ok {
+		log.Fatalf("unknown quirks preset: %s", *quirksName)
+	}
+	timing, ok := chip8.ParseTiming(*timingName)
+	if !ok {
+		log.Fatalf("unknown timing model: %s", *timingName)
+	}
+
+	on, err := parseColor(*onColor)
+	if err != nil {
+		log.Fatalf("invalid on color %q", *onColor)
+	}
+	off, err := parseColor(*offColor)
+	if err != nil {
+		log.Fatalf("invalid off color %q", *offColor)
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		log.Fatal("chipstation-tui must be run in a terminal")
+	}
+	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	out := bufio.NewWriterSize(os.Stdout, 64*1024)
+	fmt.Fprint(out, "\x1b[?1049h\x1b[?25l\x1b[2J")
+	defer func() {
+		fmt.Fprint(out, "\x1b[0m\x1b[?25h\x1b[?1049l")
+		out.Flush()
+		term.Restore(int(os.Stdin.Fd()), oldState)
+	}()
+
+	e := chip8.NewChip8Emulator(chip8.Hooks{}, quirks)
+	e.SwapROM(rom)
+	e.SetIPF(*ipf)
+	e.SetTiming(timing)
+	e.Resume()
+
+	s := &screen{
+		out:       out,
+		palette:   [4]rgb{newRGB(off), newRGB(on), newRGB(0xFF6600), newRGB(0x662200)},
+		showStats: true,
+	}
+	keys := &keyTracker{e: e, delay: *release, lastSeen: make(map[uint8]time.Time)}
+
+	input := make(chan []byte)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(input)
+				return
+			}
+			data := make([]byte, n)
+			copy(data, buf[:n])
+			input <- data
+		}
+	}()
+
+	scheduler := chip8.NewScheduler(e)
+	start := time.Now()
+	ticker := time.NewTicker(time.Second / chip8.FRAME_RATE)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case data, ok := <-input:
+			if !ok {
+				return
+			}
+			// A lone escape is the Esc key, longer ones are escape sequences.
+			if (len(data) == 1 && data[0] == escape) || data[0] == ctrlC {
+				return
+			}
+			now := time.Now()
+			for _, b := range data {
+				switch c := strings.ToLower(string(b)); c {
+				case "u":
+					s.showStats = !s.showStats
+					s.draw(e, true)
+				case "p":
+					if e.IsPaused() {
+						e.Resume()
+					} else {
+						e.Pause()
+					}
+				default:
+					if key, ok := chip8.DefaultKeyMap[c]; ok {
+						keys.press(key, now)
+					}
+				}
+			}
+		case now := <-ticker.C:
+			keys.releaseStale(now)
+			if !scheduler.Advance(float64(now.Sub(start).Microseconds()) / 1000) {
+				return
+			}
+			s.draw(e, false)
+		}
+	}
+}
@@ -2,84 +2,162 @@ package chip8
 
 import (
 	_ "embed"
-	"log"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mrchip53/chip-station/utilities"
 )
 
 const (
-	ROM_START_ADDRESS  = 0x200
-	MEMORY_SIZE        = 4096
-	SCREEN_WIDTH       = 64
-	SCREEN_HEIGHT      = 32
-	NUM_KEYS           = 16
-	NUM_REGISTERS      = 16
-	IPF                = 20
-	MESSAGES_PER_FRAME = 20
+	ROM_START_ADDRESS   = 0x200
+	MEMORY_SIZE         = 4096
+	XO_MEMORY_SIZE      = 65536
+	SCREEN_WIDTH        = 64
+	SCREEN_HEIGHT       = 32
+	HIRES_SCREEN_WIDTH  = 128
+	HIRES_SCREEN_HEIGHT = 64
+	BIG_FONT_ADDRESS    = 0x50
+	NUM_RPL_FLAGS       = 16
+	ALL_PLANES          = 0x3
+	AUDIO_PATTERN_SIZE  = 16
+	DEFAULT_PITCH       = 64
+	NUM_KEYS            = 16
+	NUM_REGISTERS       = 16
+	STACK_SIZE          = 16
+	IPF                 = 20
+	MESSAGES_PER_FRAME  = 20
+	MESSAGE_QUEUE_SIZE  = 64
 )
 
 //go:embed font.bin
 var defaultFont []byte
 
+//go:embed bigfont.bin
+var defaultBigFont []byte
+
 type (
 	DecodeHook        func(pc uint16, opcode uint16, drawCount uint64) bool
 	DrawHook          func()
+	FrameHook         func(f *Frame)
+	PaletteHook       func(p Palette)
 	SoundHook         func()
+	AudioHook         func(pattern []uint8, pitch uint8)
 	CustomMessageHook func(m Message)
-	Display           [SCREEN_WIDTH][SCREEN_HEIGHT]uint8
+	FaultHook         func(err *EmulatorError)
+	BreakHook         func(reason BreakReason, pc uint16)
+	WatchHook         func(hit WatchHit)
 )
 
 type Hooks struct {
 	Decode        DecodeHook
 	Draw          DrawHook
+	Frame         FrameHook
+	Palette       PaletteHook
 	PlaySound     SoundHook
 	StopSound     SoundHook
+	Audio         AudioHook
 	CustomMessage CustomMessageHook
+	Fault         FaultHook
+	Break         BreakHook
+	Watch         WatchHook
 }
 
 type Chip8Emulator struct {
-	memory [MEMORY_SIZE]byte
+	memory []byte
 
 	display Display
 	draw    bool
+	planes  uint8
+
+	// frame is the last finished frame and frameDisplay the display it
+	// was built from.
+	frame        *Frame
+	frameDisplay Display
+
+	audioPattern []uint8
+	pitch        uint8
 
 	stack      *utilities.Stack
 	soundTimer *SoundTimer
 	delayTimer *DelayTimer
 	hooks      Hooks
+	quirks     Quirks
 	fps        *FpsCounter
 	keyState   *KeyState
+	rewind     *RewindBuffer
+	debugger   debugger
+	tracer     *Tracer
+	movie      movieState
+
+	// rewindRegisters and rewindParts are reused by every pushRewind.
+	rewindRegisters []byte
+	rewindParts     [][]byte
+
+	// Random numbers restart from seed on every reset, so a ROM run with
+	// the same seed and input always behaves the same.
+	seed int64
+	rng  *rand.Rand
+
+	messageChan     chan Message
+	droppedMessages atomic.Uint64
+
+	stateMu sync.Mutex
+	state   State
+	// saved is the machine at the end of the last frame, for SaveState.
+	saved machineState
+
+	ipf    int
+	timing Timing
+	vip    vipTiming
 
-	messageChan chan Message
+	deflicker Deflicker
+	flicker   deflickerState
 
-	ipf int
+	palette     Palette
+	romDatabase RomDatabase
 
 	pc uint16
 	i  uint16
 	v  [NUM_REGISTERS]uint8
 
+	rpl [NUM_RPL_FLAGS]uint8
+
 	lastRomSize int
 
 	cycleCount uint64
 	drawCount  uint64
 	paused     bool
+	rewinding  bool
+	fault      *EmulatorError
 }
 
-func NewChip8Emulator(hooks Hooks) *Chip8Emulator {
+func NewChip8Emulator(hooks Hooks, quirks Quirks) *Chip8Emulator {
 	e := &Chip8Emulator{
+		memory:      make([]byte, quirks.Platform.MemorySize()),
+		planes:      1,
+		pitch:       DEFAULT_PITCH,
 		delayTimer:  NewDelayTimer(),
 		fps:         NewFpsCounter(),
 		keyState:    NewKeyState(),
+		rewind:      NewRewindBuffer(REWIND_FRAMES, REWIND_BUDGET),
 		soundTimer:  NewSoundTimer(),
-		messageChan: make(chan Message, 20),
+		messageChan: make(chan Message, MESSAGE_QUEUE_SIZE),
 		pc:          ROM_START_ADDRESS,
-		stack:       utilities.NewStack(16),
+		stack:       utilities.NewStack(STACK_SIZE),
 		ipf:         IPF,
+		palette:     DefaultPalette,
 		hooks:       hooks,
+		quirks:      quirks,
+		seed:        time.Now().UnixNano(),
 	}
+	e.rng = rand.New(rand.NewSource(e.seed))
 	copy(e.memory[:], defaultFont)
-	e.messageChan <- PauseMessage{}
+	copy(e.memory[BIG_FONT_ADDRESS:], defaultBigFont)
+	e.EnqueueMessage(PauseMessage{})
+	e.publishState()
 	return e
 }
 
@@ -88,16 +166,27 @@ func (e *Chip8Emulator) Start() {
 }
 
 func (e *Chip8Emulator) reset() {
-	e.hooks.StopSound()
+	if e.hooks.StopSound != nil {
+		e.hooks.StopSound()
+	}
 	e.display = Display{}
-	e.stack = utilities.NewStack(16)
+	e.planes = 1
+	e.setAudio(nil, DEFAULT_PITCH)
+	e.stack = utilities.NewStack(STACK_SIZE)
 	e.soundTimer.Reset()
 	e.delayTimer.Reset()
 	e.keyState.Reset()
 	e.pc = ROM_START_ADDRESS
 	e.i = 0
 	e.v = [NUM_REGISTERS]uint8{}
+	e.rng = rand.New(rand.NewSource(e.seed))
 	e.paused = false
+	e.fault = nil
+	e.vip = vipTiming{}
+	e.flicker = deflickerState{}
+	e.debugger.mode = stepNone
+	e.debugger.broke = false
+	e.debugger.skipBreakpoint = false
 	e.fps.Reset()
 }
 
@@ -105,7 +194,16 @@ func (e *Chip8Emulator) IsPaused() bool {
 	return e.paused
 }
 
+// Cycle runs a single frame. now is the host time in milliseconds, only
+// used to measure the frame rate.
 func (e *Chip8Emulator) Cycle(now float64) bool {
+	ok := e.cycleFrame(now)
+	e.finishFrame()
+	e.publishState()
+	return ok
+}
+
+func (e *Chip8Emulator) cycleFrame(now float64) bool {
 	for i := 0; i < MESSAGES_PER_FRAME; i++ {
 		select {
 		case m := <-e.messageChan:
@@ -125,95 +223,87 @@ func (e *Chip8Emulator) Cycle(now float64) bool {
 		e.hooks.Draw()
 	}
 	e.drawCount++
+	e.checkFrame()
+
+	if e.rewinding {
+		e.rewindFrames(1)
+		return true
+	}
 
 	if e.paused {
 		return true
 	}
 
-	for i := 0; i < e.ipf; i++ {
-		opcode, ok := e.cycle()
-		if !ok {
-			return false
-		}
-		if opcode&0xF000 == 0xD000 {
-			break
-		}
+	e.applyMovieInput()
+	if !e.runFrame() {
+		return false
 	}
 	e.draw = false
+	e.movie.frame++
 
 	e.delayTimer.Decrement()
 	e.soundTimer.Decrement(e.hooks.StopSound)
 	e.keyState.ResetLastKeyReleased()
 	e.fps.UpdateFps(now)
+	if e.rewind.Enabled() {
+		e.pushRewind()
+	}
 
 	return true
 }
 
-func (e *Chip8Emulator) Loop() {
-DrawLoop:
-	for {
-		start := time.Now()
-
-	MessageLoop:
-		for i := 0; i < MESSAGES_PER_FRAME; i++ {
-			select {
-			case m := <-e.messageChan:
-				if !m.IsCustom() {
-					m.HandleMessage(e)
-				} else {
-					if e.hooks.CustomMessage != nil {
-						e.hooks.CustomMessage(m)
-					}
-				}
-			default:
-				break MessageLoop
-			}
-		}
-
-		if e.hooks.Draw != nil {
-			e.hooks.Draw()
+// runFrame runs the instructions of one frame. It returns false when a
+// decode hook aborted execution.
+func (e *Chip8Emulator) runFrame() bool {
+	if e.timing == TimingVIP {
+		return e.runVipFrame()
+	}
+	for i := 0; i < e.ipf; i++ {
+		opcode, ok := e.cycle()
+		if !ok {
+			return false
 		}
-		e.drawCount++
-		for i := 0; i < e.ipf; i++ {
-			opcode, ok := e.cycle()
-			if !ok {
-				break DrawLoop
-			}
-			if opcode&0xF000 == 0xD000 {
-				break
-			}
+		if opcode&0xF000 == 0xD000 && e.quirks.DisplayWait || e.paused {
+			break
 		}
-		e.draw = false
-
-		e.delayTimer.Decrement()
-		e.soundTimer.Decrement(e.hooks.StopSound)
-		e.keyState.ResetLastKeyReleased()
-
-		elapsed := time.Since(start)
-		time.Sleep(time.Second/60 - elapsed)
 	}
+	return true
 }
 
 func (e *Chip8Emulator) wipeRom() {
-	for i := ROM_START_ADDRESS; i < MEMORY_SIZE; i++ {
+	for i := ROM_START_ADDRESS; i < len(e.memory); i++ {
 		e.memory[i] = 0
 	}
 }
 
+func (e *Chip8Emulator) setQuirks(quirks Quirks) {
+	if size := quirks.Platform.MemorySize(); size != len(e.memory) {
+		memory := make([]byte, size)
+		copy(memory, e.memory)
+		e.memory = memory
+	}
+	e.quirks = quirks
+}
+
+// setAudio changes the XO-CHIP audio pattern and pitch. A nil pattern means
+// the program never loaded one and the frontend should use its own buzzer.
+func (e *Chip8Emulator) setAudio(pattern []uint8, pitch uint8) {
+	e.audioPattern = pattern
+	e.pitch = pitch
+	if e.hooks.Audio != nil {
+		e.hooks.Audio(pattern, pitch)
+	}
+}
+
 func (e *Chip8Emulator) loadRom(rom []byte) {
 	e.wipeRom()
-	copy(e.memory[ROM_START_ADDRESS:], rom)
-	e.lastRomSize = len(rom)
+	e.lastRomSize = copy(e.memory[ROM_START_ADDRESS:], rom)
 }
 
 func (e *Chip8Emulator) GetRomSize() int {
 	return e.lastRomSize
 }
 
-func (e *Chip8Emulator) EnqueueMessage(m Message) {
-	e.messageChan <- m
-}
-
 func (e *Chip8Emulator) Pause() {
 	e.EnqueueMessage(PauseMessage{})
 }
@@ -234,73 +324,216 @@ func (e *Chip8Emulator) pause() {
 }
 
 func (e *Chip8Emulator) resume() {
+	d := &e.debugger
+	d.skipBreakpoint = e.paused && d.broke && d.hitAt == e.pc
+	d.broke = false
 	e.paused = false
+	d.mode = stepNone
 	e.soundTimer.Resume(e.hooks.PlaySound)
 }
 
 func (e *Chip8Emulator) cycle() (uint16, bool) {
-	opcode := e.fetch()
-	abort := e.decode(opcode)
+	if e.hitBreakpoint() {
+		return 0, true
+	}
+	pc := e.pc
+	opcode, err := e.fetch()
+	if err != nil {
+		e.raiseFault(err, pc, opcode)
+		return opcode, true
+	}
+	e.debugger.pc, e.debugger.opcode = pc, opcode
+	if e.tracer != nil {
+		e.trace(pc, opcode)
+	}
+	var cycles int
+	if e.timing == TimingVIP {
+		cycles = e.instructionCycles(opcode)
+	}
+	abort, err := e.decode(opcode)
+	if err != nil {
+		e.debugger.watchHits = nil
+		e.raiseFault(err, pc, opcode)
+		return opcode, true
+	}
+	if e.timing == TimingVIP {
+		e.chargeCycles(pc, opcode, cycles)
+	}
 	e.cycleCount++
+	if !e.hitWatchpoint() {
+		e.checkStep()
+	}
 	return opcode, !abort
 }
 
-func (e *Chip8Emulator) fetch() uint16 {
+// raiseFault pauses the emulator on the faulting instruction, leaving the
+// machine state as it was for inspection.
+func (e *Chip8Emulator) raiseFault(err error, pc, opcode uint16) {
+	var fault *EmulatorError
+	if !errors.As(err, &fault) {
+		fault = &EmulatorError{Kind: ErrUnknownOpcode}
+	}
+	fault.PC = pc
+	fault.Opcode = opcode
+	fault.Cycle = e.cycleCount
+	e.fault = fault
+	e.pc = pc
+	e.pause()
+	if e.hooks.Fault != nil {
+		e.hooks.Fault(fault)
+	}
+}
+
+func (e *Chip8Emulator) fetch() (uint16, error) {
+	if int(e.pc)+1 >= len(e.memory) {
+		return 0, &EmulatorError{Kind: ErrPcOutOfRange, Address: int(e.pc)}
+	}
 	b1 := uint16(e.memory[e.pc])
 	b2 := uint16(e.memory[e.pc+1])
 	e.pc += 2
-	return b1<<8 | b2
+	return b1<<8 | b2, nil
+}
+
+func (e *Chip8Emulator) readMemory(address int) (byte, error) {
+	if address < 0 || address >= len(e.memory) {
+		return 0, &EmulatorError{Kind: ErrMemoryOutOfBounds, Address: address}
+	}
+	if len(e.debugger.watchpoints) > 0 {
+		e.watch(WatchRead, address, e.memory[address], e.memory[address])
+	}
+	return e.memory[address], nil
 }
 
-func (e *Chip8Emulator) decode(opcode uint16) bool {
+func (e *Chip8Emulator) writeMemory(address int, data byte) error {
+	if address < 0 || address >= len(e.memory) {
+		return &EmulatorError{Kind: ErrMemoryOutOfBounds, Address: address}
+	}
+	if len(e.debugger.watchpoints) > 0 {
+		e.watch(WatchWrite, address, e.memory[address], data)
+	}
+	e.memory[address] = data
+	return nil
+}
+
+// skip jumps over the next instruction, which is four bytes long when it is
+// an XO-CHIP F000 NNNN long index load.
+func (e *Chip8Emulator) skip() {
+	if e.quirks.Platform == PlatformXOChip && int(e.pc)+1 < len(e.memory) &&
+		e.memory[e.pc] == 0xF0 && e.memory[e.pc+1] == 0x00 {
+		e.pc += 4
+		return
+	}
+	e.pc += 2
+}
+
+func (e *Chip8Emulator) decode(opcode uint16) (bool, error) {
 	if e.hooks.Decode != nil && e.hooks.Decode(e.pc-2, opcode, e.drawCount) {
-		return true
+		return true, nil
 	}
 
 	opKey := getOpKey(opcode)
 
 	instruction, ok := instructions[opKey]
-	if !ok {
-		log.Printf("op: %x, cycle: %d\n", opcode, e.cycleCount)
-		panic("opcode not implemented")
+	if !ok || xoChipInstructions[opKey] && e.quirks.Platform != PlatformXOChip {
+		return false, &EmulatorError{Kind: ErrUnknownOpcode}
 	}
 	instruction.Fill(opcode)
-	instruction.Execute(e)
+	if err := instruction.Execute(e); err != nil {
+		return false, err
+	}
 
-	return false
+	return false, nil
 }
 
 func (e *Chip8Emulator) execute(opcode uint16) {
 }
 
-func (e *Chip8Emulator) clearDisplay() {
-	for i := 0; i < SCREEN_WIDTH; i++ {
-		for j := 0; j < SCREEN_HEIGHT; j++ {
-			e.display[i][j] = 0
-		}
-	}
-}
-
 func (e *Chip8Emulator) GetDisplay() Display {
 	return e.display
 }
 
 func (e *Chip8Emulator) GetRom() []byte {
-	return e.memory[ROM_START_ADDRESS : ROM_START_ADDRESS+uint16(e.lastRomSize)]
+	return e.memory[ROM_START_ADDRESS : ROM_START_ADDRESS+e.lastRomSize]
+}
+
+// Rewind steps the machine back up to frames frames, as far as the rewind
+// buffer reaches.
+func (e *Chip8Emulator) Rewind(frames int) {
+	e.EnqueueMessage(RewindMessage{frames: frames})
+}
+
+// SetRewinding makes every following frame step back one frame instead of
+// running, until it is turned off again.
+func (e *Chip8Emulator) SetRewinding(rewinding bool) {
+	e.EnqueueMessage(RewindingMessage{rewinding: rewinding})
+}
+
+// SetRewindBudget limits the memory used by the rewind buffer. A budget of
+// zero disables rewinding.
+func (e *Chip8Emulator) SetRewindBudget(bytes int) {
+	e.EnqueueMessage(RewindBudgetMessage{budget: bytes})
+}
+
+func (e *Chip8Emulator) GetRewindFrames() int {
+	return e.rewind.Frames()
+}
+
+func (e *Chip8Emulator) rewindFrames(frames int) int {
+	state, rewound := e.rewind.Pop(frames)
+	if rewound == 0 {
+		return 0
+	}
+	s, err := unmarshalState(state)
+	if err != nil {
+		e.rewind.Reset()
+		return 0
+	}
+	if err := e.restoreState(s); err != nil {
+		e.rewind.Reset()
+		return 0
+	}
+	return rewound
 }
 
 func (e *Chip8Emulator) SetMemory(address uint16, data []byte) {
 	e.EnqueueMessage(SetMemoryMessage{address: address, data: data})
 }
 
-func (e *Chip8Emulator) SetKeyState(key, state uint8) {
-	e.EnqueueMessage(KeyStateMessage{key: key, state: state == 1})
+// Poke sets bytes scattered over memory with a single message, so any
+// number of them can be queued from the goroutine driving the emulator.
+func (e *Chip8Emulator) Poke(values map[uint16]uint8) {
+	e.EnqueueMessage(PokeMessage{values: values})
+}
+
+// SetKeyState queues a key change without blocking, so input handlers can
+// never stall. It returns false if the queue was full and the change was
+// dropped, which GetDroppedMessages counts.
+func (e *Chip8Emulator) SetKeyState(key, state uint8) bool {
+	return e.TryEnqueueMessage(KeyStateMessage{key: key, state: state == 1})
+}
+
+// SetSeed sets the seed random numbers restart from when the ROM is
+// reset.
+func (e *Chip8Emulator) SetSeed(seed int64) {
+	e.EnqueueMessage(SeedMessage{seed: seed})
+}
+
+func (e *Chip8Emulator) GetSeed() int64 {
+	return e.seed
 }
 
 func (e *Chip8Emulator) SetIPF(ipf int) {
 	e.EnqueueMessage(IpfMessage{ipf: ipf})
 }
 
+func (e *Chip8Emulator) SetQuirks(quirks Quirks) {
+	e.EnqueueMessage(QuirksMessage{quirks: quirks})
+}
+
+func (e *Chip8Emulator) GetQuirks() Quirks {
+	return e.quirks
+}
+
 func (e *Chip8Emulator) GetIPF() int {
 	return e.ipf
 }
@@ -313,10 +546,49 @@ func (e *Chip8Emulator) GetPc() uint16 {
 	return e.pc
 }
 
+func (e *Chip8Emulator) GetI() uint16 {
+	return e.i
+}
+
+func (e *Chip8Emulator) GetV() [NUM_REGISTERS]uint8 {
+	return e.v
+}
+
+// GetStack returns the return addresses currently on the stack, oldest
+// first.
+func (e *Chip8Emulator) GetStack() []uint16 {
+	return e.stack.Contents()[:e.stack.Pointer()]
+}
+
+func (e *Chip8Emulator) GetDelayTimer() uint8 {
+	return e.delayTimer.GetTimer()
+}
+
+func (e *Chip8Emulator) GetSoundTimer() uint8 {
+	return e.soundTimer.GetTimer()
+}
+
+func (e *Chip8Emulator) GetCycleCount() uint64 {
+	return e.cycleCount
+}
+
+func (e *Chip8Emulator) GetDrawCount() uint64 {
+	return e.drawCount
+}
+
 func (e *Chip8Emulator) GetOpCode() uint16 {
+	if int(e.pc)+1 >= len(e.memory) {
+		return 0
+	}
 	return uint16(e.memory[e.pc])<<8 | uint16(e.memory[e.pc+1])
 }
 
+// GetFault returns the fault that halted the emulator, or nil while it is
+// running normally.
+func (e *Chip8Emulator) GetFault() *EmulatorError {
+	return e.fault
+}
+
 func (e *Chip8Emulator) ResetFps() {
 	e.fps.Reset()
 }
@@ -1,170 +1,177 @@
 package chip8
 
 import (
-	_ "embed"
+	"bytes"
+	"flag"
 	"fmt"
-	"reflect"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
-
-	"github.com/mrchip53/chip-station/utilities"
 )
 
-//go:embed 1-chip8-logo.ch8
-var rom1 []byte
-
-//go:embed output/1-chip8-logo-test.bin
-var rom1Test []byte
-
-func TestChip8Emulator_Chip8Logo(t *testing.T) {
-	e := Chip8Emulator{}
-	e.Initialize(Hooks{
-		Decode: func(opcode uint16, drawCount uint64) bool {
-			return opcode&0xF000 == 0x1000
-		},
-		Draw: func(display [64][32]uint8, drawCount uint64) {
-			if drawCount != 11 {
-				return
-			}
+var update = flag.Bool("update", false, "regenerate the golden display dumps in output/")
 
-			bytes := make([]byte, 64*32)
-			for y := 0; y < 32; y++ {
-				for x := 0; x < 64; x++ {
-					bytes[y*64+x] = display[x][y]
-				}
-			}
-
-			if !reflect.DeepEqual(bytes, rom1Test) {
-				t.Fatal("Test failed")
-			}
-		},
-	})
-	e.LoadROM(rom1)
-	e.Loop()
+type scriptedKey struct {
+	frame int
+	key   uint8
+	state uint8
 }
 
-//go:embed 2-ibm-logo.ch8
-var rom2 []byte
-
-//go:embed output/2-ibm-logo-test.bin
-var rom2Test []byte
-
-func TestChip8Emulator_IBMLogo(t *testing.T) {
-	e := Chip8Emulator{}
-	e.Initialize(Hooks{
-		Decode: func(opcode uint16, drawCount uint64) bool {
-			return opcode&0xF000 == 0x1000
+// goldenTests run a test ROM for a number of frames and compare the display
+// to output/<name>-test.bin, one byte per pixel in rows. name defaults to the
+// ROM without its extension.
+var goldenTests = []struct {
+	name   string
+	rom    string
+	quirks Quirks
+	frames int
+	keys   []scriptedKey
+}{
+	{rom: "1-chip8-logo.ch8", quirks: QuirksCosmacVIP, frames: 60},
+	{rom: "2-ibm-logo.ch8", quirks: QuirksCosmacVIP, frames: 60},
+	{rom: "3-corax+.ch8", quirks: QuirksCosmacVIP, frames: 120},
+	{rom: "4-flags.ch8", quirks: QuirksCosmacVIP, frames: 180},
+	{
+		rom:    "5-quirks.ch8",
+		quirks: QuirksCosmacVIP,
+		frames: 600,
+		// Pick CHIP-8 from the platform menu.
+		keys: []scriptedKey{{frame: 60, key: 1, state: 1}, {frame: 70, key: 1, state: 0}},
+	},
+	{
+		name:   "5-quirks-schip-modern",
+		rom:    "5-quirks.ch8",
+		quirks: QuirksSChipModern,
+		frames: 600,
+		// Pick SUPER-CHIP, then the modern target.
+		keys: []scriptedKey{
+			{frame: 60, key: 2, state: 1}, {frame: 70, key: 2, state: 0},
+			{frame: 120, key: 1, state: 1}, {frame: 130, key: 1, state: 0},
 		},
-		Draw: func(display [64][32]uint8, drawCount uint64) {
-			if drawCount != 5 {
-				return
-			}
-
-			bytes := make([]byte, 64*32)
-			for y := 0; y < 32; y++ {
-				for x := 0; x < 64; x++ {
-					bytes[y*64+x] = display[x][y]
-				}
-			}
-
-			if !reflect.DeepEqual(bytes, rom2Test) {
-				t.Fatal("Test failed")
-			}
+	},
+	{
+		name:   "5-quirks-schip-legacy",
+		rom:    "5-quirks.ch8",
+		quirks: QuirksSChipLegacy,
+		frames: 600,
+		// Pick SUPER-CHIP, then the legacy target.
+		keys: []scriptedKey{
+			{frame: 60, key: 2, state: 1}, {frame: 70, key: 2, state: 0},
+			{frame: 120, key: 2, state: 1}, {frame: 130, key: 2, state: 0},
 		},
-	})
-	e.LoadROM(rom2)
-	e.Loop()
+	},
+	{
+		name:   "5-quirks-xochip",
+		rom:    "5-quirks.ch8",
+		quirks: QuirksXOChip,
+		frames: 600,
+		// Pick XO-CHIP.
+		keys: []scriptedKey{{frame: 60, key: 3, state: 1}, {frame: 70, key: 3, state: 0}},
+	},
 }
 
-//go:embed 3-corax+.ch8
-var rom3 []byte
-
-//go:embed output/3-corax+-test.bin
-var rom3Test []byte
-
-func TestChip8Emulator_CoraxPlus(t *testing.T) {
-	e := Chip8Emulator{}
-	e.Initialize(Hooks{
-		Decode: func(opcode uint16, drawCount uint64) bool {
-			return drawCount >= 68 && opcode&0xF000 == 0x1000
-		},
-		Draw: func(display [64][32]uint8, drawCount uint64) {
-			if drawCount != 67 {
-				return
+func TestGoldenImages(t *testing.T) {
+	for _, test := range goldenTests {
+		name := test.name
+		if name == "" {
+			name = strings.TrimSuffix(test.rom, ".ch8")
+		}
+		t.Run(name, func(t *testing.T) {
+			rom, err := os.ReadFile(test.rom)
+			if err != nil {
+				t.Fatal(err)
 			}
 
-			bytes := make([]byte, 64*32)
-			for y := 0; y < 32; y++ {
-				for x := 0; x < 64; x++ {
-					bytes[y*64+x] = display[x][y]
+			e := NewChip8Emulator(Hooks{}, test.quirks)
+			e.SetSeed(1)
+			e.SwapROM(rom)
+			e.Resume()
+			for frame := 0; frame < test.frames; frame++ {
+				for _, k := range test.keys {
+					if k.frame == frame {
+						e.SetKeyState(k.key, k.state)
+					}
 				}
+				e.Cycle(float64(frame) * 1000 / 60)
 			}
-
-			if !reflect.DeepEqual(bytes, rom3Test) {
-				t.Fatal("Test failed")
+			if fault := e.GetFault(); fault != nil {
+				t.Fatalf("emulator halted: %v", fault)
 			}
-		},
-	})
-	e.LoadROM(rom3)
-	e.Loop()
-}
-
-//go:embed 4-flags.ch8
-var rom4 []byte
-
-//go:embed output/4-flags-test.bin
-var rom4Test []byte
 
-func TestChip8Emulator_Flags(t *testing.T) {
-	e := Chip8Emulator{}
-	e.Initialize(Hooks{
-		Decode: func(opcode uint16, drawCount uint64) bool {
-			if drawCount > 78 {
-				return opcode&0xF000 == 0x1000
-			}
-			return false
-		},
-		Draw: func(display [64][32]uint8, drawCount uint64) {
-			if drawCount != 78 {
+			display := e.GetDisplay()
+			got := dumpDisplay(&display)
+			goldenPath := filepath.Join("output", name+"-test.bin")
+			if *update {
+				if err := os.WriteFile(goldenPath, got, 0644); err != nil {
+					t.Fatal(err)
+				}
 				return
 			}
 
-			bytes := make([]byte, 64*32)
-			for y := 0; y < 32; y++ {
-				for x := 0; x < 64; x++ {
-					bytes[y*64+x] = display[x][y]
-				}
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("%v (run with -update to create it)", err)
 			}
-
-			if !reflect.DeepEqual(bytes, rom4Test) {
-				t.Fatal("Test failed")
+			if !bytes.Equal(got, want) {
+				diffPath := filepath.Join(os.TempDir(), "chip8-golden", name+"-diff.png")
+				if err := saveDiffPNG(diffPath, &display, want); err != nil {
+					t.Fatalf("display does not match %s, writing diff failed: %v", goldenPath, err)
+				}
+				t.Fatalf("display does not match %s, diff written to %s", goldenPath, diffPath)
 			}
-		},
-	})
-	e.LoadROM(rom4)
-	e.Loop()
+		})
+	}
 }
 
-//go:embed 5-quirks.ch8
-var rom5 []byte
+func dumpDisplay(d *Display) []byte {
+	w, h := d.Width(), d.Height()
+	dump := make([]byte, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dump[y*w+x] = d.Pixel(x, y)
+		}
+	}
+	return dump
+}
 
-func TestChip8Emulator_Chip8Quirks(t *testing.T) {
-	e := Chip8Emulator{}
-	e.Initialize(Hooks{
-		Decode: func(opcode uint16, drawCount uint64) bool {
-			return false
-		},
-		Draw: func(display [64][32]uint8, drawCount uint64) {
-			bytes := make([]byte, 64*32)
-			for y := 0; y < 32; y++ {
-				for x := 0; x < 64; x++ {
-					bytes[y*64+x] = display[x][y]
-				}
+// saveDiffPNG draws pixels lit in both images white, pixels only lit in the
+// golden red and pixels only lit in the display green.
+func saveDiffPNG(path string, d *Display, golden []byte) error {
+	w, h := d.Width(), d.Height()
+	if len(golden) != w*h {
+		return fmt.Errorf("golden has %d pixels, display has %d", len(golden), w*h)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			got, want := d.Pixel(x, y) != 0, golden[y*w+x] != 0
+			c := color.RGBA{A: 0xFF}
+			switch {
+			case got && want:
+				c = color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+			case want:
+				c.R = 0xFF
+			case got:
+				c.G = 0xFF
 			}
-
-			utilities.SavePNG(display, fmt.Sprintf("screenshots/5-quirks-%d.png", drawCount))
-		},
-	})
-	e.SetMemory(0x1FF, []byte{0x01})
-	e.LoadROM(rom5)
-	e.Loop()
+			img.Set(x, y, c)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
 }
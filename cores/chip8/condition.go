@@ -0,0 +1,185 @@
+package chip8
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Condition is a breakpoint condition such as "v3 == 0x10" or
+// "i >= 0x300 && dt == 0". Operands are the registers v0-vf, i, pc, sp, dt
+// and st or numbers, compared with ==, !=, <, <=, > or >= and joined with
+// && and ||, && binding tighter than || as in Go.
+type Condition struct {
+	source string
+	// any holds the comparisons joined by ||, each a list of comparisons
+	// joined by &&.
+	any [][]comparison
+}
+
+type operand struct {
+	register string
+	value    int
+}
+
+type comparison struct {
+	left, right operand
+	op          string
+}
+
+func ParseCondition(source string) (*Condition, error) {
+	tokens, err := tokenizeCondition(source)
+	if err != nil {
+		return nil, err
+	}
+	c := &Condition{source: strings.TrimSpace(source)}
+	var all []comparison
+	for len(tokens) > 0 {
+		if len(tokens) < 3 {
+			return nil, fmt.Errorf("incomplete condition %q", source)
+		}
+		left, err := parseOperand(tokens[0])
+		if err != nil {
+			return nil, err
+		}
+		right, err := parseOperand(tokens[2])
+		if err != nil {
+			return nil, err
+		}
+		switch tokens[1] {
+		case "==", "!=", "<", "<=", ">", ">=":
+		default:
+			return nil, fmt.Errorf("expected comparison, got %q", tokens[1])
+		}
+		all = append(all, comparison{left: left, op: tokens[1], right: right})
+		tokens = tokens[3:]
+
+		if len(tokens) == 0 {
+			c.any = append(c.any, all)
+			break
+		}
+		if tokens[0] != "&&" && tokens[0] != "||" {
+			return nil, fmt.Errorf("expected && or ||, got %q", tokens[0])
+		}
+		if len(tokens) == 1 {
+			return nil, fmt.Errorf("incomplete condition %q", source)
+		}
+		if tokens[0] == "||" {
+			c.any = append(c.any, all)
+			all = nil
+		}
+		tokens = tokens[1:]
+	}
+	if len(c.any) == 0 {
+		return nil, fmt.Errorf("empty condition")
+	}
+	return c, nil
+}
+
+func (c *Condition) String() string {
+	return c.source
+}
+
+func (c *Condition) Eval(e *Chip8Emulator) bool {
+	for _, all := range c.any {
+		ok := true
+		for _, comparison := range all {
+			if !comparison.eval(e) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c comparison) eval(e *Chip8Emulator) bool {
+	l, r := c.left.eval(e), c.right.eval(e)
+	switch c.op {
+	case "==":
+		return l == r
+	case "!=":
+		return l != r
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	default:
+		return l >= r
+	}
+}
+
+func (o operand) eval(e *Chip8Emulator) int {
+	switch o.register {
+	case "":
+		return o.value
+	case "i":
+		return int(e.i)
+	case "pc":
+		return int(e.pc)
+	case "sp":
+		return e.stack.Pointer()
+	case "dt":
+		return int(e.delayTimer.GetTimer())
+	case "st":
+		return int(e.soundTimer.GetTimer())
+	default:
+		return int(e.v[o.value])
+	}
+}
+
+func parseOperand(token string) (operand, error) {
+	switch token {
+	case "i", "pc", "sp", "dt", "st":
+		return operand{register: token}, nil
+	}
+	if len(token) == 2 && token[0] == 'v' {
+		if n, err := strconv.ParseUint(token[1:], 16, 8); err == nil {
+			return operand{register: token, value: int(n)}, nil
+		}
+	}
+	n, err := strconv.ParseUint(token, 0, 16)
+	if err != nil {
+		return operand{}, fmt.Errorf("invalid operand %q", token)
+	}
+	return operand{value: int(n)}, nil
+}
+
+func tokenizeCondition(source string) ([]string, error) {
+	var tokens []string
+	s := strings.ToLower(source)
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsLetter(c) || unicode.IsDigit(c):
+			start := i
+			for i < len(s) && (unicode.IsLetter(rune(s[i])) || unicode.IsDigit(rune(s[i]))) {
+				i++
+			}
+			tokens = append(tokens, s[start:i])
+		default:
+			if i+1 < len(s) {
+				switch s[i : i+2] {
+				case "==", "!=", "<=", ">=", "&&", "||":
+					tokens = append(tokens, s[i:i+2])
+					i += 2
+					continue
+				}
+			}
+			if c != '<' && c != '>' {
+				return nil, fmt.Errorf("unexpected %q in condition", c)
+			}
+			tokens = append(tokens, string(c))
+			i++
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,225 @@
+package chip8
+
+type BreakReason uint8
+
+const (
+	BreakBreakpoint BreakReason = iota
+	BreakStep
+	BreakFrame
+	BreakWatchpoint
+)
+
+func (r BreakReason) String() string {
+	switch r {
+	case BreakBreakpoint:
+		return "breakpoint"
+	case BreakStep:
+		return "step"
+	case BreakFrame:
+		return "frame"
+	case BreakWatchpoint:
+		return "watchpoint"
+	default:
+		return "unknown"
+	}
+}
+
+// Breakpoint pauses the emulator before the instruction at Address runs. A
+// nil Condition always breaks.
+type Breakpoint struct {
+	Address   uint16
+	Condition *Condition
+}
+
+// Registers is a snapshot of the machine registers for debuggers.
+type Registers struct {
+	PC         uint16
+	I          uint16
+	V          [NUM_REGISTERS]uint8
+	Stack      []uint16
+	DelayTimer uint8
+	SoundTimer uint8
+	Cycle      uint64
+	Frame      uint64
+}
+
+type stepMode uint8
+
+const (
+	stepNone stepMode = iota
+	stepInto
+	stepOver
+	stepOut
+	stepFrame
+)
+
+type debugger struct {
+	breakpoints map[uint16]Breakpoint
+	watchpoints []Watchpoint
+
+	// The instruction being executed and the watchpoints it hit so far.
+	pc        uint16
+	opcode    uint16
+	watchHits []WatchHit
+
+	mode     stepMode
+	depth    int
+	returnPc uint16
+	frame    uint64
+
+	// hitAt is the PC the last break stopped at, while broke is set until
+	// the emulator resumes.
+	hitAt uint16
+	broke bool
+	// Set when resuming from a break so the instruction the emulator
+	// stopped on runs instead of hitting its breakpoint again.
+	skipBreakpoint bool
+}
+
+func (e *Chip8Emulator) hitBreakpoint() bool {
+	d := &e.debugger
+	if d.skipBreakpoint {
+		d.skipBreakpoint = false
+		return false
+	}
+	bp, ok := d.breakpoints[e.pc]
+	if !ok || bp.Condition != nil && !bp.Condition.Eval(e) {
+		return false
+	}
+	e.breakAt(BreakBreakpoint)
+	return true
+}
+
+func (e *Chip8Emulator) checkStep() {
+	d := &e.debugger
+	switch {
+	case d.mode == stepInto:
+		e.breakAt(BreakStep)
+	case d.mode == stepOver && e.pc == d.returnPc && e.stack.Pointer() == d.depth:
+		e.breakAt(BreakStep)
+	case d.mode == stepOut && e.stack.Pointer() < d.depth:
+		e.breakAt(BreakStep)
+	}
+}
+
+func (e *Chip8Emulator) checkFrame() {
+	if e.debugger.mode == stepFrame && e.drawCount >= e.debugger.frame {
+		e.breakAt(BreakFrame)
+	}
+}
+
+func (e *Chip8Emulator) breakAt(reason BreakReason) {
+	e.debugger.mode = stepNone
+	e.debugger.hitAt = e.pc
+	e.debugger.broke = true
+	e.pause()
+	if e.hooks.Break != nil {
+		e.hooks.Break(reason, e.pc)
+	}
+}
+
+// step runs a single instruction while paused.
+func (e *Chip8Emulator) step() {
+	e.pause()
+	e.debugger.mode = stepInto
+	e.debugger.skipBreakpoint = true
+	e.cycle()
+	e.debugger.mode = stepNone
+}
+
+// stepOver runs a subroutine call until it returns, any other instruction
+// is a single step.
+func (e *Chip8Emulator) stepOver() {
+	if e.GetOpCode()&0xF000 != 0x2000 {
+		e.step()
+		return
+	}
+	e.resume()
+	e.debugger.skipBreakpoint = true
+	e.debugger.mode = stepOver
+	e.debugger.depth = e.stack.Pointer()
+	e.debugger.returnPc = e.pc + 2
+}
+
+// stepOut runs until the current subroutine returns. Outside of a
+// subroutine it is a single step.
+func (e *Chip8Emulator) stepOut() {
+	if e.stack.Pointer() == 0 {
+		e.step()
+		return
+	}
+	e.resume()
+	e.debugger.skipBreakpoint = true
+	e.debugger.mode = stepOut
+	e.debugger.depth = e.stack.Pointer()
+}
+
+func (e *Chip8Emulator) runToFrame(frame uint64) {
+	e.resume()
+	e.debugger.mode = stepFrame
+	e.debugger.frame = frame
+}
+
+// AddBreakpoint sets a breakpoint at address, replacing any breakpoint
+// already there. An empty condition always breaks.
+func (e *Chip8Emulator) AddBreakpoint(address uint16, condition string) error {
+	bp := Breakpoint{Address: address}
+	if condition != "" {
+		c, err := ParseCondition(condition)
+		if err != nil {
+			return err
+		}
+		bp.Condition = c
+	}
+	e.EnqueueMessage(BreakpointMessage{breakpoint: bp})
+	return nil
+}
+
+func (e *Chip8Emulator) RemoveBreakpoint(address uint16) {
+	e.EnqueueMessage(BreakpointMessage{breakpoint: Breakpoint{Address: address}, remove: true})
+}
+
+func (e *Chip8Emulator) ClearBreakpoints() {
+	e.EnqueueMessage(ClearBreakpointsMessage{})
+}
+
+func (e *Chip8Emulator) GetBreakpoints() []Breakpoint {
+	breakpoints := make([]Breakpoint, 0, len(e.debugger.breakpoints))
+	for _, bp := range e.debugger.breakpoints {
+		breakpoints = append(breakpoints, bp)
+	}
+	return breakpoints
+}
+
+// Step pauses the emulator and runs a single instruction.
+func (e *Chip8Emulator) Step() {
+	e.EnqueueMessage(StepMessage{mode: stepInto})
+}
+
+// StepOver runs until the instruction after a subroutine call.
+func (e *Chip8Emulator) StepOver() {
+	e.EnqueueMessage(StepMessage{mode: stepOver})
+}
+
+// StepOut runs until the current subroutine returns.
+func (e *Chip8Emulator) StepOut() {
+	e.EnqueueMessage(StepMessage{mode: stepOut})
+}
+
+// RunToFrame runs until the frame counter reaches frame and pauses.
+func (e *Chip8Emulator) RunToFrame(frame uint64) {
+	e.EnqueueMessage(StepMessage{mode: stepFrame, frame: frame})
+}
+
+func (e *Chip8Emulator) GetRegisters() Registers {
+	return Registers{
+		PC:         e.pc,
+		I:          e.i,
+		V:          e.v,
+		Stack:      e.GetStack(),
+		DelayTimer: e.delayTimer.GetTimer(),
+		SoundTimer: e.soundTimer.GetTimer(),
+		Cycle:      e.cycleCount,
+		Frame:      e.drawCount,
+	}
+}
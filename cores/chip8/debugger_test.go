@@ -0,0 +1,169 @@
+package chip8
+
+import "testing"
+
+func TestParseCondition(t *testing.T) {
+	for _, test := range []struct {
+		source string
+		valid  bool
+	}{
+		{"v3 == 0x10", true},
+		{"i >= 0x300 && dt == 0", true},
+		{"VF != 1 || pc < 0x250 && sp > 0", true},
+		{"st<=3", true},
+		{"", false},
+		{"v3 ==", false},
+		{"v3 = 1", false},
+		{"vg == 1", false},
+		{"v0 == 1 &&", false},
+		{"v0 == 1 v1 == 2", false},
+		{"v0 == 0x10000", false},
+	} {
+		_, err := ParseCondition(test.source)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("ParseCondition(%q) error = %v, want valid %v", test.source, err, test.valid)
+		}
+	}
+}
+
+func TestConditionEval(t *testing.T) {
+	e := NewChip8Emulator(Hooks{}, QuirksCosmacVIP)
+	e.v[0], e.v[1], e.v[2] = 1, 0, 0
+	e.i = 0x300
+
+	for _, test := range []struct {
+		source string
+		want   bool
+	}{
+		{"v0 == 1", true},
+		{"i > 0x2FF && i < 0x301", true},
+		{"pc == 0x200", true},
+		// && binds tighter than ||, folding left to right would be false.
+		{"v0 == 1 || v1 == 1 && v2 == 1", true},
+		{"v1 == 1 && v2 == 1 || v0 == 1", true},
+		{"v1 == 1 || v0 == 1 && v2 == 1", false},
+		{"v0 == 1 && v1 == 0 && v2 == 1", false},
+	} {
+		c, err := ParseCondition(test.source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := c.Eval(e); got != test.want {
+			t.Errorf("%q = %v, want %v", test.source, got, test.want)
+		}
+	}
+}
+
+// subroutineRom calls a subroutine that sets v1 and v2 and returns.
+var subroutineRom = []byte{
+	0x22, 0x08, // 0x200: call 0x208
+	0x60, 0x05, // 0x202: v0 := 5
+	0x12, 0x04, // 0x204: jump 0x204
+	0x00, 0x00, // 0x206:
+	0x61, 0x01, // 0x208: v1 := 1
+	0x62, 0x02, // 0x20A: v2 := 2
+	0x00, 0xEE, // 0x20C: return
+}
+
+type breakRecorder struct {
+	reasons []BreakReason
+	pcs     []uint16
+}
+
+func (b *breakRecorder) hooks() Hooks {
+	return Hooks{Break: func(reason BreakReason, pc uint16) {
+		b.reasons = append(b.reasons, reason)
+		b.pcs = append(b.pcs, pc)
+	}}
+}
+
+func (b *breakRecorder) check(t *testing.T, reason BreakReason, pc uint16) {
+	t.Helper()
+	if len(b.reasons) != 1 || b.reasons[0] != reason || b.pcs[0] != pc {
+		t.Errorf("breaks = %v at %X, want %v at %X", b.reasons, b.pcs, reason, pc)
+	}
+}
+
+func TestStepOver(t *testing.T) {
+	var breaks breakRecorder
+	e := NewChip8Emulator(breaks.hooks(), QuirksCosmacVIP)
+	e.SwapROM(subroutineRom)
+	// Loading a ROM resumes the emulator.
+	e.Pause()
+	e.Cycle(0)
+
+	e.StepOver()
+	e.Cycle(0)
+	breaks.check(t, BreakStep, 0x202)
+	if !e.IsPaused() || e.v[1] != 1 || e.v[2] != 2 || e.v[0] != 0 {
+		t.Errorf("paused = %v, v = %v", e.IsPaused(), e.v[:3])
+	}
+}
+
+func TestStepOut(t *testing.T) {
+	var breaks breakRecorder
+	e := NewChip8Emulator(breaks.hooks(), QuirksCosmacVIP)
+	e.SwapROM(subroutineRom)
+	e.Step()
+	e.Cycle(0)
+	if e.pc != 0x208 {
+		t.Fatalf("stepped to %X, want 208", e.pc)
+	}
+
+	breaks = breakRecorder{}
+	e.StepOut()
+	e.Cycle(0)
+	breaks.check(t, BreakStep, 0x202)
+	if !e.IsPaused() || e.v[2] != 2 || len(e.GetStack()) != 0 {
+		t.Errorf("paused = %v, v2 = %d, stack = %v", e.IsPaused(), e.v[2], e.GetStack())
+	}
+}
+
+func TestRunToFrame(t *testing.T) {
+	var breaks breakRecorder
+	var e *Chip8Emulator
+	var frame uint64
+	e = NewChip8Emulator(Hooks{Break: func(reason BreakReason, pc uint16) {
+		breaks.reasons = append(breaks.reasons, reason)
+		breaks.pcs = append(breaks.pcs, pc)
+		frame = e.GetDrawCount()
+	}}, QuirksCosmacVIP)
+	e.SwapROM(subroutineRom)
+	e.RunToFrame(10)
+	for i := 0; i < 20; i++ {
+		e.Cycle(0)
+	}
+
+	breaks.check(t, BreakFrame, 0x204)
+	if frame != 10 || !e.IsPaused() {
+		t.Errorf("stopped at frame %d, paused = %v, want frame 10", frame, e.IsPaused())
+	}
+}
+
+func TestBreakpointAtEntry(t *testing.T) {
+	var breaks breakRecorder
+	e := NewChip8Emulator(breaks.hooks(), QuirksCosmacVIP)
+	if err := e.AddBreakpoint(0x200, ""); err != nil {
+		t.Fatal(err)
+	}
+	e.SwapROM(subroutineRom)
+	e.Resume()
+	e.Cycle(0)
+	breaks.check(t, BreakBreakpoint, 0x200)
+	if !e.IsPaused() || e.pc != 0x200 {
+		t.Fatalf("paused = %v at %X, want paused at 200", e.IsPaused(), e.pc)
+	}
+
+	// Resuming runs the instruction the break stopped on.
+	breaks = breakRecorder{}
+	e.Resume()
+	e.Cycle(0)
+	if len(breaks.reasons) != 0 || e.IsPaused() {
+		t.Errorf("breaks = %v, paused = %v after resuming", breaks.reasons, e.IsPaused())
+	}
+
+	// Loading the ROM again stops at the entry point again.
+	e.SwapROM(subroutineRom)
+	e.Cycle(0)
+	breaks.check(t, BreakBreakpoint, 0x200)
+}
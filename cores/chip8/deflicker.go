@@ -0,0 +1,153 @@
+package chip8
+
+// Deflicker selects how frames are filtered against the flicker of sprites
+// being erased and drawn again every frame. It only changes the frames
+// handed out, never the display the program sees.
+type Deflicker uint8
+
+const (
+	DeflickerOff Deflicker = iota
+	// DeflickerDecay lets pixels that turn off fade out over a few frames,
+	// like a slow phosphor.
+	DeflickerDecay
+	// DeflickerBlend shows every pixel lit in any of the last
+	// DEFLICKER_FRAMES frames.
+	DeflickerBlend
+	// DeflickerClear shows the display as it was before the last clear, so
+	// programs clearing and redrawing the screen only show whole pictures.
+	// Programs that stop clearing are shown as they are.
+	DeflickerClear
+)
+
+const (
+	// DEFLICKER_DECAY is the share of its light a pixel keeps every frame
+	// after it turned off.
+	DEFLICKER_DECAY = 0.5
+	// DEFLICKER_MIN_LIGHT is the light level below which a fading pixel is
+	// dark, out of 255.
+	DEFLICKER_MIN_LIGHT = 16
+	// DEFLICKER_FRAMES is the number of frames DeflickerBlend combines.
+	DEFLICKER_FRAMES = 3
+	// DEFLICKER_CLEAR_FRAMES is how many frames DeflickerClear waits for a
+	// clear before it shows the display as it is.
+	DEFLICKER_CLEAR_FRAMES = 4
+)
+
+var deflickerNames = map[string]Deflicker{
+	"off":   DeflickerOff,
+	"decay": DeflickerDecay,
+	"blend": DeflickerBlend,
+	"clear": DeflickerClear,
+}
+
+func ParseDeflicker(name string) (Deflicker, bool) {
+	d, ok := deflickerNames[name]
+	return d, ok
+}
+
+func (d Deflicker) String() string {
+	for name, mode := range deflickerNames {
+		if mode == d {
+			return name
+		}
+	}
+	return "off"
+}
+
+// deflickerState is the history the filters need.
+type deflickerState struct {
+	// lit and light are the plane bits and light level of every pixel as
+	// last shown by DeflickerDecay.
+	lit   []uint8
+	light []uint8
+
+	// history holds the pixels of the frames before this one, newest
+	// first, for DeflickerBlend.
+	history [][]uint8
+
+	// cleared is the display before the last clear of the running frame
+	// and shown the one before, for DeflickerClear.
+	cleared    Display
+	hasCleared bool
+	shown      Display
+	hasShown   bool
+	sinceClear int
+}
+
+func (e *Chip8Emulator) SetDeflicker(d Deflicker) {
+	e.EnqueueMessage(DeflickerMessage{deflicker: d})
+}
+
+func (e *Chip8Emulator) GetDeflicker() Deflicker {
+	return e.deflicker
+}
+
+// clearing records the display a clear is about to erase.
+func (e *Chip8Emulator) clearing() {
+	if e.deflicker == DeflickerClear {
+		e.flicker.cleared = e.display
+		e.flicker.hasCleared = true
+	}
+}
+
+// deflickerDisplay is the display to build the frame from, the one before
+// the last clear for DeflickerClear and the live one otherwise.
+func (e *Chip8Emulator) deflickerDisplay() *Display {
+	if e.deflicker != DeflickerClear {
+		return &e.display
+	}
+	f := &e.flicker
+	if f.hasCleared {
+		f.shown = f.cleared
+		f.hasShown = true
+		f.hasCleared = false
+		f.sinceClear = 0
+	} else if f.sinceClear < DEFLICKER_CLEAR_FRAMES {
+		f.sinceClear++
+	}
+	if !f.hasShown || f.sinceClear >= DEFLICKER_CLEAR_FRAMES {
+		return &e.display
+	}
+	return &f.shown
+}
+
+// filter applies DeflickerDecay or DeflickerBlend to the pixels of a frame
+// in place. It returns the light of every pixel for DeflickerDecay and nil
+// otherwise.
+func (f *deflickerState) filter(mode Deflicker, pixels []uint8) []uint8 {
+	switch mode {
+	case DeflickerDecay:
+		if len(f.lit) != len(pixels) {
+			f.lit = make([]uint8, len(pixels))
+			f.light = make([]uint8, len(pixels))
+		}
+		for i, p := range pixels {
+			if p != 0 {
+				f.lit[i], f.light[i] = p, 0xFF
+			} else if f.lit[i] != 0 {
+				f.light[i] = uint8(float64(f.light[i]) * DEFLICKER_DECAY)
+				if f.light[i] < DEFLICKER_MIN_LIGHT {
+					f.lit[i], f.light[i] = 0, 0xFF
+				}
+			}
+		}
+		copy(pixels, f.lit)
+		return append([]uint8(nil), f.light...)
+
+	case DeflickerBlend:
+		current := append([]uint8(nil), pixels...)
+		for _, h := range f.history {
+			if len(h) != len(pixels) {
+				break
+			}
+			for i := range pixels {
+				pixels[i] |= h[i]
+			}
+		}
+		f.history = append([][]uint8{current}, f.history...)
+		if len(f.history) >= DEFLICKER_FRAMES {
+			f.history = f.history[:DEFLICKER_FRAMES-1]
+		}
+	}
+	return nil
+}
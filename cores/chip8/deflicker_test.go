@@ -0,0 +1,91 @@
+package chip8
+
+import "testing"
+
+// runDeflicker runs rom under d and returns the frame after every Cycle.
+// The quirks have no display wait, so ipf alone decides where frames end.
+func runDeflicker(t *testing.T, d Deflicker, ipf int, rom []byte, frames int) []*Frame {
+	t.Helper()
+	e := NewChip8Emulator(Hooks{}, QuirksSChipModern)
+	e.SwapROM(rom)
+	e.SetIPF(ipf)
+	e.SetDeflicker(d)
+	e.Resume()
+	var out []*Frame
+	for i := 0; i < frames; i++ {
+		e.Cycle(0)
+		out = append(out, e.GetFrame())
+	}
+	return out
+}
+
+// drawOnce draws the 0 glyph in the first frame and erases it again in the
+// second.
+var drawOnce = []byte{
+	0x60, 0x00, // 0x200: v0 := 0
+	0xF0, 0x29, // 0x202: i := hex v0
+	0xD0, 0x05, // 0x204: sprite v0 v0 5
+	0xD0, 0x05, // 0x206: sprite v0 v0 5
+	0x12, 0x08, // 0x208: jump 0x208
+}
+
+func TestDeflickerDecay(t *testing.T) {
+	frames := runDeflicker(t, DeflickerDecay, 3, drawOnce, 6)
+	want := []float64{1, 127.0 / 255, 63.0 / 255, 31.0 / 255}
+	for i, light := range want {
+		f := frames[i]
+		if f.Pixel(0, 0) != 1 || f.Light(0, 0) != light || !f.Dirty {
+			t.Errorf("frame %d: pixel %d with light %.3f, want 1 with %.3f", i, f.Pixel(0, 0), f.Light(0, 0), light)
+		}
+	}
+	if f := frames[4]; f.Pixel(0, 0) != 0 || !f.Dirty {
+		t.Errorf("pixel did not go dark after fading")
+	}
+	if frames[5].Dirty {
+		t.Errorf("dark display produced a new frame")
+	}
+}
+
+func TestDeflickerBlend(t *testing.T) {
+	frames := runDeflicker(t, DeflickerBlend, 3, drawOnce, 5)
+	for i, lit := range []uint8{1, 1, 1, 0} {
+		if got := frames[i].Pixel(0, 0); got != lit {
+			t.Errorf("frame %d: pixel = %d, want %d", i, got, lit)
+		}
+	}
+	if frames[2].Dirty || !frames[3].Dirty {
+		t.Errorf("frames 2 and 3 report Dirty %v and %v", frames[2].Dirty, frames[3].Dirty)
+	}
+}
+
+func TestDeflickerClear(t *testing.T) {
+	rom := []byte{
+		0x60, 0x00, // 0x200: v0 := 0
+		0xF0, 0x29, // 0x202: i := hex v0
+		0xD0, 0x05, // 0x204: sprite v0 v0 5
+		0x00, 0xE0, // 0x206: clear
+		0x12, 0x04, // 0x208: jump 0x204
+	}
+	// Frames end alternately after the clear and after the draw.
+	raw := runDeflicker(t, DeflickerOff, 2, rom, 6)
+	if raw[1].Pixel(0, 0) != 0 || raw[2].Pixel(0, 0) != 1 {
+		t.Fatalf("test ROM does not flicker")
+	}
+	frames := runDeflicker(t, DeflickerClear, 2, rom, 6)
+	for i, f := range frames[1:] {
+		if f.Pixel(0, 0) != 1 {
+			t.Errorf("frame %d does not show the picture before the clear", i+1)
+		}
+	}
+	if frames[0].Pixel(0, 0) != 0 {
+		t.Errorf("frame 0 shows a picture before anything was drawn")
+	}
+}
+
+func TestDeflickerClearFallback(t *testing.T) {
+	// Drawing without ever clearing shows the display as it is.
+	frames := runDeflicker(t, DeflickerClear, 3, drawOnce, 2)
+	if frames[0].Pixel(0, 0) != 1 || frames[1].Pixel(0, 0) != 0 {
+		t.Errorf("display without clears is not shown as it is")
+	}
+}
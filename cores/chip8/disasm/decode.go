@@ -0,0 +1,221 @@
+package disasm
+
+import (
+	"fmt"
+
+	"github.com/mrchip53/chip-station/cores/chip8"
+)
+
+// Flow describes where execution continues after an instruction.
+type Flow uint8
+
+const (
+	FlowNext Flow = iota
+	FlowSkip
+	FlowJump
+	FlowCall
+	FlowStop
+	FlowIndirect
+)
+
+// Instruction is a single decoded opcode. Target is the address operand of
+// jumps, calls and index loads when HasTarget is set.
+type Instruction struct {
+	Opcode    uint16
+	Size      int
+	Flow      Flow
+	Target    uint16
+	HasTarget bool
+	// Data targets point at sprites or other data rather than code.
+	DataTarget bool
+
+	// Mnemonic with a %s verb standing in for the target, if any.
+	format string
+}
+
+// Text renders the instruction in Octo syntax, using labels for targets
+// where one exists.
+func (in Instruction) Text(labels map[uint16]string) string {
+	if !in.HasTarget {
+		return in.format
+	}
+	target, ok := labels[in.Target]
+	if !ok && in.Flow == FlowCall {
+		return fmt.Sprintf(":call 0x%03X", in.Target)
+	} else if !ok {
+		target = fmt.Sprintf("0x%03X", in.Target)
+	}
+	return fmt.Sprintf(in.format, target)
+}
+
+func (in Instruction) String() string {
+	return in.Text(nil)
+}
+
+func reg(x uint16) string {
+	return fmt.Sprintf("v%x", x)
+}
+
+// Decode decodes the instruction at the start of code. It fails for opcodes
+// the platform does not support and for truncated instructions. Like the
+// core, SUPER-CHIP instructions decode on every platform and only XO-CHIP
+// ones depend on it.
+func Decode(code []byte, platform chip8.Platform) (Instruction, bool) {
+	if len(code) < 2 {
+		return Instruction{}, false
+	}
+	opcode := uint16(code[0])<<8 | uint16(code[1])
+	in := Instruction{Opcode: opcode, Size: 2}
+
+	x := opcode >> 8 & 0xF
+	y := opcode >> 4 & 0xF
+	n := opcode & 0xF
+	nn := opcode & 0xFF
+	nnn := opcode & 0xFFF
+
+	xo := platform == chip8.PlatformXOChip
+
+	target := func(flow Flow, format string) {
+		in.Flow = flow
+		in.Target = nnn
+		in.HasTarget = true
+		in.format = format
+	}
+	text := func(format string, args ...any) {
+		in.format = fmt.Sprintf(format, args...)
+	}
+	skip := func(format string, args ...any) {
+		text(format, args...)
+		in.Flow = FlowSkip
+	}
+
+	switch opcode >> 12 {
+	case 0x0:
+		switch {
+		case opcode == 0x00E0:
+			text("clear")
+		case opcode == 0x00EE:
+			text("return")
+			in.Flow = FlowStop
+		case opcode&0xFFF0 == 0x00C0:
+			text("scroll-down %d", n)
+		case opcode&0xFFF0 == 0x00D0 && xo:
+			text("scroll-up %d", n)
+		case opcode == 0x00FB:
+			text("scroll-right")
+		case opcode == 0x00FC:
+			text("scroll-left")
+		case opcode == 0x00FD:
+			text("exit")
+			in.Flow = FlowStop
+		case opcode == 0x00FE:
+			text("lores")
+		case opcode == 0x00FF:
+			text("hires")
+		default:
+			return in, false
+		}
+	case 0x1:
+		target(FlowJump, "jump %s")
+	case 0x2:
+		target(FlowCall, "%s")
+	case 0x3:
+		skip("if %s != 0x%02X then", reg(x), nn)
+	case 0x4:
+		skip("if %s == 0x%02X then", reg(x), nn)
+	case 0x5:
+		switch {
+		case n == 0:
+			skip("if %s != %s then", reg(x), reg(y))
+		case n == 2 && xo:
+			text("save %s - %s", reg(x), reg(y))
+		case n == 3 && xo:
+			text("load %s - %s", reg(x), reg(y))
+		default:
+			return in, false
+		}
+	case 0x6:
+		text("%s := 0x%02X", reg(x), nn)
+	case 0x7:
+		text("%s += 0x%02X", reg(x), nn)
+	case 0x8:
+		ops := map[uint16]string{
+			0x0: ":=", 0x1: "|=", 0x2: "&=", 0x3: "^=", 0x4: "+=",
+			0x5: "-=", 0x6: ">>=", 0x7: "=-", 0xE: "<<=",
+		}
+		op, ok := ops[n]
+		if !ok {
+			return in, false
+		}
+		text("%s %s %s", reg(x), op, reg(y))
+	case 0x9:
+		if n != 0 {
+			return in, false
+		}
+		skip("if %s == %s then", reg(x), reg(y))
+	case 0xA:
+		target(FlowNext, "i := %s")
+		in.DataTarget = true
+	case 0xB:
+		target(FlowIndirect, "jump0 %s")
+	case 0xC:
+		text("%s := random 0x%02X", reg(x), nn)
+	case 0xD:
+		text("sprite %s %s %d", reg(x), reg(y), n)
+	case 0xE:
+		switch nn {
+		case 0x9E:
+			skip("if %s -key then", reg(x))
+		case 0xA1:
+			skip("if %s key then", reg(x))
+		default:
+			return in, false
+		}
+	case 0xF:
+		switch {
+		case opcode == 0xF000 && xo:
+			if len(code) < 4 {
+				return in, false
+			}
+			in.Size = 4
+			in.Flow = FlowNext
+			in.Target = uint16(code[2])<<8 | uint16(code[3])
+			in.HasTarget = true
+			in.DataTarget = true
+			in.format = "i := long %s"
+		case nn == 0x01 && xo:
+			text("plane %d", x)
+		case opcode == 0xF002 && xo:
+			text("audio")
+		case nn == 0x07:
+			text("%s := delay", reg(x))
+		case nn == 0x0A:
+			text("%s := key", reg(x))
+		case nn == 0x15:
+			text("delay := %s", reg(x))
+		case nn == 0x18:
+			text("buzzer := %s", reg(x))
+		case nn == 0x1E:
+			text("i += %s", reg(x))
+		case nn == 0x29:
+			text("i := hex %s", reg(x))
+		case nn == 0x30:
+			text("i := bighex %s", reg(x))
+		case nn == 0x33:
+			text("bcd %s", reg(x))
+		case nn == 0x3A && xo:
+			text("pitch := %s", reg(x))
+		case nn == 0x55:
+			text("save %s", reg(x))
+		case nn == 0x65:
+			text("load %s", reg(x))
+		case nn == 0x75:
+			text("saveflags %s", reg(x))
+		case nn == 0x85:
+			text("loadflags %s", reg(x))
+		default:
+			return in, false
+		}
+	}
+	return in, true
+}
@@ -0,0 +1,207 @@
+package disasm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mrchip53/chip-station/cores/chip8"
+)
+
+const DATA_BYTES_PER_LINE = 8
+
+// Line is a single instruction or a run of data bytes. Label is set when the
+// line starts at the target of a jump, call or index load.
+type Line struct {
+	Address     uint16
+	Label       string
+	Code        bool
+	Instruction Instruction
+	Bytes       []byte
+}
+
+// Text renders the line in Octo syntax, without its label.
+func (l Line) Text(labels map[uint16]string) string {
+	if l.Code {
+		return l.Instruction.Text(labels)
+	}
+	data := make([]string, len(l.Bytes))
+	for i, b := range l.Bytes {
+		data[i] = fmt.Sprintf("0x%02X", b)
+	}
+	return strings.Join(data, " ")
+}
+
+type Program struct {
+	Platform chip8.Platform
+	Lines    []Line
+	Labels   map[uint16]string
+
+	rom []byte
+}
+
+type reference uint8
+
+const (
+	refData reference = iota
+	refJump
+	refCall
+)
+
+// Disassemble follows the control flow of a ROM loaded at
+// ROM_START_ADDRESS to tell code from data. Bytes that no path reaches,
+// such as sprites, are kept as data.
+func Disassemble(rom []byte, platform chip8.Platform) *Program {
+	p := &Program{
+		Platform: platform,
+		Labels:   make(map[uint16]string),
+		rom:      rom,
+	}
+
+	starts := make([]bool, len(rom))
+	covered := make([]bool, len(rom))
+	refs := make(map[uint16]reference)
+	reference := func(target uint16, r reference) {
+		if old, ok := refs[target]; !ok || r > old {
+			refs[target] = r
+		}
+	}
+
+	work := []int{chip8.ROM_START_ADDRESS}
+	for len(work) > 0 {
+		address := work[len(work)-1]
+		work = work[:len(work)-1]
+
+	Path:
+		for {
+			offset := address - chip8.ROM_START_ADDRESS
+			if offset < 0 || offset >= len(rom) || covered[offset] {
+				break
+			}
+			in, ok := Decode(rom[offset:], platform)
+			if !ok {
+				break
+			}
+			for i := 1; i < in.Size; i++ {
+				if covered[offset+i] {
+					break Path
+				}
+			}
+			starts[offset] = true
+			for i := 0; i < in.Size; i++ {
+				covered[offset+i] = true
+			}
+
+			next := address + in.Size
+			switch in.Flow {
+			case FlowJump, FlowIndirect:
+				reference(in.Target, refJump)
+				work = append(work, int(in.Target))
+				break Path
+			case FlowCall:
+				reference(in.Target, refCall)
+				work = append(work, int(in.Target))
+			case FlowStop:
+				break Path
+			case FlowSkip:
+				work = append(work, next+p.sizeAt(next))
+			default:
+				if in.HasTarget {
+					reference(in.Target, refData)
+				}
+			}
+			address = next
+		}
+	}
+
+	p.Labels[chip8.ROM_START_ADDRESS] = "main"
+	for target, r := range refs {
+		offset := int(target) - chip8.ROM_START_ADDRESS
+		if offset <= 0 || offset >= len(rom) || covered[offset] && !starts[offset] {
+			continue
+		}
+		switch r {
+		case refCall:
+			p.Labels[target] = fmt.Sprintf("sub-%03X", target)
+		case refJump:
+			p.Labels[target] = fmt.Sprintf("label-%03X", target)
+		default:
+			p.Labels[target] = fmt.Sprintf("data-%03X", target)
+		}
+	}
+
+	for offset := 0; offset < len(rom); {
+		address := uint16(chip8.ROM_START_ADDRESS + offset)
+		line := Line{Address: address, Label: p.Labels[address]}
+		if starts[offset] {
+			line.Code = true
+			line.Instruction, _ = Decode(rom[offset:], platform)
+			line.Bytes = rom[offset : offset+line.Instruction.Size]
+		} else {
+			end := offset + 1
+			for end < len(rom) && end-offset < DATA_BYTES_PER_LINE && !starts[end] {
+				if _, ok := p.Labels[uint16(chip8.ROM_START_ADDRESS+end)]; ok {
+					break
+				}
+				end++
+			}
+			line.Bytes = rom[offset:end]
+		}
+		p.Lines = append(p.Lines, line)
+		offset += len(line.Bytes)
+	}
+	return p
+}
+
+// sizeAt returns the size of the instruction at address, which is only
+// larger than two bytes for XO-CHIP long index loads.
+func (p *Program) sizeAt(address int) int {
+	offset := address - chip8.ROM_START_ADDRESS
+	if offset >= 0 && offset < len(p.rom) {
+		if in, ok := Decode(p.rom[offset:], p.Platform); ok {
+			return in.Size
+		}
+	}
+	return 2
+}
+
+// Around returns up to before lines ahead of pc and after lines from pc on.
+// When pc is not on a line, for example because the program jumped into
+// what looked like data, the lines are decoded linearly from pc.
+func (p *Program) Around(pc uint16, before, after int) []Line {
+	i := sort.Search(len(p.Lines), func(i int) bool {
+		return p.Lines[i].Address >= pc
+	})
+	if i < len(p.Lines) && p.Lines[i].Address == pc {
+		return p.Lines[max(i-before, 0):min(i+after, len(p.Lines))]
+	}
+
+	var lines []Line
+	offset := int(pc) - chip8.ROM_START_ADDRESS
+	for offset >= 0 && offset < len(p.rom) && len(lines) < after {
+		address := uint16(chip8.ROM_START_ADDRESS + offset)
+		line := Line{Address: address, Label: p.Labels[address]}
+		if in, ok := Decode(p.rom[offset:], p.Platform); ok {
+			line.Code = true
+			line.Instruction = in
+			line.Bytes = p.rom[offset : offset+in.Size]
+		} else {
+			line.Bytes = p.rom[offset:min(offset+2, len(p.rom))]
+		}
+		lines = append(lines, line)
+		offset += len(line.Bytes)
+	}
+	return lines
+}
+
+// String returns the program as Octo source.
+func (p *Program) String() string {
+	var b strings.Builder
+	for _, line := range p.Lines {
+		if line.Label != "" {
+			fmt.Fprintf(&b, ": %s\n", line.Label)
+		}
+		fmt.Fprintf(&b, "\t%s\n", line.Text(p.Labels))
+	}
+	return b.String()
+}
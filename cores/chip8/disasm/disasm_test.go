@@ -0,0 +1,72 @@
+package disasm
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mrchip53/chip-station/cores/chip8"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		code     []byte
+		platform chip8.Platform
+		want     string
+		ok       bool
+	}{
+		{[]byte{0x00, 0xE0}, chip8.PlatformChip8, "clear", true},
+		{[]byte{0x00, 0xFF}, chip8.PlatformChip8, "hires", true},
+		{[]byte{0x00, 0xC4}, chip8.PlatformChip8, "scroll-down 4", true},
+		{[]byte{0x00, 0xD4}, chip8.PlatformSChip, "", false},
+		{[]byte{0xF3, 0x75}, chip8.PlatformChip8, "saveflags v3", true},
+		{[]byte{0x12, 0x34}, chip8.PlatformChip8, "jump 0x234", true},
+		{[]byte{0x23, 0x00}, chip8.PlatformChip8, ":call 0x300", true},
+		{[]byte{0x3A, 0x10}, chip8.PlatformChip8, "if va != 0x10 then", true},
+		{[]byte{0x81, 0x2E}, chip8.PlatformChip8, "v1 <<= v2", true},
+		{[]byte{0x81, 0x28}, chip8.PlatformChip8, "", false},
+		{[]byte{0xD1, 0x25}, chip8.PlatformChip8, "sprite v1 v2 5", true},
+		{[]byte{0xE3, 0xA1}, chip8.PlatformChip8, "if v3 key then", true},
+		{[]byte{0xF3, 0x30}, chip8.PlatformChip8, "i := bighex v3", true},
+		{[]byte{0xF3, 0x3A}, chip8.PlatformSChip, "", false},
+		{[]byte{0x52, 0x43}, chip8.PlatformXOChip, "load v2 - v4", true},
+		{[]byte{0xF0, 0x00, 0x12, 0x34}, chip8.PlatformXOChip, "i := long 0x1234", true},
+		{[]byte{0xF0, 0x00}, chip8.PlatformXOChip, "", false},
+		{[]byte{0xF2, 0x01}, chip8.PlatformXOChip, "plane 2", true},
+	}
+
+	for _, test := range tests {
+		in, ok := Decode(test.code, test.platform)
+		if ok != test.ok {
+			t.Errorf("Decode(% X) ok = %v, want %v", test.code, ok, test.ok)
+			continue
+		}
+		if ok && in.String() != test.want {
+			t.Errorf("Decode(% X) = %q, want %q", test.code, in.String(), test.want)
+		}
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	rom, err := os.ReadFile("../2-ibm-logo.ch8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := Disassemble(rom, chip8.PlatformChip8)
+	source := p.String()
+	for _, want := range []string{
+		": main\n\tclear\n\ti := data-22A\n",
+		": label-228\n\tjump label-228\n",
+		": data-22A\n\t0xFF 0x00 0xFF 0x00 0x3C 0x00 0x3C 0x00\n",
+	} {
+		if !strings.Contains(source, want) {
+			t.Errorf("disassembly is missing %q:\n%s", want, source)
+		}
+	}
+
+	lines := p.Around(0x228, 2, 3)
+	if len(lines) != 5 || lines[2].Address != 0x228 || lines[3].Code {
+		t.Errorf("Around(0x228) = %+v", lines)
+	}
+}
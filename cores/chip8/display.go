@@ -0,0 +1,107 @@
+package chip8
+
+// Display stores one bit per plane in every pixel, so a pixel lit on
+// both XO-CHIP planes holds 3.
+type Display struct {
+	pixels [HIRES_SCREEN_WIDTH][HIRES_SCREEN_HEIGHT]uint8
+	hires  bool
+}
+
+func (d *Display) Width() int {
+	if d.hires {
+		return HIRES_SCREEN_WIDTH
+	}
+	return SCREEN_WIDTH
+}
+
+func (d *Display) Height() int {
+	if d.hires {
+		return HIRES_SCREEN_HEIGHT
+	}
+	return SCREEN_HEIGHT
+}
+
+func (d *Display) IsHires() bool {
+	return d.hires
+}
+
+func (d *Display) Pixel(x, y int) uint8 {
+	return d.pixels[x][y]
+}
+
+func (d *Display) setHires(hires bool) {
+	d.hires = hires
+	d.clear(ALL_PLANES)
+}
+
+func (d *Display) clear(planes uint8) {
+	for x := range d.pixels {
+		for y := range d.pixels[x] {
+			d.pixels[x][y] &^= planes
+		}
+	}
+}
+
+// toggle flips a pixel on a single plane and reports whether it was lit
+// on that plane beforehand.
+func (d *Display) toggle(x, y int, plane uint8) bool {
+	collision := d.pixels[x][y]&plane != 0
+	d.pixels[x][y] ^= plane
+	return collision
+}
+
+func (d *Display) move(x, y, fromX, fromY int, planes uint8) {
+	d.pixels[x][y] = d.pixels[x][y]&^planes | d.pixels[fromX][fromY]&planes
+}
+
+func (d *Display) scrollDown(n int, planes uint8) {
+	w, h := d.Width(), d.Height()
+	for y := h - 1; y >= 0; y-- {
+		for x := 0; x < w; x++ {
+			if y >= n {
+				d.move(x, y, x, y-n, planes)
+			} else {
+				d.pixels[x][y] &^= planes
+			}
+		}
+	}
+}
+
+func (d *Display) scrollUp(n int, planes uint8) {
+	w, h := d.Width(), d.Height()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if y+n < h {
+				d.move(x, y, x, y+n, planes)
+			} else {
+				d.pixels[x][y] &^= planes
+			}
+		}
+	}
+}
+
+func (d *Display) scrollRight(n int, planes uint8) {
+	w, h := d.Width(), d.Height()
+	for x := w - 1; x >= 0; x-- {
+		for y := 0; y < h; y++ {
+			if x >= n {
+				d.move(x, y, x-n, y, planes)
+			} else {
+				d.pixels[x][y] &^= planes
+			}
+		}
+	}
+}
+
+func (d *Display) scrollLeft(n int, planes uint8) {
+	w, h := d.Width(), d.Height()
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			if x+n < w {
+				d.move(x, y, x+n, y, planes)
+			} else {
+				d.pixels[x][y] &^= planes
+			}
+		}
+	}
+}
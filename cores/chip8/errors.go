@@ -0,0 +1,49 @@
+package chip8
+
+import "fmt"
+
+type ErrorKind uint8
+
+const (
+	ErrUnknownOpcode ErrorKind = iota
+	ErrStackOverflow
+	ErrStackUnderflow
+	ErrMemoryOutOfBounds
+	ErrPcOutOfRange
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrUnknownOpcode:
+		return "unknown opcode"
+	case ErrStackOverflow:
+		return "stack overflow"
+	case ErrStackUnderflow:
+		return "stack underflow"
+	case ErrMemoryOutOfBounds:
+		return "memory access out of bounds"
+	case ErrPcOutOfRange:
+		return "pc out of range"
+	default:
+		return "unknown error"
+	}
+}
+
+// EmulatorError is a fault that halted the emulator. PC and Opcode refer to
+// the instruction that faulted, Address to the memory it tried to access.
+type EmulatorError struct {
+	Kind    ErrorKind
+	PC      uint16
+	Opcode  uint16
+	Cycle   uint64
+	Address int
+}
+
+func (e *EmulatorError) Error() string {
+	switch e.Kind {
+	case ErrMemoryOutOfBounds, ErrPcOutOfRange:
+		return fmt.Sprintf("%s: address 0x%04X, pc: 0x%04X, op: 0x%04X, cycle: %d", e.Kind, e.Address, e.PC, e.Opcode, e.Cycle)
+	default:
+		return fmt.Sprintf("%s: pc: 0x%04X, op: 0x%04X, cycle: %d", e.Kind, e.PC, e.Opcode, e.Cycle)
+	}
+}
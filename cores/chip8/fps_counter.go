@@ -1,8 +1,17 @@
 package chip8
 
+// FPS_WINDOW is how long, in milliseconds, frames are counted before the
+// frame rate is updated.
+const FPS_WINDOW = 1000
+
+// FpsCounter measures the frames run per second. Counting over a window
+// instead of timing single frames keeps several frames run for one host
+// frame from reading as an infinite rate.
 type FpsCounter struct {
-	fps  float64
-	last float64
+	fps     float64
+	started bool
+	start   float64
+	frames  int
 }
 
 func NewFpsCounter() *FpsCounter {
@@ -10,15 +19,21 @@ func NewFpsCounter() *FpsCounter {
 }
 
 func (f *FpsCounter) UpdateFps(now float64) {
-	now *= 0.001
-	d := now - f.last
-	f.last = now
-	f.fps = 1 / d
+	if !f.started {
+		f.started = true
+		f.start = now
+		return
+	}
+	f.frames++
+	if d := now - f.start; d >= FPS_WINDOW {
+		f.fps = float64(f.frames) * 1000 / d
+		f.start = now
+		f.frames = 0
+	}
 }
 
 func (f *FpsCounter) Reset() {
-	f.fps = 0
-	f.last = 0
+	*f = FpsCounter{}
 }
 
 func (f *FpsCounter) GetFps() float64 {
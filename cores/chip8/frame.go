@@ -0,0 +1,123 @@
+package chip8
+
+import "bytes"
+
+// Frame is the display at the end of a frame. It is never changed after it
+// is handed out, so frontends can keep it and read it from any goroutine
+// while the emulator runs on.
+type Frame struct {
+	// Number is the frame counter the frame was finished at.
+	Number uint64
+	// Dirty reports whether the display changed since the previous frame.
+	Dirty bool
+
+	width  int
+	height int
+	planes int
+	// pixels holds a byte per pixel in rows, shared between frames with
+	// the same display.
+	pixels []uint8
+	// light holds the light level of every pixel out of 255 while
+	// DeflickerDecay fades pixels out, and is nil otherwise.
+	light []uint8
+}
+
+func (f *Frame) Width() int {
+	return f.width
+}
+
+func (f *Frame) Height() int {
+	return f.height
+}
+
+// Planes is the number of bitplanes a pixel can have lit, 2 on XO-CHIP and
+// 1 otherwise.
+func (f *Frame) Planes() int {
+	return f.planes
+}
+
+func (f *Frame) IsHires() bool {
+	return f.width == HIRES_SCREEN_WIDTH
+}
+
+func (f *Frame) Pixel(x, y int) uint8 {
+	return f.pixels[y*f.width+x]
+}
+
+// Light is how lit the pixel at x, y is, from 1 when it shows its palette
+// color fully to 0 when it shows the color of unlit pixels. Only pixels
+// fading out under DeflickerDecay are partly lit.
+func (f *Frame) Light(x, y int) float64 {
+	if f.light == nil || f.pixels[y*f.width+x] == 0 {
+		return 1
+	}
+	return float64(f.light[y*f.width+x]) / 0xFF
+}
+
+// Pixels returns a copy of the pixels, a byte per pixel in rows.
+func (f *Frame) Pixels() []uint8 {
+	return append([]uint8(nil), f.pixels...)
+}
+
+// finishFrame builds the frame the last Cycle ended with and hands it to
+// the frame hook if it changed.
+func (e *Chip8Emulator) finishFrame() {
+	planes := 1
+	if e.quirks.Platform == PlatformXOChip {
+		planes = 2
+	}
+	display := e.deflickerDisplay()
+	filtered := e.deflicker == DeflickerDecay || e.deflicker == DeflickerBlend
+	if !filtered && e.frame != nil && *display == e.frameDisplay && planes == e.frame.planes {
+		e.keepFrame()
+		return
+	}
+
+	f := &Frame{
+		Number: e.drawCount,
+		Dirty:  true,
+		width:  display.Width(),
+		height: display.Height(),
+		planes: planes,
+	}
+	f.pixels = make([]uint8, f.width*f.height)
+	for y := 0; y < f.height; y++ {
+		for x := 0; x < f.width; x++ {
+			f.pixels[y*f.width+x] = display.Pixel(x, y)
+		}
+	}
+	if filtered {
+		// The filters change frames while the display stays the same, so
+		// the result is compared instead.
+		f.light = e.flicker.filter(e.deflicker, f.pixels)
+		if e.frame != nil && e.frame.sameImage(f) {
+			e.keepFrame()
+			return
+		}
+	}
+
+	e.frameDisplay = *display
+	e.frame = f
+	if e.hooks.Frame != nil {
+		e.hooks.Frame(f)
+	}
+}
+
+// keepFrame finishes a frame showing the same image as the last one.
+func (e *Chip8Emulator) keepFrame() {
+	f := *e.frame
+	f.Number = e.drawCount
+	f.Dirty = false
+	e.frame = &f
+}
+
+func (f *Frame) sameImage(o *Frame) bool {
+	return f.width == o.width && f.height == o.height && f.planes == o.planes &&
+		bytes.Equal(f.pixels, o.pixels) && bytes.Equal(f.light, o.light)
+}
+
+// GetFrame returns the frame the last Cycle ended with, or nil before the
+// first one.
+func (e *Chip8Emulator) GetFrame() *Frame {
+	return e.frame
+}
@@ -0,0 +1,48 @@
+package chip8
+
+import "testing"
+
+func TestFrameHook(t *testing.T) {
+	var frames []*Frame
+	e := NewChip8Emulator(Hooks{
+		Frame: func(f *Frame) {
+			frames = append(frames, f)
+		},
+	}, QuirksCosmacVIP)
+	rom := []byte{
+		0x60, 0x00, // 0x200: v0 := 0
+		0xF0, 0x29, // 0x202: i := hex v0
+		0xD0, 0x05, // 0x204: sprite v0 v0 5
+		0x12, 0x06, // 0x206: jump 0x206
+	}
+	e.SwapROM(rom)
+	e.Resume()
+	for i := 0; i < 5; i++ {
+		e.Cycle(0)
+	}
+
+	if len(frames) != 1 {
+		t.Fatalf("frame hook ran %d times, want once", len(frames))
+	}
+	first := frames[0]
+	if !first.Dirty || first.Number != 1 || first.Width() != SCREEN_WIDTH || first.Planes() != 1 {
+		t.Errorf("first frame = %+v", first)
+	}
+	if first.Pixel(0, 0) != 1 || first.Pixel(4, 0) != 0 {
+		t.Errorf("first frame does not show the 0 glyph")
+	}
+	if f := e.GetFrame(); f.Dirty || f.Number != 5 || f.Pixel(0, 0) != 1 {
+		t.Errorf("last frame = %+v", f)
+	}
+
+	// Restarting clears the display, which leaves handed out frames alone.
+	e.SwapROM(rom)
+	e.Pause()
+	e.Cycle(0)
+	if len(frames) != 2 || frames[1].Pixel(0, 0) != 0 {
+		t.Fatalf("clearing the display did not produce a new frame")
+	}
+	if first.Pixel(0, 0) != 1 {
+		t.Errorf("an earlier frame changed")
+	}
+}
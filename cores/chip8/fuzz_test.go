@@ -0,0 +1,203 @@
+package chip8
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const (
+	FUZZ_FRAMES  = 30
+	CRASHERS_DIR = "testdata/crashers"
+)
+
+// fuzzPresets are the names of the quirks presets in a fixed order, so a
+// fuzz input picks the same one on every run.
+var fuzzPresets = func() []string {
+	var names []string
+	for name := range QuirksPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}()
+
+// crasherInput is saved next to a crasher ROM, so it is replayed with the
+// input that made it fail.
+type crasherInput struct {
+	Preset string `json:"preset"`
+	Keys   []byte `json:"keys"`
+}
+
+// runFuzzRom runs rom for a bounded number of frames, feeding one key
+// change per frame from keys: the low nibble is the key and bit 4 the state.
+// A failing ROM is saved to CRASHERS_DIR with its input as a regression.
+func runFuzzRom(t *testing.T, rom []byte, keys []byte, preset uint8) {
+	runCrasher(t, rom, crasherInput{Preset: fuzzPresets[int(preset)%len(fuzzPresets)], Keys: keys})
+}
+
+func runCrasher(t *testing.T, rom []byte, input crasherInput) {
+	quirks := QuirksPresets[input.Preset]
+	keys := input.Keys
+	defer func() {
+		if r := recover(); r != nil {
+			saveCrasher(t, CRASHERS_DIR, rom, input)
+			t.Fatalf("panic with %s quirks: %v", input.Preset, r)
+		}
+		if t.Failed() {
+			saveCrasher(t, CRASHERS_DIR, rom, input)
+		}
+	}()
+
+	e := NewChip8Emulator(Hooks{}, quirks)
+	e.SetSeed(1)
+	e.SwapROM(rom)
+	e.Resume()
+	for frame := 0; frame < FUZZ_FRAMES; frame++ {
+		if frame < len(keys) {
+			e.SetKeyState(keys[frame]&0xF, keys[frame]>>4&1)
+		}
+		e.Cycle(0)
+		checkFuzzInvariants(t, e)
+		if e.GetFault() != nil || t.Failed() {
+			return
+		}
+	}
+}
+
+func checkFuzzInvariants(t *testing.T, e *Chip8Emulator) {
+	if e.GetFault() == nil && int(e.GetPc()) >= len(e.memory) {
+		t.Errorf("pc 0x%X is outside memory without a fault", e.GetPc())
+	}
+
+	maxPixel := uint8(1)
+	if e.quirks.Platform == PlatformXOChip {
+		maxPixel = ALL_PLANES
+	}
+	display := e.GetDisplay()
+	for x := 0; x < HIRES_SCREEN_WIDTH; x++ {
+		for y := 0; y < HIRES_SCREEN_HEIGHT; y++ {
+			if p := display.Pixel(x, y); p > maxPixel {
+				t.Errorf("pixel (%d, %d) is %d with %s quirks", x, y, p, e.quirks.Platform)
+				return
+			}
+		}
+	}
+}
+
+// saveCrasher writes rom to dir as <hash>.ch8 and its input as <hash>.json,
+// hashing both so crashes of one ROM with different input are kept apart.
+func saveCrasher(t *testing.T, dir string, rom []byte, input crasherInput) {
+	data, err := json.Marshal(input)
+	if err != nil {
+		t.Logf("saving crasher: %v", err)
+		return
+	}
+	name := fmt.Sprintf("%x", sha256.Sum256(append(append([]byte(nil), rom...), data...)))
+	path := filepath.Join(dir, name+".ch8")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Logf("saving crasher: %v", err)
+		return
+	}
+	if err := os.WriteFile(path, rom, 0644); err != nil {
+		t.Logf("saving crasher: %v", err)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".json"), data, 0644); err != nil {
+		t.Logf("saving crasher: %v", err)
+		return
+	}
+	t.Logf("ROM saved to %s", path)
+}
+
+// loadCrasher reads a crasher ROM and its input. ok is false for ROMs saved
+// without one.
+func loadCrasher(path string) (rom []byte, input crasherInput, ok bool, err error) {
+	rom, err = os.ReadFile(path)
+	if err != nil {
+		return nil, input, false, err
+	}
+	data, err := os.ReadFile(strings.TrimSuffix(path, ".ch8") + ".json")
+	if errors.Is(err, fs.ErrNotExist) {
+		return rom, input, false, nil
+	}
+	if err != nil {
+		return nil, input, false, err
+	}
+	if err := json.Unmarshal(data, &input); err != nil {
+		return nil, input, false, fmt.Errorf("%s: %v", path, err)
+	}
+	if _, known := QuirksPresets[input.Preset]; !known {
+		return nil, input, false, fmt.Errorf("%s: unknown quirks preset %q", path, input.Preset)
+	}
+	return rom, input, true, nil
+}
+
+func FuzzEmulator(f *testing.F) {
+	for _, test := range goldenTests {
+		rom, err := os.ReadFile(test.rom)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(rom, []byte{0x11, 0x01}, uint8(0))
+	}
+	f.Add([]byte{0xF0, 0x00, 0xFF, 0xFF, 0xD0, 0x0F}, []byte{}, uint8(3))
+	f.Add([]byte{0xAF, 0xFF, 0xFF, 0x55}, []byte{}, uint8(1))
+	// Larger than memory on every platform but XO-CHIP.
+	f.Add(bytes.Repeat([]byte{0x12, 0x00}, 0x1000), []byte{}, uint8(0))
+
+	f.Fuzz(func(t *testing.T, rom []byte, keys []byte, preset uint8) {
+		runFuzzRom(t, rom, keys, preset)
+	})
+}
+
+// TestCrashers replays the ROMs fuzzing found problems with, with the
+// input they were saved with. ROMs saved without input run under every
+// quirks preset.
+func TestCrashers(t *testing.T) {
+	paths, _ := filepath.Glob(filepath.Join(CRASHERS_DIR, "*.ch8"))
+	for _, path := range paths {
+		rom, input, ok, err := loadCrasher(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			t.Run(filepath.Base(path), func(t *testing.T) {
+				runCrasher(t, rom, input)
+			})
+			continue
+		}
+		for _, preset := range fuzzPresets {
+			t.Run(fmt.Sprintf("%s/%s", filepath.Base(path), preset), func(t *testing.T) {
+				runCrasher(t, rom, crasherInput{Preset: preset})
+			})
+		}
+	}
+}
+
+func TestCrasherInput(t *testing.T) {
+	dir := t.TempDir()
+	rom := []byte{0x12, 0x00}
+	want := crasherInput{Preset: "xochip", Keys: []byte{0x11, 0x01, 0x1F}}
+	saveCrasher(t, dir, rom, want)
+
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.ch8"))
+	if len(paths) != 1 {
+		t.Fatalf("saved %d ROMs, want 1", len(paths))
+	}
+	gotRom, got, ok, err := loadCrasher(paths[0])
+	if err != nil || !ok {
+		t.Fatalf("loadCrasher: ok = %v, err = %v", ok, err)
+	}
+	if !bytes.Equal(gotRom, rom) || got.Preset != want.Preset || !bytes.Equal(got.Keys, want.Keys) {
+		t.Errorf("loaded %X with %+v, want %X with %+v", gotRom, got, rom, want)
+	}
+}
@@ -1,17 +1,22 @@
 package chip8
 
-import (
-	"math/rand"
-)
-
 var instructions = map[uint16]Instruction{
+	0x00C0: &ScrollDown{},
+	0x00D0: &ScrollUp{},
 	0x00E0: &ClearScreen{},
 	0x00EE: &Return{},
+	0x00FB: &ScrollRight{},
+	0x00FC: &ScrollLeft{},
+	0x00FD: &Exit{},
+	0x00FE: &LowResolution{},
+	0x00FF: &HighResolution{},
 	0x1000: &Jump{},
 	0x2000: &Call{},
 	0x3000: &SkipIfEqualImmediate{},
 	0x4000: &SkipIfNotEqualImmediate{},
 	0x5000: &SkipIfEqualRegister{},
+	0x5002: &SaveRegisterRange{},
+	0x5003: &LoadRegisterRange{},
 	0x6000: &SetRegisterImmediate{},
 	0x7000: &AddRegisterImmediate{},
 	0x8000: &SetRegister{},
@@ -30,23 +35,45 @@ var instructions = map[uint16]Instruction{
 	0xD000: &Draw{},
 	0xE09E: &SkipIfKeyPressed{},
 	0xE0A1: &SkipIfKeyNotPressed{},
+	0xF000: &LongSetIndex{},
+	0xF001: &SelectPlanes{},
+	0xF002: &LoadAudioPattern{},
 	0xF007: &SetRegisterWithDelayTimer{},
 	0xF00A: &WaitForKey{},
 	0xF015: &SetDelayTimer{},
 	0xF018: &SetSoundTimer{},
 	0xF01E: &AddRegisterToIndex{},
 	0xF029: &SetIndexToSprite{},
+	0xF030: &SetIndexToBigSprite{},
 	0xF033: &StoreBCD{},
+	0xF03A: &SetPitch{},
 	0xF055: &StoreRegisters{},
 	0xF065: &LoadRegisters{},
+	0xF075: &StoreFlags{},
+	0xF085: &LoadFlags{},
+}
+
+// xoChipInstructions only exist on XO-CHIP, as they rely on its memory,
+// bitplanes and audio. SUPER-CHIP instructions run on every platform.
+var xoChipInstructions = map[uint16]bool{
+	0x00D0: true,
+	0x5002: true,
+	0x5003: true,
+	0xF000: true,
+	0xF001: true,
+	0xF002: true,
+	0xF03A: true,
 }
 
 func getOpKey(opcode uint16) uint16 {
+	if opcode&0xFFF0 == 0x00C0 || opcode&0xFFF0 == 0x00D0 {
+		return opcode & 0xFFF0
+	}
 	if opcode < 0x1000 {
 		return opcode
 	}
 	op := opcode & 0xF000
-	if op == 0x8000 {
+	if op == 0x5000 || op == 0x8000 {
 		return opcode & 0xF00F
 	} else if op == 0xE000 || op == 0xF000 {
 		return opcode & 0xF0FF
@@ -55,7 +82,7 @@ func getOpKey(opcode uint16) uint16 {
 }
 
 type Instruction interface {
-	Execute(*Chip8Emulator)
+	Execute(*Chip8Emulator) error
 	Fill(uint16)
 }
 
@@ -83,347 +110,655 @@ type ClearScreen struct {
 	BaseInstruction
 }
 
-func (c ClearScreen) Execute(e *Chip8Emulator) {
-	e.clearDisplay()
+func (c ClearScreen) Execute(e *Chip8Emulator) error {
+	e.clearing()
+	e.display.clear(e.planes)
+	return nil
+}
+
+type ScrollDown struct {
+	BaseInstruction
+}
+
+func (s ScrollDown) Execute(e *Chip8Emulator) error {
+	e.display.scrollDown(int(s.n), e.planes)
+	return nil
+}
+
+type ScrollUp struct {
+	BaseInstruction
+}
+
+func (s ScrollUp) Execute(e *Chip8Emulator) error {
+	e.display.scrollUp(int(s.n), e.planes)
+	return nil
+}
+
+type ScrollRight struct {
+	BaseInstruction
+}
+
+func (s ScrollRight) Execute(e *Chip8Emulator) error {
+	e.display.scrollRight(4, e.planes)
+	return nil
+}
+
+type ScrollLeft struct {
+	BaseInstruction
+}
+
+func (s ScrollLeft) Execute(e *Chip8Emulator) error {
+	e.display.scrollLeft(4, e.planes)
+	return nil
+}
+
+type Exit struct {
+	BaseInstruction
+}
+
+func (x Exit) Execute(e *Chip8Emulator) error {
+	e.pc -= 2
+	e.pause()
+	return nil
+}
+
+type LowResolution struct {
+	BaseInstruction
+}
+
+func (l LowResolution) Execute(e *Chip8Emulator) error {
+	e.display.setHires(false)
+	return nil
+}
+
+type HighResolution struct {
+	BaseInstruction
+}
+
+func (h HighResolution) Execute(e *Chip8Emulator) error {
+	e.display.setHires(true)
+	return nil
 }
 
 type Return struct {
 	BaseInstruction
 }
 
-func (r Return) Execute(e *Chip8Emulator) {
-	e.pc = e.stack.Pop()
+func (r Return) Execute(e *Chip8Emulator) error {
+	pc, err := e.stack.Pop()
+	if err != nil {
+		return &EmulatorError{Kind: ErrStackUnderflow}
+	}
+	e.pc = pc
+	return nil
 }
 
 type Jump struct {
 	BaseInstruction
 }
 
-func (j Jump) Execute(e *Chip8Emulator) {
+func (j Jump) Execute(e *Chip8Emulator) error {
 	e.pc = j.nnn
+	return nil
 }
 
 type Call struct {
 	BaseInstruction
 }
 
-func (c Call) Execute(e *Chip8Emulator) {
-	e.stack.Push(e.pc)
+func (c Call) Execute(e *Chip8Emulator) error {
+	if err := e.stack.Push(e.pc); err != nil {
+		return &EmulatorError{Kind: ErrStackOverflow}
+	}
 	e.pc = c.nnn
+	return nil
 }
 
 type SkipIfNotEqualImmediate struct {
 	BaseInstruction
 }
 
-func (s SkipIfNotEqualImmediate) Execute(e *Chip8Emulator) {
+func (s SkipIfNotEqualImmediate) Execute(e *Chip8Emulator) error {
 	if e.v[s.x] != s.nn {
-		e.pc += 2
+		e.skip()
 	}
+	return nil
 }
 
 type SkipIfEqualImmediate struct {
 	BaseInstruction
 }
 
-func (s SkipIfEqualImmediate) Execute(e *Chip8Emulator) {
+func (s SkipIfEqualImmediate) Execute(e *Chip8Emulator) error {
 	if e.v[s.x] == s.nn {
-		e.pc += 2
+		e.skip()
 	}
+	return nil
 }
 
 type SkipIfEqualRegister struct {
 	BaseInstruction
 }
 
-func (s SkipIfEqualRegister) Execute(e *Chip8Emulator) {
+func (s SkipIfEqualRegister) Execute(e *Chip8Emulator) error {
 	if e.v[s.x] == e.v[s.y] {
-		e.pc += 2
+		e.skip()
 	}
+	return nil
 }
 
 type SetRegisterImmediate struct {
 	BaseInstruction
 }
 
-func (s SetRegisterImmediate) Execute(e *Chip8Emulator) {
+func (s SetRegisterImmediate) Execute(e *Chip8Emulator) error {
 	e.v[s.x] = s.nn
+	return nil
 }
 
 type AddRegisterImmediate struct {
 	BaseInstruction
 }
 
-func (a AddRegisterImmediate) Execute(e *Chip8Emulator) {
+func (a AddRegisterImmediate) Execute(e *Chip8Emulator) error {
 	e.v[a.x] += a.nn
+	return nil
 }
 
 type SkipIfNotEqualRegister struct {
 	BaseInstruction
 }
 
-func (s SkipIfNotEqualRegister) Execute(e *Chip8Emulator) {
+func (s SkipIfNotEqualRegister) Execute(e *Chip8Emulator) error {
 	if e.v[s.x] != e.v[s.y] {
-		e.pc += 2
+		e.skip()
 	}
+	return nil
 }
 
 type SetIndex struct {
 	BaseInstruction
 }
 
-func (s SetIndex) Execute(e *Chip8Emulator) {
+func (s SetIndex) Execute(e *Chip8Emulator) error {
 	e.i = s.nnn
+	return nil
 }
 
 type JumpPlusOffset struct {
 	BaseInstruction
 }
 
-func (j JumpPlusOffset) Execute(e *Chip8Emulator) {
+func (j JumpPlusOffset) Execute(e *Chip8Emulator) error {
+	if e.quirks.Jumping {
+		e.pc = j.nnn + uint16(e.v[j.x])
+		return nil
+	}
 	e.pc = j.nnn + uint16(e.v[0])
+	return nil
 }
 
 type Random struct {
 	BaseInstruction
 }
 
-func (r Random) Execute(e *Chip8Emulator) {
-	e.v[r.x] = uint8(rand.Intn(256)) & r.nn
+func (r Random) Execute(e *Chip8Emulator) error {
+	e.v[r.x] = uint8(e.rng.Intn(256)) & r.nn
+	return nil
 }
 
 type Draw struct {
 	BaseInstruction
 }
 
-func (d Draw) Execute(e *Chip8Emulator) {
-	x := uint16(e.v[d.x] % 64)
-	y := uint16(e.v[d.y] % 32)
+func (d Draw) Execute(e *Chip8Emulator) error {
+	w, h := e.display.Width(), e.display.Height()
+	x := int(e.v[d.x]) % w
+	y := int(e.v[d.y]) % h
+
+	// DXY0 draws a 16x16 sprite made of two bytes per row, or an 8x16 one
+	// in lores on SUPER-CHIP 1.1.
+	rows, cols := int(d.n), 8
+	if d.n == 0 {
+		rows, cols = 16, 16
+		if e.quirks.LoresTallSprites && !e.display.IsHires() {
+			cols = 8
+		}
+	}
+	countRows := e.quirks.RowCollisions && e.display.IsHires()
+
+	// Each selected XO-CHIP plane reads its own sprite, one after another.
 	e.v[0xF] = 0
-	for i := uint16(0); i < uint16(d.n); i++ {
-		sprite := e.memory[e.i+i]
-		for j := uint16(0); j < 8; j++ {
-			if (sprite & (0x80 >> j)) != 0 {
-				if x+j >= 64 || y+i >= 32 {
-					continue
+	addr := int(e.i)
+	for plane := uint8(1); plane <= ALL_PLANES; plane <<= 1 {
+		if e.planes&plane == 0 {
+			continue
+		}
+		for i := 0; i < rows; i++ {
+			var sprite uint16
+			for b := 0; b < cols/8; b++ {
+				data, err := e.readMemory(addr)
+				if err != nil {
+					return err
+				}
+				sprite |= uint16(data) << (8 - 8*b)
+				addr++
+			}
+			collided := false
+			if countRows && e.quirks.Clipping && y+i >= h {
+				collided = true
+				sprite = 0
+			}
+			for j := 0; j < cols; j++ {
+				if (sprite & (0x8000 >> j)) != 0 {
+					px, py := x+j, y+i
+					if px >= w || py >= h {
+						if e.quirks.Clipping {
+							continue
+						}
+						px, py = px%w, py%h
+					}
+					if e.display.toggle(px, py, plane) {
+						collided = true
+					}
 				}
-				if e.display[x+j][y+i] == 1 {
+			}
+			if collided {
+				if countRows {
+					e.v[0xF]++
+				} else {
 					e.v[0xF] = 1
 				}
-				e.display[x+j][y+i] ^= 1
 			}
 		}
 	}
+	return nil
 }
 
 type SetRegister struct {
 	BaseInstruction
 }
 
-func (s SetRegister) Execute(e *Chip8Emulator) {
+func (s SetRegister) Execute(e *Chip8Emulator) error {
 	e.v[s.x] = e.v[s.y]
+	return nil
 }
 
 type BinaryOrRegister struct {
 	BaseInstruction
 }
 
-func (b BinaryOrRegister) Execute(e *Chip8Emulator) {
+func (b BinaryOrRegister) Execute(e *Chip8Emulator) error {
 	e.v[b.x] |= e.v[b.y]
-	e.v[0xF] = 0
+	if e.quirks.VfReset {
+		e.v[0xF] = 0
+	}
+	return nil
 }
 
 type BinaryAndRegister struct {
 	BaseInstruction
 }
 
-func (b BinaryAndRegister) Execute(e *Chip8Emulator) {
+func (b BinaryAndRegister) Execute(e *Chip8Emulator) error {
 	e.v[b.x] &= e.v[b.y]
-	e.v[0xF] = 0
+	if e.quirks.VfReset {
+		e.v[0xF] = 0
+	}
+	return nil
 }
 
 type BinaryXorRegister struct {
 	BaseInstruction
 }
 
-func (b BinaryXorRegister) Execute(e *Chip8Emulator) {
+func (b BinaryXorRegister) Execute(e *Chip8Emulator) error {
 	e.v[b.x] ^= e.v[b.y]
-	e.v[0xF] = 0
+	if e.quirks.VfReset {
+		e.v[0xF] = 0
+	}
+	return nil
 }
 
 type AddRegister struct {
 	BaseInstruction
 }
 
-func (a AddRegister) Execute(e *Chip8Emulator) {
+func (a AddRegister) Execute(e *Chip8Emulator) error {
 	c := 0
 	if int(e.v[a.x])+int(e.v[a.y]) > 255 {
 		c = 1
 	}
 	e.v[a.x] += e.v[a.y]
 	e.v[0xF] = uint8(c)
+	return nil
 }
 
 type SubtractRegisterXY struct {
 	BaseInstruction
 }
 
-func (s SubtractRegisterXY) Execute(e *Chip8Emulator) {
+func (s SubtractRegisterXY) Execute(e *Chip8Emulator) error {
 	c := 1
 	if e.v[s.y] > e.v[s.x] {
 		c = 0
 	}
 	e.v[s.x] -= e.v[s.y]
 	e.v[0xF] = uint8(c)
+	return nil
 }
 
 type SubtractRegisterYX struct {
 	BaseInstruction
 }
 
-func (s SubtractRegisterYX) Execute(e *Chip8Emulator) {
+func (s SubtractRegisterYX) Execute(e *Chip8Emulator) error {
 	c := 1
 	if e.v[s.x] > e.v[s.y] {
 		c = 0
 	}
 	e.v[s.x] = e.v[s.y] - e.v[s.x]
 	e.v[0xF] = uint8(c)
+	return nil
 }
 
 type AddRegisterXY struct {
 	BaseInstruction
 }
 
-func (a AddRegisterXY) Execute(e *Chip8Emulator) {
+func (a AddRegisterXY) Execute(e *Chip8Emulator) error {
 	c := 0
 	if int(e.v[a.x])+int(e.v[a.y]) > 255 {
 		c = 1
 	}
 	e.v[a.x] += e.v[a.y]
 	e.v[0xF] = uint8(c)
+	return nil
 }
 
 type ShiftRight struct {
 	BaseInstruction
 }
 
-func (s ShiftRight) Execute(e *Chip8Emulator) {
-	c := e.v[s.x] & 0x01
-	e.v[s.x] = e.v[s.y] >> 1
+func (s ShiftRight) Execute(e *Chip8Emulator) error {
+	src := e.v[s.y]
+	if e.quirks.Shifting {
+		src = e.v[s.x]
+	}
+	c := src & 0x01
+	e.v[s.x] = src >> 1
 	e.v[0xF] = uint8(c)
+	return nil
 }
 
 type ShiftLeft struct {
 	BaseInstruction
 }
 
-func (s ShiftLeft) Execute(e *Chip8Emulator) {
-	c := e.v[s.x] >> 7
-	e.v[s.x] = e.v[s.y] << 1
+func (s ShiftLeft) Execute(e *Chip8Emulator) error {
+	src := e.v[s.y]
+	if e.quirks.Shifting {
+		src = e.v[s.x]
+	}
+	c := src >> 7
+	e.v[s.x] = src << 1
 	e.v[0xF] = uint8(c)
+	return nil
 }
 
 type SkipIfKeyPressed struct {
 	BaseInstruction
 }
 
-func (s SkipIfKeyPressed) Execute(e *Chip8Emulator) {
-	if e.keyState.IsKeyPressed(e.v[s.x]) {
-		e.pc += 2
+func (s SkipIfKeyPressed) Execute(e *Chip8Emulator) error {
+	if e.keyState.IsKeyPressed(e.v[s.x] & 0xF) {
+		e.skip()
 	}
+	return nil
 }
 
 type SkipIfKeyNotPressed struct {
 	BaseInstruction
 }
 
-func (s SkipIfKeyNotPressed) Execute(e *Chip8Emulator) {
-	if !e.keyState.IsKeyPressed(e.v[s.x]) {
-		e.pc += 2
+func (s SkipIfKeyNotPressed) Execute(e *Chip8Emulator) error {
+	if !e.keyState.IsKeyPressed(e.v[s.x] & 0xF) {
+		e.skip()
 	}
+	return nil
 }
 
 type SetRegisterWithDelayTimer struct {
 	BaseInstruction
 }
 
-func (s SetRegisterWithDelayTimer) Execute(e *Chip8Emulator) {
+func (s SetRegisterWithDelayTimer) Execute(e *Chip8Emulator) error {
 	e.v[s.x] = e.delayTimer.GetTimer()
+	return nil
 }
 
 type SetDelayTimer struct {
 	BaseInstruction
 }
 
-func (s SetDelayTimer) Execute(e *Chip8Emulator) {
+func (s SetDelayTimer) Execute(e *Chip8Emulator) error {
 	e.delayTimer.SetTimer(e.v[s.x])
+	return nil
 }
 
 type SetSoundTimer struct {
 	BaseInstruction
 }
 
-func (s SetSoundTimer) Execute(e *Chip8Emulator) {
+func (s SetSoundTimer) Execute(e *Chip8Emulator) error {
 	e.soundTimer.SetTimer(e.v[s.x], e.hooks.PlaySound)
+	return nil
 }
 
 type AddRegisterToIndex struct {
 	BaseInstruction
 }
 
-func (a AddRegisterToIndex) Execute(e *Chip8Emulator) {
+func (a AddRegisterToIndex) Execute(e *Chip8Emulator) error {
 	e.i += uint16(e.v[a.x])
+	return nil
 }
 
 type SetIndexToSprite struct {
 	BaseInstruction
 }
 
-func (s SetIndexToSprite) Execute(e *Chip8Emulator) {
-	e.i = uint16(e.v[s.x]) * 5
+func (s SetIndexToSprite) Execute(e *Chip8Emulator) error {
+	e.i = uint16(e.v[s.x]&0xF) * 5
+	return nil
+}
+
+type LongSetIndex struct {
+	BaseInstruction
+}
+
+func (l LongSetIndex) Execute(e *Chip8Emulator) error {
+	hi, err := e.readMemory(int(e.pc))
+	if err != nil {
+		return err
+	}
+	lo, err := e.readMemory(int(e.pc) + 1)
+	if err != nil {
+		return err
+	}
+	e.i = uint16(hi)<<8 | uint16(lo)
+	e.pc += 2
+	return nil
+}
+
+type SelectPlanes struct {
+	BaseInstruction
+}
+
+func (s SelectPlanes) Execute(e *Chip8Emulator) error {
+	e.planes = s.x & ALL_PLANES
+	return nil
+}
+
+type LoadAudioPattern struct {
+	BaseInstruction
+}
+
+func (l LoadAudioPattern) Execute(e *Chip8Emulator) error {
+	pattern := make([]uint8, AUDIO_PATTERN_SIZE)
+	for i := range pattern {
+		data, err := e.readMemory(int(e.i) + i)
+		if err != nil {
+			return err
+		}
+		pattern[i] = data
+	}
+	e.setAudio(pattern, e.pitch)
+	return nil
+}
+
+type SetPitch struct {
+	BaseInstruction
+}
+
+func (s SetPitch) Execute(e *Chip8Emulator) error {
+	e.setAudio(e.audioPattern, e.v[s.x])
+	return nil
+}
+
+type SetIndexToBigSprite struct {
+	BaseInstruction
+}
+
+func (s SetIndexToBigSprite) Execute(e *Chip8Emulator) error {
+	e.i = BIG_FONT_ADDRESS + uint16(e.v[s.x]&0xF)*10
+	return nil
 }
 
 type StoreBCD struct {
 	BaseInstruction
 }
 
-func (s StoreBCD) Execute(e *Chip8Emulator) {
-	e.memory[e.i] = e.v[s.x] / 100
-	e.memory[e.i+1] = (e.v[s.x] / 10) % 10
-	e.memory[e.i+2] = e.v[s.x] % 10
+func (s StoreBCD) Execute(e *Chip8Emulator) error {
+	digits := []uint8{e.v[s.x] / 100, (e.v[s.x] / 10) % 10, e.v[s.x] % 10}
+	for i, d := range digits {
+		if err := e.writeMemory(int(e.i)+i, d); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 type StoreRegisters struct {
 	BaseInstruction
 }
 
-func (s StoreRegisters) Execute(e *Chip8Emulator) {
+func (s StoreRegisters) Execute(e *Chip8Emulator) error {
 	for i := 0; i <= int(s.x); i++ {
-		e.memory[e.i] = e.v[i]
-		e.i++
+		if err := e.writeMemory(int(e.i)+i, e.v[i]); err != nil {
+			return err
+		}
+	}
+	if e.quirks.Memory {
+		e.i += uint16(s.x) + 1
 	}
+	return nil
 }
 
 type LoadRegisters struct {
 	BaseInstruction
 }
 
-func (l LoadRegisters) Execute(e *Chip8Emulator) {
+func (l LoadRegisters) Execute(e *Chip8Emulator) error {
+	for i := 0; i <= int(l.x); i++ {
+		data, err := e.readMemory(int(e.i) + i)
+		if err != nil {
+			return err
+		}
+		e.v[i] = data
+	}
+	if e.quirks.Memory {
+		e.i += uint16(l.x) + 1
+	}
+	return nil
+}
+
+// registerRange returns the registers between x and y inclusive, in the
+// order 5XY2 and 5XY3 visit them.
+func registerRange(x, y uint8) []uint8 {
+	var regs []uint8
+	if x <= y {
+		for r := x; r <= y; r++ {
+			regs = append(regs, r)
+		}
+	} else {
+		for r := int(x); r >= int(y); r-- {
+			regs = append(regs, uint8(r))
+		}
+	}
+	return regs
+}
+
+type SaveRegisterRange struct {
+	BaseInstruction
+}
+
+func (s SaveRegisterRange) Execute(e *Chip8Emulator) error {
+	for i, r := range registerRange(s.x, s.y) {
+		if err := e.writeMemory(int(e.i)+i, e.v[r]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type LoadRegisterRange struct {
+	BaseInstruction
+}
+
+func (l LoadRegisterRange) Execute(e *Chip8Emulator) error {
+	for i, r := range registerRange(l.x, l.y) {
+		data, err := e.readMemory(int(e.i) + i)
+		if err != nil {
+			return err
+		}
+		e.v[r] = data
+	}
+	return nil
+}
+
+type StoreFlags struct {
+	BaseInstruction
+}
+
+func (s StoreFlags) Execute(e *Chip8Emulator) error {
+	for i := 0; i <= int(s.x); i++ {
+		e.rpl[i] = e.v[i]
+	}
+	return nil
+}
+
+type LoadFlags struct {
+	BaseInstruction
+}
+
+func (l LoadFlags) Execute(e *Chip8Emulator) error {
 	for i := 0; i <= int(l.x); i++ {
-		e.v[i] = e.memory[e.i]
-		e.i++
+		e.v[i] = e.rpl[i]
 	}
+	return nil
 }
 
 type WaitForKey struct {
 	BaseInstruction
 }
 
-func (w WaitForKey) Execute(e *Chip8Emulator) {
+func (w WaitForKey) Execute(e *Chip8Emulator) error {
 	lastKey := e.keyState.GetLastKeyReleased()
 	if lastKey < 0xFF {
 		e.v[w.x] = lastKey
 	} else {
 		e.pc -= 2
 	}
+	return nil
 }
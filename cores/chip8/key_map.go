@@ -0,0 +1,10 @@
+package chip8
+
+// DefaultKeyMap lays the hex keypad of the COSMAC VIP out over the left
+// hand side of a QWERTY keyboard.
+var DefaultKeyMap = map[string]uint8{
+	"1": 0x1, "2": 0x2, "3": 0x3, "4": 0xC,
+	"q": 0x4, "w": 0x5, "e": 0x6, "r": 0xD,
+	"a": 0x7, "s": 0x8, "d": 0x9, "f": 0xE,
+	"z": 0xA, "x": 0x0, "c": 0xB, "v": 0xF,
+}
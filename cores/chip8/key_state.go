@@ -12,10 +12,16 @@ func NewKeyState() *KeyState {
 }
 
 func (k *KeyState) IsKeyPressed(key uint8) bool {
+	if key >= NUM_KEYS {
+		return false
+	}
 	return k.keys[key]
 }
 
 func (k *KeyState) SetKeyState(key uint8, state bool) {
+	if key >= NUM_KEYS {
+		return
+	}
 	k.keys[key] = state
 	if !state {
 		k.lastKeyReleased = key
@@ -1,5 +1,10 @@
 package chip8
 
+import (
+	"crypto/sha256"
+	"math/rand"
+)
+
 type Message interface {
 	HandleMessage(e *Chip8Emulator)
 	IsCustom() bool
@@ -45,6 +50,8 @@ type SwapRomMessage struct {
 func (m SwapRomMessage) HandleMessage(e *Chip8Emulator) {
 	e.loadRom(m.rom)
 	e.reset()
+	e.rewind.Reset()
+	e.applyRomMetadata()
 }
 
 type IpfMessage struct {
@@ -56,6 +63,72 @@ func (m IpfMessage) HandleMessage(e *Chip8Emulator) {
 	e.ipf = m.ipf
 }
 
+type TimingMessage struct {
+	BaseMessage
+	timing Timing
+}
+
+func (m TimingMessage) HandleMessage(e *Chip8Emulator) {
+	e.timing = m.timing
+	e.vip = vipTiming{}
+}
+
+type DeflickerMessage struct {
+	BaseMessage
+	deflicker Deflicker
+}
+
+func (m DeflickerMessage) HandleMessage(e *Chip8Emulator) {
+	e.deflicker = m.deflicker
+	e.flicker = deflickerState{}
+	// Build the next frame afresh, whatever the display.
+	e.frame = nil
+}
+
+type PaletteMessage struct {
+	BaseMessage
+	palette Palette
+}
+
+func (m PaletteMessage) HandleMessage(e *Chip8Emulator) {
+	e.setPalette(m.palette)
+}
+
+type RomDatabaseMessage struct {
+	BaseMessage
+	db RomDatabase
+}
+
+func (m RomDatabaseMessage) HandleMessage(e *Chip8Emulator) {
+	e.romDatabase = m.db
+}
+
+type AttachPaletteMessage struct {
+	BaseMessage
+	palette Palette
+}
+
+func (m AttachPaletteMessage) HandleMessage(e *Chip8Emulator) {
+	if e.romDatabase == nil {
+		e.romDatabase = make(RomDatabase)
+	}
+	rom := e.GetRom()
+	metadata, _ := e.romDatabase.Lookup(rom)
+	palette := m.palette
+	metadata.Palette = &palette
+	e.romDatabase.Add(rom, metadata)
+	e.setPalette(palette)
+}
+
+type QuirksMessage struct {
+	BaseMessage
+	quirks Quirks
+}
+
+func (m QuirksMessage) HandleMessage(e *Chip8Emulator) {
+	e.setQuirks(m.quirks)
+}
+
 type SetMemoryMessage struct {
 	BaseMessage
 	address uint16
@@ -63,9 +136,25 @@ type SetMemoryMessage struct {
 }
 
 func (m SetMemoryMessage) HandleMessage(e *Chip8Emulator) {
+	if int(m.address) >= len(e.memory) {
+		return
+	}
 	copy(e.memory[m.address:], m.data)
 }
 
+type PokeMessage struct {
+	BaseMessage
+	values map[uint16]uint8
+}
+
+func (m PokeMessage) HandleMessage(e *Chip8Emulator) {
+	for address, value := range m.values {
+		if int(address) < len(e.memory) {
+			e.memory[address] = value
+		}
+	}
+}
+
 type KeyStateMessage struct {
 	BaseMessage
 	key   uint8
@@ -73,5 +162,164 @@ type KeyStateMessage struct {
 }
 
 func (m KeyStateMessage) HandleMessage(e *Chip8Emulator) {
-	e.keyState.SetKeyState(m.key, m.state)
+	e.setKeyState(m.key, m.state)
+}
+
+type LoadStateMessage struct {
+	BaseMessage
+	state *machineState
+}
+
+// HandleMessage keeps the machine as it is if the state cannot be restored.
+// LoadState already validated it, so that only happens for states queued
+// directly.
+func (m LoadStateMessage) HandleMessage(e *Chip8Emulator) {
+	_ = e.restoreState(m.state)
+}
+
+type RewindMessage struct {
+	BaseMessage
+	frames int
+}
+
+func (m RewindMessage) HandleMessage(e *Chip8Emulator) {
+	e.rewindFrames(m.frames)
+}
+
+type RewindingMessage struct {
+	BaseMessage
+	rewinding bool
+}
+
+func (m RewindingMessage) HandleMessage(e *Chip8Emulator) {
+	e.rewinding = m.rewinding
+}
+
+type RewindBudgetMessage struct {
+	BaseMessage
+	budget int
+}
+
+func (m RewindBudgetMessage) HandleMessage(e *Chip8Emulator) {
+	e.rewind.SetBudget(m.budget)
+}
+
+type BreakpointMessage struct {
+	BaseMessage
+	breakpoint Breakpoint
+	remove     bool
+}
+
+func (m BreakpointMessage) HandleMessage(e *Chip8Emulator) {
+	if m.remove {
+		delete(e.debugger.breakpoints, m.breakpoint.Address)
+		return
+	}
+	if e.debugger.breakpoints == nil {
+		e.debugger.breakpoints = make(map[uint16]Breakpoint)
+	}
+	e.debugger.breakpoints[m.breakpoint.Address] = m.breakpoint
+}
+
+type ClearBreakpointsMessage struct {
+	BaseMessage
+}
+
+func (m ClearBreakpointsMessage) HandleMessage(e *Chip8Emulator) {
+	e.debugger.breakpoints = nil
+}
+
+type StepMessage struct {
+	BaseMessage
+	mode  stepMode
+	frame uint64
+}
+
+func (m StepMessage) HandleMessage(e *Chip8Emulator) {
+	switch m.mode {
+	case stepOver:
+		e.stepOver()
+	case stepOut:
+		e.stepOut()
+	case stepFrame:
+		e.runToFrame(m.frame)
+	default:
+		e.step()
+	}
+}
+
+type WatchpointMessage struct {
+	BaseMessage
+	watchpoint Watchpoint
+	remove     bool
+}
+
+func (m WatchpointMessage) HandleMessage(e *Chip8Emulator) {
+	var watchpoints []Watchpoint
+	for _, w := range e.debugger.watchpoints {
+		if w.Start != m.watchpoint.Start || w.End != m.watchpoint.End {
+			watchpoints = append(watchpoints, w)
+		}
+	}
+	if !m.remove {
+		watchpoints = append(watchpoints, m.watchpoint)
+	}
+	e.debugger.watchpoints = watchpoints
+}
+
+type ClearWatchpointsMessage struct {
+	BaseMessage
+}
+
+func (m ClearWatchpointsMessage) HandleMessage(e *Chip8Emulator) {
+	e.debugger.watchpoints = nil
+}
+
+type TracerMessage struct {
+	BaseMessage
+	tracer *Tracer
+}
+
+func (m TracerMessage) HandleMessage(e *Chip8Emulator) {
+	e.tracer = m.tracer
+}
+
+type SeedMessage struct {
+	BaseMessage
+	seed int64
+}
+
+func (m SeedMessage) HandleMessage(e *Chip8Emulator) {
+	e.seed = m.seed
+	e.rng = rand.New(rand.NewSource(m.seed))
+}
+
+type RecordMessage struct {
+	BaseMessage
+}
+
+func (m RecordMessage) HandleMessage(e *Chip8Emulator) {
+	e.restart(append([]byte(nil), e.GetRom()...))
+	e.movie.recording = &Movie{
+		RomHash: sha256.Sum256(e.GetRom()),
+		Quirks:  e.quirks,
+		Seed:    e.seed,
+		IPF:     uint32(e.ipf),
+		Timing:  e.timing,
+	}
+}
+
+type PlayMovieMessage struct {
+	BaseMessage
+	movie *Movie
+	rom   []byte
+}
+
+func (m PlayMovieMessage) HandleMessage(e *Chip8Emulator) {
+	e.setQuirks(m.movie.Quirks)
+	e.ipf = int(m.movie.IPF)
+	e.timing = m.movie.Timing
+	e.seed = m.movie.Seed
+	e.restart(m.rom)
+	e.movie.playing = m.movie
 }
@@ -0,0 +1,185 @@
+package chip8
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+const MOVIE_VERSION = 3
+
+var movieMagic = [4]byte{'C', 'S', 'M', 'V'}
+
+var (
+	ErrInvalidMovie = errors.New("invalid movie")
+	ErrMovieVersion = errors.New("unsupported movie version")
+	ErrMovieRom     = errors.New("movie was recorded with a different ROM")
+)
+
+// InputEvent is a key state change. Frame counts the frames the emulator ran
+// since the recording started, that is the drawCount delta without the frames
+// spent paused, and the event applies before that frame's instructions.
+type InputEvent struct {
+	Frame uint64
+	Key   uint8
+	State bool
+}
+
+// Movie is everything needed to replay a run frame for frame: the ROM it was
+// recorded with, the machine setup and the input.
+type Movie struct {
+	RomHash [sha256.Size]byte
+	Quirks  Quirks
+	Seed    int64
+	IPF     uint32
+	Timing  Timing
+	Events  []InputEvent
+}
+
+// A movie file is a header, the movie and a CRC-32 of everything before it.
+// Every field is big endian.
+type movieHeader struct {
+	Magic   [4]byte
+	Version uint16
+	RomHash [sha256.Size]byte
+	Quirks  Quirks
+	Seed    int64
+	IPF     uint32
+	Timing  Timing
+	Events  uint32
+}
+
+func (m *Movie) Marshal() []byte {
+	var buf bytes.Buffer
+	header := movieHeader{
+		Magic:   movieMagic,
+		Version: MOVIE_VERSION,
+		RomHash: m.RomHash,
+		Quirks:  m.Quirks,
+		Seed:    m.Seed,
+		IPF:     m.IPF,
+		Timing:  m.Timing,
+		Events:  uint32(len(m.Events)),
+	}
+	binary.Write(&buf, binary.BigEndian, &header)
+	binary.Write(&buf, binary.BigEndian, m.Events)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(buf.Bytes()))
+	return buf.Bytes()
+}
+
+func UnmarshalMovie(data []byte) (*Movie, error) {
+	var header movieHeader
+	headerSize := binary.Size(header)
+	if len(data) < headerSize+4 {
+		return nil, ErrInvalidMovie
+	}
+	body := data[:len(data)-4]
+	if binary.BigEndian.Uint32(data[len(data)-4:]) != crc32.ChecksumIEEE(body) {
+		return nil, ErrInvalidMovie
+	}
+
+	r := bytes.NewReader(body)
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil || header.Magic != movieMagic {
+		return nil, ErrInvalidMovie
+	}
+	if header.Version != MOVIE_VERSION {
+		return nil, ErrMovieVersion
+	}
+	if int(header.Events)*binary.Size(InputEvent{}) != r.Len() {
+		return nil, ErrInvalidMovie
+	}
+
+	m := &Movie{
+		RomHash: header.RomHash,
+		Quirks:  header.Quirks,
+		Seed:    header.Seed,
+		IPF:     header.IPF,
+		Timing:  header.Timing,
+		Events:  make([]InputEvent, header.Events),
+	}
+	if err := binary.Read(r, binary.BigEndian, m.Events); err != nil {
+		return nil, ErrInvalidMovie
+	}
+	return m, nil
+}
+
+// movieState is the recording or playback in progress, if any.
+type movieState struct {
+	recording *Movie
+	playing   *Movie
+	frame     uint64
+	next      int
+}
+
+// restart loads rom and resets the machine so recording and playback start
+// from the same state.
+func (e *Chip8Emulator) restart(rom []byte) {
+	e.loadRom(rom)
+	e.reset()
+	e.rewind.Reset()
+	e.movie = movieState{}
+}
+
+// applyMovieInput feeds the input of the coming frame during playback, and
+// ends playback once every event was applied.
+func (e *Chip8Emulator) applyMovieInput() {
+	m := &e.movie
+	if m.playing == nil {
+		return
+	}
+	for m.next < len(m.playing.Events) && m.playing.Events[m.next].Frame <= m.frame {
+		event := m.playing.Events[m.next]
+		e.keyState.SetKeyState(event.Key, event.State)
+		m.next++
+	}
+	if m.next == len(m.playing.Events) {
+		m.playing = nil
+	}
+}
+
+// setKeyState applies a key change from the frontend, recording it if a
+// recording is running. Live input is ignored during playback.
+func (e *Chip8Emulator) setKeyState(key uint8, state bool) {
+	m := &e.movie
+	if m.playing != nil {
+		return
+	}
+	if m.recording != nil && key < NUM_KEYS && e.keyState.IsKeyPressed(key) != state {
+		m.recording.Events = append(m.recording.Events, InputEvent{Frame: m.frame, Key: key, State: state})
+	}
+	e.keyState.SetKeyState(key, state)
+}
+
+// StartRecording restarts the loaded ROM and records its input until
+// StopRecording.
+func (e *Chip8Emulator) StartRecording() {
+	e.EnqueueMessage(RecordMessage{})
+}
+
+// StopRecording ends the recording and returns it, or nil if none was
+// running. It should be called between frames, like SaveState.
+func (e *Chip8Emulator) StopRecording() *Movie {
+	m := e.movie.recording
+	e.movie.recording = nil
+	return m
+}
+
+func (e *Chip8Emulator) IsRecording() bool {
+	return e.movie.recording != nil
+}
+
+// PlayMovie loads rom with the setup of the movie and replays its input. Live
+// input is ignored until the last event was played.
+func (e *Chip8Emulator) PlayMovie(m *Movie, rom []byte) error {
+	if sha256.Sum256(rom) != m.RomHash {
+		return ErrMovieRom
+	}
+	e.EnqueueMessage(PlayMovieMessage{movie: m, rom: rom})
+	return nil
+}
+
+func (e *Chip8Emulator) IsPlayingMovie() bool {
+	return e.movie.playing != nil
+}
@@ -0,0 +1,75 @@
+package chip8
+
+import (
+	"crypto/sha256"
+	"testing"
+)
+
+// movieRom keeps adding random numbers to v1 until key 5 is pressed and
+// then halts. The final v1 depends on the seed and the input timing.
+var movieRom = []byte{
+	0x63, 0x05, // 0x200: v3 := 5
+	0xC2, 0xFF, // 0x202: v2 := random 0xFF
+	0x81, 0x24, // 0x204: v1 += v2
+	0xE3, 0xA1, // 0x206: if v3 key then
+	0x00, 0xFD, // 0x208: exit
+	0x12, 0x02, // 0x20A: jump 0x202
+}
+
+func runMovieFrames(e *Chip8Emulator, frames int, input map[int][2]uint8) {
+	for frame := 0; frame < frames; frame++ {
+		if k, ok := input[frame]; ok {
+			e.SetKeyState(k[0], k[1])
+		}
+		e.Cycle(0)
+	}
+}
+
+func TestMovieRecordAndPlay(t *testing.T) {
+	e := NewChip8Emulator(Hooks{}, QuirksCosmacVIP)
+	e.SetSeed(42)
+	e.SwapROM(movieRom)
+	e.Resume()
+	e.StartRecording()
+	runMovieFrames(e, 30, map[int][2]uint8{10: {5, 1}, 20: {5, 0}})
+
+	movie := e.StopRecording()
+	if movie == nil || len(movie.Events) != 2 || movie.Seed != 42 {
+		t.Fatalf("movie = %+v", movie)
+	}
+	if movie.RomHash != sha256.Sum256(movieRom) {
+		t.Errorf("movie has the wrong ROM hash")
+	}
+	want := e.GetV()
+
+	data := movie.Marshal()
+	loaded, err := UnmarshalMovie(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewChip8Emulator(Hooks{}, QuirksSChipModern)
+	if err := p.PlayMovie(loaded, []byte{0x12, 0x00}); err != ErrMovieRom {
+		t.Errorf("PlayMovie with another ROM = %v, want ErrMovieRom", err)
+	}
+	if err := p.PlayMovie(loaded, movieRom); err != nil {
+		t.Fatal(err)
+	}
+	p.Resume()
+	// Live input during playback is ignored.
+	runMovieFrames(p, 30, map[int][2]uint8{5: {5, 1}, 6: {5, 0}})
+	if !p.IsPaused() || p.GetPc() != 0x208 {
+		t.Errorf("playback did not exit at the recorded frame")
+	}
+	if got := p.GetV(); got != want {
+		t.Errorf("playback registers = %v, want %v", got, want)
+	}
+	if p.GetQuirks() != QuirksCosmacVIP {
+		t.Errorf("playback did not use the recorded quirks")
+	}
+
+	data[len(data)-1] ^= 0xFF
+	if _, err := UnmarshalMovie(data); err != ErrInvalidMovie {
+		t.Errorf("UnmarshalMovie of a corrupt movie = %v, want ErrInvalidMovie", err)
+	}
+}
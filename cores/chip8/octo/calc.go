@@ -0,0 +1,138 @@
+package octo
+
+import "math"
+
+var unaryOperators = map[string]func(float64) float64{
+	"-":     func(x float64) float64 { return -x },
+	"~":     func(x float64) float64 { return float64(^int(x)) },
+	"!":     func(x float64) float64 { return boolValue(x == 0) },
+	"sin":   math.Sin,
+	"cos":   math.Cos,
+	"tan":   math.Tan,
+	"exp":   math.Exp,
+	"log":   math.Log,
+	"abs":   math.Abs,
+	"sqrt":  math.Sqrt,
+	"ceil":  math.Ceil,
+	"floor": math.Floor,
+	"sign": func(x float64) float64 {
+		switch {
+		case x > 0:
+			return 1
+		case x < 0:
+			return -1
+		}
+		return 0
+	},
+}
+
+var binaryOperators = map[string]func(x, y float64) float64{
+	"-":   func(x, y float64) float64 { return x - y },
+	"+":   func(x, y float64) float64 { return x + y },
+	"*":   func(x, y float64) float64 { return x * y },
+	"/":   func(x, y float64) float64 { return x / y },
+	"%":   math.Mod,
+	"&":   func(x, y float64) float64 { return float64(int(x) & int(y)) },
+	"|":   func(x, y float64) float64 { return float64(int(x) | int(y)) },
+	"^":   func(x, y float64) float64 { return float64(int(x) ^ int(y)) },
+	"<<":  func(x, y float64) float64 { return float64(int(x) << uint(y)) },
+	">>":  func(x, y float64) float64 { return float64(int(x) >> uint(y)) },
+	"pow": math.Pow,
+	"min": math.Min,
+	"max": math.Max,
+	"<":   func(x, y float64) float64 { return boolValue(x < y) },
+	">":   func(x, y float64) float64 { return boolValue(x > y) },
+	"<=":  func(x, y float64) float64 { return boolValue(x <= y) },
+	">=":  func(x, y float64) float64 { return boolValue(x >= y) },
+	"==":  func(x, y float64) float64 { return boolValue(x == y) },
+	"!=":  func(x, y float64) float64 { return boolValue(x != y) },
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// calcBlock evaluates a braced :calc expression. As in Octo, operators have
+// no precedence and are evaluated right to left; use parentheses to group.
+func (a *assembler) calcBlock() (float64, error) {
+	if err := a.expect("{"); err != nil {
+		return 0, err
+	}
+	v, err := a.calcExpression()
+	if err != nil {
+		return 0, err
+	}
+	return v, a.expect("}")
+}
+
+func (a *assembler) calcExpression() (float64, error) {
+	left, err := a.calcTerm()
+	if err != nil {
+		return 0, err
+	}
+	if p := a.peek(); p == ")" || p == "}" {
+		return left, nil
+	}
+	op, err := a.next()
+	if err != nil {
+		return 0, err
+	}
+	f, ok := binaryOperators[op]
+	if !ok {
+		return 0, a.errorf("unknown operator %s", op)
+	}
+	right, err := a.calcExpression()
+	if err != nil {
+		return 0, err
+	}
+	return f(left, right), nil
+}
+
+func (a *assembler) calcTerm() (float64, error) {
+	t, err := a.next()
+	if err != nil {
+		return 0, err
+	}
+	if t == "(" {
+		v, err := a.calcExpression()
+		if err != nil {
+			return 0, err
+		}
+		return v, a.expect(")")
+	}
+	if f, ok := unaryOperators[t]; ok {
+		v, err := a.calcTerm()
+		if err != nil {
+			return 0, err
+		}
+		return f(v), nil
+	}
+
+	switch t {
+	case "@":
+		v, err := a.calcTerm()
+		if err != nil {
+			return 0, err
+		}
+		if v < 0 || int(v) >= len(a.memory) {
+			return 0, a.errorf("@ address 0x%X is out of range", int(v))
+		}
+		return float64(a.memory[int(v)]), nil
+	case "HERE":
+		return float64(a.here), nil
+	case "PI":
+		return math.Pi, nil
+	case "E":
+		return math.E, nil
+	}
+	if c, ok := a.constants[t]; ok {
+		return c, nil
+	}
+	if v, ok := a.value(t); ok {
+		return float64(v), nil
+	}
+	return 0, a.errorf("undefined name %q", t)
+}
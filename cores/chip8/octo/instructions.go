@@ -0,0 +1,559 @@
+package octo
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// reserved words can never be labels, so finding one in statement position
+// is reported instead of being assembled as a call.
+var reserved = map[string]bool{
+	"then": true, "begin": true, "key": true, "-key": true, "random": true,
+	"hex": true, "bighex": true, "long": true, "-": true, "{": true, "}": true,
+	"(": true, ")": true, ":=": true, "+=": true, "-=": true, "=-": true,
+	"|=": true, "&=": true, "^=": true, ">>=": true, "<<=": true,
+	"==": true, "!=": true, "<": true, ">": true, "<=": true, ">=": true,
+}
+
+func parseNumber(t string) (int, bool) {
+	n, err := strconv.ParseInt(t, 0, 32)
+	if err != nil {
+		return 0, false
+	}
+	return int(n), true
+}
+
+func parseRegister(t string) (uint8, bool) {
+	t = strings.ToLower(t)
+	if len(t) != 2 || t[0] != 'v' {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(t[1:], 16, 8)
+	if err != nil {
+		return 0, false
+	}
+	return uint8(n), true
+}
+
+// register resolves a register name or alias.
+func (a *assembler) register(t string) (uint8, bool) {
+	if r, ok := a.aliases[t]; ok {
+		return r, true
+	}
+	return parseRegister(t)
+}
+
+func (a *assembler) nextRegister() (uint8, error) {
+	t, err := a.next()
+	if err != nil {
+		return 0, err
+	}
+	r, ok := a.register(t)
+	if !ok {
+		return 0, a.errorf("expected a register, got %q", t)
+	}
+	return r, nil
+}
+
+// value resolves a number, constant or already defined label.
+func (a *assembler) value(t string) (int, bool) {
+	if n, ok := parseNumber(t); ok {
+		return n, true
+	}
+	if c, ok := a.constants[t]; ok {
+		return int(math.Floor(c)), true
+	}
+	if l, ok := a.labels[t]; ok {
+		return int(l), true
+	}
+	return 0, false
+}
+
+func (a *assembler) nextValue() (int, error) {
+	t, err := a.next()
+	if err != nil {
+		return 0, err
+	}
+	v, ok := a.value(t)
+	if !ok {
+		return 0, a.errorf("undefined name %q", t)
+	}
+	return v, nil
+}
+
+func (a *assembler) byteValue(v int) (byte, error) {
+	if v < -128 || v > 255 {
+		return 0, a.errorf("value %d does not fit in a byte", v)
+	}
+	return byte(v), nil
+}
+
+func (a *assembler) nextByte() (uint16, error) {
+	v, err := a.nextValue()
+	if err != nil {
+		return 0, err
+	}
+	b, err := a.byteValue(v)
+	return uint16(b), err
+}
+
+func (a *assembler) nextNibble() (uint16, error) {
+	v, err := a.nextValue()
+	if err != nil {
+		return 0, err
+	}
+	if v < 0 || v > 0xF {
+		return 0, a.errorf("value %d does not fit in a nibble", v)
+	}
+	return uint16(v), nil
+}
+
+// addressOperand reads an address and passes it to emit. Labels that are not
+// defined yet are emitted as zero and patched once assembly is done.
+func (a *assembler) addressOperand(kind fixupKind, nibble uint8, emit func(address int) error) error {
+	t, err := a.next()
+	if err != nil {
+		return err
+	}
+	address, ok := a.value(t)
+	if !ok {
+		if _, isRegister := a.register(t); isRegister || reserved[t] {
+			return a.errorf("expected an address, got %q", t)
+		}
+		a.fixups = append(a.fixups, fixup{
+			kind:    kind,
+			address: a.here,
+			name:    t,
+			line:    a.line,
+			nibble:  nibble,
+		})
+		return emit(0)
+	}
+	limit := 0xFFF
+	if kind == fixupLong || kind == fixupUnpackLong {
+		limit = 0xFFFF
+	}
+	if address < 0 || address > limit {
+		return a.errorf("address 0x%X is out of range", address)
+	}
+	return emit(address)
+}
+
+func (a *assembler) opcodeWithAddress(opcode uint16) error {
+	return a.addressOperand(fixupAddress, 0, func(address int) error {
+		return a.instruction(opcode | uint16(address))
+	})
+}
+
+func (a *assembler) call() error {
+	return a.opcodeWithAddress(0x2000)
+}
+
+// jumpPlaceholder emits a jump whose target is patched by patchJump.
+func (a *assembler) jumpPlaceholder() (int, error) {
+	address := a.here
+	return address, a.instruction(0x1000)
+}
+
+func (a *assembler) patchJump(at int, target int) error {
+	if target > 0xFFF {
+		return a.errorf("jump target 0x%X is out of range", target)
+	}
+	a.memory[at] = 0x10 | byte(target>>8)
+	a.memory[at+1] = byte(target)
+	return nil
+}
+
+func (a *assembler) label() error {
+	name, err := a.name()
+	if err != nil {
+		return err
+	}
+	if name == "main" && a.jumpToMain && a.here == 0x202 {
+		a.jumpToMain = false
+		a.here -= 2
+		a.memory[a.here] = 0
+		if a.size == 0x202 {
+			a.size = a.here
+		}
+	}
+	return a.defineLabel(name, a.here)
+}
+
+func (a *assembler) instructionStatement(t string) error {
+	switch t {
+	case ":":
+		return a.label()
+	case ";", "return":
+		return a.instruction(0x00EE)
+	case "clear":
+		return a.instruction(0x00E0)
+	case "exit":
+		return a.instruction(0x00FD)
+	case "hires":
+		return a.instruction(0x00FF)
+	case "lores":
+		return a.instruction(0x00FE)
+	case "scroll-left":
+		return a.instruction(0x00FC)
+	case "scroll-right":
+		return a.instruction(0x00FB)
+	case "audio":
+		return a.instruction(0xF002)
+	case "scroll-down", "scroll-up", "plane":
+		n, err := a.nextNibble()
+		if err != nil {
+			return err
+		}
+		switch t {
+		case "scroll-down":
+			return a.instruction(0x00C0 | n)
+		case "scroll-up":
+			return a.instruction(0x00D0 | n)
+		}
+		if n > 3 {
+			return a.errorf("plane %d is out of range", n)
+		}
+		return a.instruction(0xF001 | n<<8)
+	case "bcd", "saveflags", "loadflags":
+		x, err := a.nextRegister()
+		if err != nil {
+			return err
+		}
+		opcodes := map[string]uint16{"bcd": 0xF033, "saveflags": 0xF075, "loadflags": 0xF085}
+		return a.instruction(opcodes[t] | uint16(x)<<8)
+	case "save", "load":
+		x, err := a.nextRegister()
+		if err != nil {
+			return err
+		}
+		if a.peek() == "-" {
+			a.next()
+			y, err := a.nextRegister()
+			if err != nil {
+				return err
+			}
+			opcode := uint16(0x5002)
+			if t == "load" {
+				opcode = 0x5003
+			}
+			return a.instruction(opcode | uint16(x)<<8 | uint16(y)<<4)
+		}
+		opcode := uint16(0xF055)
+		if t == "load" {
+			opcode = 0xF065
+		}
+		return a.instruction(opcode | uint16(x)<<8)
+	case "sprite":
+		x, err := a.nextRegister()
+		if err != nil {
+			return err
+		}
+		y, err := a.nextRegister()
+		if err != nil {
+			return err
+		}
+		n, err := a.nextNibble()
+		if err != nil {
+			return err
+		}
+		return a.instruction(0xD000 | uint16(x)<<8 | uint16(y)<<4 | n)
+	case "jump":
+		return a.opcodeWithAddress(0x1000)
+	case "jump0":
+		return a.opcodeWithAddress(0xB000)
+	case "native":
+		return a.opcodeWithAddress(0x0000)
+	case "i":
+		return a.indexStatement()
+	case "delay", "buzzer", "pitch":
+		if err := a.expect(":="); err != nil {
+			return err
+		}
+		x, err := a.nextRegister()
+		if err != nil {
+			return err
+		}
+		opcodes := map[string]uint16{"delay": 0xF015, "buzzer": 0xF018, "pitch": 0xF03A}
+		return a.instruction(opcodes[t] | uint16(x)<<8)
+	case "if", "else", "end", "loop", "while", "again":
+		return a.controlStatement(t)
+	}
+
+	if v, ok := a.value(t); ok {
+		if _, isLabel := a.labels[t]; !isLabel {
+			b, err := a.byteValue(v)
+			if err != nil {
+				return err
+			}
+			return a.emit(b)
+		}
+	}
+	if reserved[t] {
+		return a.errorf("unexpected %q", t)
+	}
+	a.pos--
+	return a.call()
+}
+
+func (a *assembler) indexStatement() error {
+	op, err := a.next()
+	if err != nil {
+		return err
+	}
+	switch op {
+	case "+=":
+		x, err := a.nextRegister()
+		if err != nil {
+			return err
+		}
+		return a.instruction(0xF01E | uint16(x)<<8)
+	case ":=":
+	default:
+		return a.errorf("unknown operator i %s", op)
+	}
+
+	switch a.peek() {
+	case "hex", "bighex":
+		kind, _ := a.next()
+		x, err := a.nextRegister()
+		if err != nil {
+			return err
+		}
+		if kind == "hex" {
+			return a.instruction(0xF029 | uint16(x)<<8)
+		}
+		return a.instruction(0xF030 | uint16(x)<<8)
+	case "long":
+		a.next()
+		if err := a.instruction(0xF000); err != nil {
+			return err
+		}
+		return a.addressOperand(fixupLong, 0, func(address int) error {
+			return a.emit(byte(address>>8), byte(address))
+		})
+	}
+	return a.opcodeWithAddress(0xA000)
+}
+
+func (a *assembler) registerStatement(t string) error {
+	x, _ := a.register(t)
+	op, err := a.next()
+	if err != nil {
+		return err
+	}
+	vx := uint16(x) << 8
+
+	if op == ":=" {
+		switch a.peek() {
+		case "random":
+			a.next()
+			n, err := a.nextByte()
+			if err != nil {
+				return err
+			}
+			return a.instruction(0xC000 | vx | n)
+		case "delay":
+			a.next()
+			return a.instruction(0xF007 | vx)
+		case "key":
+			a.next()
+			return a.instruction(0xF00A | vx)
+		}
+	}
+
+	alu := map[string]uint16{
+		":=": 0x0, "|=": 0x1, "&=": 0x2, "^=": 0x3, "+=": 0x4,
+		"-=": 0x5, ">>=": 0x6, "=-": 0x7, "<<=": 0xE,
+	}
+	n, ok := alu[op]
+	if !ok {
+		return a.errorf("unknown operator %s %s", t, op)
+	}
+	if y, ok := a.register(a.peek()); ok {
+		a.next()
+		return a.instruction(0x8000 | vx | uint16(y)<<4 | n)
+	}
+
+	switch op {
+	case ":=", "+=", "-=":
+	default:
+		return a.errorf("%s needs a register operand", op)
+	}
+	b, err := a.nextByte()
+	if err != nil {
+		return err
+	}
+	switch op {
+	case ":=":
+		return a.instruction(0x6000 | vx | b)
+	case "+=":
+		return a.instruction(0x7000 | vx | b)
+	default:
+		return a.instruction(0x7000 | vx | -b&0xFF)
+	}
+}
+
+// conditional emits code that skips the next instruction when the condition
+// is false, or when it is true if negate is set.
+func (a *assembler) conditional(negate bool) error {
+	x, err := a.nextRegister()
+	if err != nil {
+		return err
+	}
+	op, err := a.next()
+	if err != nil {
+		return err
+	}
+	if negate {
+		negated := map[string]string{
+			"key": "-key", "-key": "key", "==": "!=", "!=": "==",
+			"<": ">=", ">=": "<", ">": "<=", "<=": ">",
+		}
+		if n, ok := negated[op]; ok {
+			op = n
+		}
+	}
+	vx := uint16(x) << 8
+
+	switch op {
+	case "key":
+		return a.instruction(0xE0A1 | vx)
+	case "-key":
+		return a.instruction(0xE09E | vx)
+	case "==", "!=", "<", ">", "<=", ">=":
+	default:
+		return a.errorf("unknown comparison %s", op)
+	}
+
+	y, isRegister := a.register(a.peek())
+	var n uint16
+	if isRegister {
+		a.next()
+	} else if n, err = a.nextByte(); err != nil {
+		return err
+	}
+	vy := uint16(y) << 4
+
+	switch op {
+	case "==":
+		if isRegister {
+			return a.instruction(0x9000 | vx | vy)
+		}
+		return a.instruction(0x4000 | vx | n)
+	case "!=":
+		if isRegister {
+			return a.instruction(0x5000 | vx | vy)
+		}
+		return a.instruction(0x3000 | vx | n)
+	}
+
+	// The ordered comparisons leave vx >= y or y >= vx in vf through a
+	// subtraction and skip on the flag.
+	var code []uint16
+	switch {
+	case (op == "<" || op == ">=") && isRegister:
+		code = []uint16{0x8F00 | vx>>4, 0x8F05 | vy}
+	case op == "<" || op == ">=":
+		code = []uint16{0x6F00 | n, 0x8F07 | vx>>4}
+	case isRegister:
+		code = []uint16{0x8F00 | vy, 0x8F05 | vx>>4}
+	default:
+		code = []uint16{0x6F00 | n, 0x8F05 | vx>>4}
+	}
+	if op == "<" || op == ">" {
+		code = append(code, 0x3F01)
+	} else {
+		code = append(code, 0x3F00)
+	}
+	for _, opcode := range code {
+		if err := a.instruction(opcode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *assembler) controlStatement(t string) error {
+	switch t {
+	case "if":
+		line := a.line
+		if err := a.conditional(false); err != nil {
+			return err
+		}
+		kind, err := a.next()
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case "then":
+			return nil
+		case "begin":
+			jump, err := a.jumpPlaceholder()
+			if err != nil {
+				return err
+			}
+			a.blocks = append(a.blocks, block{line: line, jump: jump})
+			return nil
+		}
+		return a.errorf("expected then or begin, got %q", kind)
+	case "else", "end":
+		if len(a.blocks) == 0 || a.blocks[len(a.blocks)-1].loop {
+			return a.errorf("%s without if", t)
+		}
+		b := &a.blocks[len(a.blocks)-1]
+		if t == "end" {
+			a.blocks = a.blocks[:len(a.blocks)-1]
+			return a.patchJump(b.jump, a.here)
+		}
+		jump, err := a.jumpPlaceholder()
+		if err != nil {
+			return err
+		}
+		if err := a.patchJump(b.jump, a.here); err != nil {
+			return err
+		}
+		b.jump = jump
+		return nil
+	case "loop":
+		a.blocks = append(a.blocks, block{loop: true, line: a.line, start: a.here})
+		return nil
+	case "while":
+		i := len(a.blocks) - 1
+		for i >= 0 && !a.blocks[i].loop {
+			i--
+		}
+		if i < 0 {
+			return a.errorf("while without loop")
+		}
+		if err := a.conditional(true); err != nil {
+			return err
+		}
+		jump, err := a.jumpPlaceholder()
+		if err != nil {
+			return err
+		}
+		a.blocks[i].breaks = append(a.blocks[i].breaks, jump)
+		return nil
+	default:
+		if len(a.blocks) == 0 || !a.blocks[len(a.blocks)-1].loop {
+			return a.errorf("again without loop")
+		}
+		b := a.blocks[len(a.blocks)-1]
+		a.blocks = a.blocks[:len(a.blocks)-1]
+		jump, err := a.jumpPlaceholder()
+		if err != nil {
+			return err
+		}
+		if err := a.patchJump(jump, b.start); err != nil {
+			return err
+		}
+		for _, jump := range b.breaks {
+			if err := a.patchJump(jump, a.here); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
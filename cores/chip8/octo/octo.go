@@ -0,0 +1,531 @@
+// Package octo assembles Octo source into CHIP-8, SUPER-CHIP and XO-CHIP
+// ROMs.
+package octo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/mrchip53/chip-station/cores/chip8"
+)
+
+// MAX_EXPANSIONS bounds macro expansion so recursive macros fail instead of
+// hanging.
+const MAX_EXPANSIONS = 10000
+
+// Error is an assembly error mapped to the source line that caused it.
+type Error struct {
+	Line    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// Program is an assembled ROM, loaded at ROM_START_ADDRESS.
+type Program struct {
+	ROM    []byte
+	Labels map[string]uint16
+	// Lines maps the address of each instruction to its source line.
+	Lines map[uint16]int
+}
+
+// Assemble assembles Octo source. The first error stops assembly.
+func Assemble(source string) (*Program, error) {
+	a := newAssembler(tokenize(source))
+	if err := a.assemble(); err != nil {
+		return nil, err
+	}
+	return a.program(), nil
+}
+
+// ReadROM reads a ROM file, assembling it first if it is Octo source.
+func ReadROM(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.ToLower(filepath.Ext(path)) != ".o8" {
+		return data, nil
+	}
+	p, err := Assemble(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p.ROM, nil
+}
+
+type token struct {
+	text string
+	line int
+}
+
+// tokenize splits the source on whitespace, dropping # comments. Braces and
+// parentheses are tokens of their own.
+func tokenize(source string) []token {
+	var tokens []token
+	for n, line := range strings.Split(source, "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		var word strings.Builder
+		flush := func() {
+			if word.Len() > 0 {
+				tokens = append(tokens, token{text: word.String(), line: n + 1})
+				word.Reset()
+			}
+		}
+		for _, r := range line {
+			switch {
+			case unicode.IsSpace(r):
+				flush()
+			case strings.ContainsRune("{}()", r):
+				flush()
+				tokens = append(tokens, token{text: string(r), line: n + 1})
+			default:
+				word.WriteRune(r)
+			}
+		}
+		flush()
+	}
+	return tokens
+}
+
+type macro struct {
+	params []string
+	body   []token
+}
+
+type fixupKind uint8
+
+const (
+	// fixupAddress patches the low 12 bits of an opcode.
+	fixupAddress fixupKind = iota
+	// fixupLong patches a full 16-bit address.
+	fixupLong
+	// fixupUnpack and fixupUnpackLong patch the operands of the v0 and v1
+	// loads emitted by :unpack.
+	fixupUnpack
+	fixupUnpackLong
+)
+
+// fixup is a reference to a label that was not yet defined when it was
+// assembled.
+type fixup struct {
+	kind    fixupKind
+	address int
+	name    string
+	line    int
+	nibble  uint8
+}
+
+// block is an open if/begin or loop. For an if, jump is the address of the
+// jump to patch at else or end. For a loop, breaks are the jumps emitted by
+// while.
+type block struct {
+	loop   bool
+	line   int
+	start  int
+	jump   int
+	breaks []int
+}
+
+type assembler struct {
+	tokens []token
+	pos    int
+	line   int
+
+	memory []byte
+	here   int
+	size   int
+
+	labels    map[string]uint16
+	constants map[string]float64
+	aliases   map[string]uint8
+	macros    map[string]macro
+	fixups    []fixup
+	lines     map[uint16]int
+	blocks    []block
+
+	expansions int
+	// jumpToMain is set while 0x200 holds the placeholder jump to main.
+	jumpToMain bool
+}
+
+func newAssembler(tokens []token) *assembler {
+	return &assembler{
+		tokens:    tokens,
+		memory:    make([]byte, chip8.XO_MEMORY_SIZE),
+		here:      chip8.ROM_START_ADDRESS,
+		labels:    make(map[string]uint16),
+		constants: make(map[string]float64),
+		aliases:   make(map[string]uint8),
+		macros:    make(map[string]macro),
+		lines:     make(map[uint16]int),
+	}
+}
+
+func (a *assembler) errorf(format string, args ...any) error {
+	return &Error{Line: a.line, Message: fmt.Sprintf(format, args...)}
+}
+
+func (a *assembler) program() *Program {
+	return &Program{
+		ROM:    append([]byte(nil), a.memory[chip8.ROM_START_ADDRESS:a.size]...),
+		Labels: a.labels,
+		Lines:  a.lines,
+	}
+}
+
+// assemble reserves a jump to main at the start of the ROM, which is dropped
+// again if main is the first thing defined, as Octo does.
+func (a *assembler) assemble() error {
+	a.jumpToMain = true
+	a.emit(0x10, 0x00)
+
+	for !a.done() {
+		if err := a.statement(); err != nil {
+			return err
+		}
+	}
+
+	if len(a.blocks) > 0 {
+		b := a.blocks[len(a.blocks)-1]
+		a.line = b.line
+		if b.loop {
+			return a.errorf("loop without again")
+		}
+		return a.errorf("if without end")
+	}
+
+	main, ok := a.labels["main"]
+	if !ok {
+		a.line = 1
+		if len(a.tokens) > 0 {
+			a.line = a.tokens[len(a.tokens)-1].line
+		}
+		return a.errorf("program has no main label")
+	}
+	if a.jumpToMain {
+		a.patch(fixup{kind: fixupAddress, address: chip8.ROM_START_ADDRESS}, main)
+	}
+
+	for _, f := range a.fixups {
+		address, ok := a.labels[f.name]
+		if !ok {
+			a.line = f.line
+			return a.errorf("undefined name %q", f.name)
+		}
+		a.line = f.line
+		if (f.kind == fixupAddress || f.kind == fixupUnpack) && address > 0xFFF {
+			return a.errorf("address 0x%X of %q does not fit in 12 bits", address, f.name)
+		}
+		a.patch(f, address)
+	}
+	return nil
+}
+
+func (a *assembler) patch(f fixup, address uint16) {
+	switch f.kind {
+	case fixupAddress:
+		a.memory[f.address] = a.memory[f.address]&0xF0 | byte(address>>8&0xF)
+		a.memory[f.address+1] = byte(address)
+	case fixupLong:
+		a.memory[f.address] = byte(address >> 8)
+		a.memory[f.address+1] = byte(address)
+	case fixupUnpack:
+		a.memory[f.address+1] = f.nibble<<4 | byte(address>>8&0xF)
+		a.memory[f.address+3] = byte(address)
+	case fixupUnpackLong:
+		a.memory[f.address+1] = byte(address >> 8)
+		a.memory[f.address+3] = byte(address)
+	}
+}
+
+func (a *assembler) done() bool {
+	return a.pos >= len(a.tokens)
+}
+
+func (a *assembler) peek() string {
+	if a.done() {
+		return ""
+	}
+	return a.tokens[a.pos].text
+}
+
+func (a *assembler) next() (string, error) {
+	if a.done() {
+		return "", a.errorf("unexpected end of source")
+	}
+	t := a.tokens[a.pos]
+	a.pos++
+	a.line = t.line
+	return t.text, nil
+}
+
+func (a *assembler) expect(text string) error {
+	t, err := a.next()
+	if err != nil {
+		return err
+	}
+	if t != text {
+		return a.errorf("expected %q, got %q", text, t)
+	}
+	return nil
+}
+
+func (a *assembler) emit(b ...byte) error {
+	if a.here+len(b) > len(a.memory) {
+		return a.errorf("program does not fit in memory")
+	}
+	copy(a.memory[a.here:], b)
+	a.here += len(b)
+	a.size = max(a.size, a.here)
+	return nil
+}
+
+// instruction emits an opcode and records the line it came from.
+func (a *assembler) instruction(opcode uint16) error {
+	a.lines[uint16(a.here)] = a.line
+	return a.emit(byte(opcode>>8), byte(opcode))
+}
+
+func (a *assembler) statement() error {
+	t, err := a.next()
+	if err != nil {
+		return err
+	}
+
+	if m, ok := a.macros[t]; ok {
+		return a.expand(m)
+	}
+	if strings.HasPrefix(t, ":") && t != ":" {
+		return a.directive(t)
+	}
+	if _, ok := a.register(t); ok {
+		return a.registerStatement(t)
+	}
+	return a.instructionStatement(t)
+}
+
+// expand splices the body of a macro into the token stream with its
+// parameters replaced by the arguments that follow the invocation.
+func (a *assembler) expand(m macro) error {
+	a.expansions++
+	if a.expansions > MAX_EXPANSIONS {
+		return a.errorf("too many macro expansions")
+	}
+	args := make(map[string]string, len(m.params))
+	for _, param := range m.params {
+		arg, err := a.next()
+		if err != nil {
+			return err
+		}
+		args[param] = arg
+	}
+	body := make([]token, len(m.body))
+	for i, t := range m.body {
+		if arg, ok := args[t.text]; ok {
+			t.text = arg
+		}
+		body[i] = t
+	}
+	rest := a.tokens[a.pos:]
+	a.tokens = append(append(a.tokens[:a.pos:a.pos], body...), rest...)
+	return nil
+}
+
+// name reads a new identifier for a label, constant, alias or macro.
+func (a *assembler) name() (string, error) {
+	name, err := a.next()
+	if err != nil {
+		return "", err
+	}
+	if _, ok := parseNumber(name); ok || strings.ContainsAny(name, "{}()") {
+		return "", a.errorf("invalid name %q", name)
+	}
+	if _, ok := parseRegister(name); ok {
+		return "", a.errorf("cannot use register %s as a name", name)
+	}
+	return name, nil
+}
+
+func (a *assembler) directive(t string) error {
+	switch t {
+	case ":alias":
+		name, err := a.name()
+		if err != nil {
+			return err
+		}
+		r, err := a.nextRegister()
+		if err != nil {
+			return err
+		}
+		a.aliases[name] = r
+		return nil
+	case ":const":
+		name, err := a.name()
+		if err != nil {
+			return err
+		}
+		if _, ok := a.constants[name]; ok {
+			return a.errorf("constant %q is already defined", name)
+		}
+		v, err := a.nextValue()
+		if err != nil {
+			return err
+		}
+		a.constants[name] = float64(v)
+		return nil
+	case ":calc":
+		name, err := a.name()
+		if err != nil {
+			return err
+		}
+		v, err := a.calcBlock()
+		if err != nil {
+			return err
+		}
+		a.constants[name] = v
+		return nil
+	case ":macro":
+		return a.defineMacro()
+	case ":org":
+		v, err := a.nextValue()
+		if err != nil {
+			return err
+		}
+		if v < chip8.ROM_START_ADDRESS || v >= len(a.memory) {
+			return a.errorf("cannot :org to 0x%X", v)
+		}
+		a.here = v
+		if a.jumpToMain && v < chip8.ROM_START_ADDRESS+2 {
+			a.jumpToMain = false
+		}
+		return nil
+	case ":byte":
+		var v int
+		if a.peek() == "{" {
+			f, err := a.calcBlock()
+			if err != nil {
+				return err
+			}
+			v = int(f)
+		} else {
+			var err error
+			if v, err = a.nextValue(); err != nil {
+				return err
+			}
+		}
+		b, err := a.byteValue(v)
+		if err != nil {
+			return err
+		}
+		return a.emit(b)
+	case ":pointer":
+		return a.addressOperand(fixupLong, 0, func(address int) error {
+			return a.emit(byte(address>>8), byte(address))
+		})
+	case ":call":
+		return a.call()
+	case ":unpack":
+		return a.unpack()
+	case ":next":
+		// The following instruction's operand byte gets the label.
+		name, err := a.name()
+		if err != nil {
+			return err
+		}
+		return a.defineLabel(name, a.here+1)
+	case ":breakpoint":
+		_, err := a.next()
+		return err
+	case ":monitor":
+		if _, err := a.next(); err != nil {
+			return err
+		}
+		_, err := a.next()
+		return err
+	}
+	return a.errorf("unknown directive %s", t)
+}
+
+func (a *assembler) defineLabel(name string, address int) error {
+	if _, ok := a.labels[name]; ok {
+		return a.errorf("label %q is already defined", name)
+	}
+	if _, ok := a.constants[name]; ok {
+		return a.errorf("%q is already defined as a constant", name)
+	}
+	a.labels[name] = uint16(address)
+	return nil
+}
+
+func (a *assembler) defineMacro() error {
+	name, err := a.name()
+	if err != nil {
+		return err
+	}
+	var m macro
+	for {
+		t, err := a.next()
+		if err != nil {
+			return err
+		}
+		if t == "{" {
+			break
+		}
+		m.params = append(m.params, t)
+	}
+	for depth := 1; ; {
+		if a.done() {
+			return a.errorf("macro %q is missing its closing }", name)
+		}
+		t := a.tokens[a.pos]
+		a.pos++
+		switch t.text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		}
+		if depth == 0 {
+			break
+		}
+		m.body = append(m.body, t)
+	}
+	a.macros[name] = m
+	return nil
+}
+
+// unpack loads v0 and v1 with a nibble and a 12-bit address, or with the
+// two bytes of a 16-bit address for :unpack long.
+func (a *assembler) unpack() error {
+	if a.peek() == "long" {
+		a.next()
+		return a.addressOperand(fixupUnpackLong, 0, func(address int) error {
+			if err := a.instruction(0x6000 | uint16(address>>8)); err != nil {
+				return err
+			}
+			return a.instruction(0x6100 | uint16(address&0xFF))
+		})
+	}
+	v, err := a.nextValue()
+	if err != nil {
+		return err
+	}
+	if v < 0 || v > 0xF {
+		return a.errorf(":unpack nibble %d is out of range", v)
+	}
+	nibble := uint8(v)
+	return a.addressOperand(fixupUnpack, nibble, func(address int) error {
+		if err := a.instruction(0x6000 | uint16(nibble)<<4 | uint16(address>>8&0xF)); err != nil {
+			return err
+		}
+		return a.instruction(0x6100 | uint16(address&0xFF))
+	})
+}
@@ -0,0 +1,107 @@
+package octo
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestAssembleChipStation(t *testing.T) {
+	source, err := os.ReadFile("../../../app/chipstation.o8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile("../../../wasm/chipstation/roms/chipstation.ch8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := Assemble(string(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p.ROM, want) {
+		t.Errorf("ROM = % X, want % X (run go generate in wasm/chipstation)", p.ROM, want)
+	}
+	if p.Labels["letter-c"] != 0x24C {
+		t.Errorf("letter-c = 0x%X, want 0x24C", p.Labels["letter-c"])
+	}
+	if p.Lines[0x200] != 11 {
+		t.Errorf("0x200 maps to line %d, want 11", p.Lines[0x200])
+	}
+}
+
+func TestAssemble(t *testing.T) {
+	tests := []struct {
+		source string
+		want   []byte
+	}{
+		{": main clear return", []byte{0x00, 0xE0, 0x00, 0xEE}},
+		{": main v3 := 0x10 v3 -= 1 va <<= vb", []byte{0x63, 0x10, 0x73, 0xFF, 0x8A, 0xBE}},
+		{": main v1 := random 0x0F v2 := key v3 := delay", []byte{0xC1, 0x0F, 0xF2, 0x0A, 0xF3, 0x07}},
+		{": main i := hex v4 i += v4 bcd v4 save v4 load v2 - v3", []byte{0xF4, 0x29, 0xF4, 0x1E, 0xF4, 0x33, 0xF4, 0x55, 0x52, 0x33}},
+		{": main hires scroll-down 4 plane 3 audio", []byte{0x00, 0xFF, 0x00, 0xC4, 0xF3, 0x01, 0xF0, 0x02}},
+		{": main i := long data : data 0xFF", []byte{0xF0, 0x00, 0x02, 0x04, 0xFF}},
+		// Without main first, the ROM starts with a jump to it.
+		{": data 1 2 : main jump data", []byte{0x12, 0x04, 0x01, 0x02, 0x12, 0x02}},
+		{": main sub ; : sub return", []byte{0x22, 0x04, 0x00, 0xEE, 0x00, 0xEE}},
+		{":alias x v5 :const speed 3 : main x += speed", []byte{0x75, 0x03}},
+		{":calc n { 2 * 3 + 1 } : main v0 := n", []byte{0x60, 0x08}},
+		{":calc n { ( 2 * 3 ) + 1 } : main v0 := n :byte { n << 4 }", []byte{0x60, 0x07, 0x70}},
+		{":macro add3 reg { reg += 3 } : main add3 v1 add3 v2", []byte{0x71, 0x03, 0x72, 0x03}},
+		{": main :unpack 0xA data : data", []byte{0x60, 0xA2, 0x61, 0x04}},
+		{": main :org 0x208 0xAA", []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xAA}},
+		{": main if v1 == 2 then v2 := 0", []byte{0x41, 0x02, 0x62, 0x00}},
+		{": main if v1 key then clear if v1 != v2 then clear", []byte{0xE1, 0xA1, 0x00, 0xE0, 0x51, 0x20, 0x00, 0xE0}},
+		{": main if v1 < 5 then clear", []byte{0x6F, 0x05, 0x8F, 0x17, 0x3F, 0x01, 0x00, 0xE0}},
+		{
+			": main if v1 == 0 begin v2 := 1 else v2 := 2 end",
+			[]byte{0x41, 0x00, 0x12, 0x08, 0x62, 0x01, 0x12, 0x0A, 0x62, 0x02},
+		},
+		{
+			": main loop v1 += 1 while v1 != 8 again",
+			[]byte{0x71, 0x01, 0x41, 0x08, 0x12, 0x08, 0x12, 0x00},
+		},
+	}
+
+	for _, test := range tests {
+		p, err := Assemble(test.source)
+		if err != nil {
+			t.Errorf("Assemble(%q) failed: %v", test.source, err)
+			continue
+		}
+		if !bytes.Equal(p.ROM, test.want) {
+			t.Errorf("Assemble(%q) = % X, want % X", test.source, p.ROM, test.want)
+		}
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		line   int
+	}{
+		{"clear", 1},
+		{": main\n\tv1 := 300", 2},
+		{": main\n\tjump nowhere\n", 2},
+		{": main\n\tsprite v1 v2\n", 2},
+		{": main\n\n\tif v1 == 1 begin\n\tclear\n", 3},
+		{": main\n\tagain\n", 2},
+		{": main\n: main\n", 2},
+		{": main\n\tv1 ** v2\n", 2},
+		{":macro m { m }\n: main\n\tm\n", 1},
+	}
+
+	for _, test := range tests {
+		_, err := Assemble(test.source)
+		var assembleErr *Error
+		if !errors.As(err, &assembleErr) {
+			t.Errorf("Assemble(%q) error = %v, want *Error", test.source, err)
+			continue
+		}
+		if assembleErr.Line != test.line {
+			t.Errorf("Assemble(%q) error on line %d, want %d: %v", test.source, assembleErr.Line, test.line, err)
+		}
+	}
+}
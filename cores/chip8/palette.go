@@ -0,0 +1,149 @@
+package chip8
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Palette is a color scheme for the display. Frontends draw with it, the
+// machine itself never looks at it.
+type Palette struct {
+	// Name is the preset the palette is, empty for custom colors.
+	Name string
+	// Colors are 0xRRGGBB values for unlit and lit pixels, and optionally
+	// for XO-CHIP pixels lit in the second plane and in both planes.
+	Colors []uint32
+}
+
+// PalettePresets are the built-in palettes, the first being the default.
+var PalettePresets = []Palette{
+	{Name: "amber", Colors: []uint32{0x8E6903, 0xF2CE03, 0xFF6600, 0x662200}},
+	{Name: "octo", Colors: []uint32{0x996600, 0xFFCC00, 0xFF6600, 0x662200}},
+	{Name: "lcd", Colors: []uint32{0xF9FFB3, 0x3D8026, 0xABCC47, 0x00131A}},
+	{Name: "gameboy", Colors: []uint32{0x9BBC0F, 0x0F380F, 0x306230, 0x8BAC0F}},
+	{Name: "highcontrast", Colors: []uint32{0x000000, 0xFFFFFF}},
+}
+
+var DefaultPalette = PalettePresets[0]
+
+func GetPalettePreset(name string) (Palette, bool) {
+	for _, p := range PalettePresets {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Palette{}, false
+}
+
+// ParsePalette reads a preset name or a comma separated list of two or four
+// hex colors, e.g. 000000,FFFFFF.
+func ParsePalette(value string) (Palette, error) {
+	if p, ok := GetPalettePreset(value); ok {
+		return p, nil
+	}
+	var p Palette
+	for _, c := range strings.Split(value, ",") {
+		rgb, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(c), "#"), 16, 24)
+		if err != nil {
+			return Palette{}, fmt.Errorf("invalid palette %q", value)
+		}
+		p.Colors = append(p.Colors, uint32(rgb))
+	}
+	if err := p.validate(); err != nil {
+		return Palette{}, err
+	}
+	return p, nil
+}
+
+func (p Palette) validate() error {
+	if len(p.Colors) != 2 && len(p.Colors) != 4 {
+		return fmt.Errorf("palette has %d colors, want 2 or 4", len(p.Colors))
+	}
+	return nil
+}
+
+// Expand returns the colors of all four plane combinations. Two color
+// palettes show the second plane at two thirds and both planes at a third
+// of the way from the unlit to the lit color.
+func (p Palette) Expand() [4]uint32 {
+	if len(p.Colors) == 4 {
+		return [4]uint32(p.Colors)
+	}
+	off, on := DefaultPalette.Colors[0], DefaultPalette.Colors[1]
+	if len(p.Colors) == 2 {
+		off, on = p.Colors[0], p.Colors[1]
+	}
+	return [4]uint32{off, on, mixRGB(off, on, 2.0/3), mixRGB(off, on, 1.0/3)}
+}
+
+func mixRGB(a, b uint32, t float64) uint32 {
+	var c uint32
+	for shift := 0; shift <= 16; shift += 8 {
+		ca, cb := float64(a>>shift&0xFF), float64(b>>shift&0xFF)
+		c |= uint32(ca+(cb-ca)*t+0.5) << shift
+	}
+	return c
+}
+
+func (p Palette) String() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	colors := make([]string, len(p.Colors))
+	for i, c := range p.Colors {
+		colors[i] = fmt.Sprintf("%06X", c)
+	}
+	return strings.Join(colors, ",")
+}
+
+// MarshalJSON writes presets by name and other palettes as a list of
+// "#RRGGBB" colors.
+func (p Palette) MarshalJSON() ([]byte, error) {
+	if p.Name != "" {
+		return json.Marshal(p.Name)
+	}
+	colors := make([]string, len(p.Colors))
+	for i, c := range p.Colors {
+		colors[i] = fmt.Sprintf("#%06X", c)
+	}
+	return json.Marshal(colors)
+}
+
+func (p *Palette) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		preset, ok := GetPalettePreset(name)
+		if !ok {
+			return fmt.Errorf("unknown palette %q", name)
+		}
+		*p = preset
+		return nil
+	}
+	var colors []string
+	if err := json.Unmarshal(data, &colors); err != nil {
+		return err
+	}
+	parsed, err := ParsePalette(strings.Join(colors, ","))
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
+
+func (e *Chip8Emulator) SetPalette(p Palette) {
+	e.EnqueueMessage(PaletteMessage{palette: p})
+}
+
+func (e *Chip8Emulator) GetPalette() Palette {
+	return e.palette
+}
+
+func (e *Chip8Emulator) setPalette(p Palette) {
+	e.palette = p
+	if e.hooks.Palette != nil {
+		e.hooks.Palette(p)
+	}
+}
@@ -0,0 +1,133 @@
+package chip8
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParsePalette(t *testing.T) {
+	p, err := ParsePalette("gameboy")
+	if err != nil || p.Name != "gameboy" || len(p.Colors) != 4 {
+		t.Errorf("ParsePalette(gameboy) = %v, %v", p, err)
+	}
+
+	p, err = ParsePalette("#000000, FFFFFF")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Two colors fill in the XO-CHIP planes with blends of them.
+	if got, want := p.Expand(), [4]uint32{0x000000, 0xFFFFFF, 0xAAAAAA, 0x555555}; got != want {
+		t.Errorf("Expand() = %06X, want %06X", got, want)
+	}
+
+	for _, bad := range []string{"", "nope", "000000", "000000,FFFFFF,FF0000", "000000,GGGGGG"} {
+		if _, err := ParsePalette(bad); err == nil {
+			t.Errorf("ParsePalette(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestRomDatabaseJSON(t *testing.T) {
+	rom := []byte{0x12, 0x00}
+	custom := Palette{Colors: []uint32{0x102030, 0xF0E0D0}}
+	lcd, _ := GetPalettePreset("lcd")
+
+	db := make(RomDatabase)
+	db.Add(rom, RomMetadata{Title: "Loop", Palette: &custom})
+	db.Add([]byte{0x00, 0xE0}, RomMetadata{Palette: &lcd})
+	data, err := json.Marshal(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseRomDatabase(data)
+	if err != nil {
+		t.Fatalf("%v in %s", err, data)
+	}
+	m, ok := parsed.Lookup(rom)
+	if !ok || m.Title != "Loop" || m.Palette.String() != "102030,F0E0D0" {
+		t.Errorf("Lookup() = %+v, %v", m, ok)
+	}
+	if m, _ := parsed.Lookup([]byte{0x00, 0xE0}); m.Palette == nil || m.Palette.Name != "lcd" {
+		t.Errorf("preset palette came back as %v", m.Palette)
+	}
+
+	if _, err := ParseRomDatabase([]byte(`{"abc": {}}`)); err == nil {
+		t.Errorf("parsed a database with an invalid hash")
+	}
+}
+
+func TestRomPalette(t *testing.T) {
+	var applied []string
+	e := NewChip8Emulator(Hooks{
+		Palette: func(p Palette) {
+			applied = append(applied, p.String())
+		},
+	}, QuirksCosmacVIP)
+	rom := []byte{0x12, 0x00}
+	other := []byte{0x12, 0x02}
+
+	gameboy, _ := GetPalettePreset("gameboy")
+	db := make(RomDatabase)
+	db.Add(rom, RomMetadata{Palette: &gameboy})
+	e.SetRomDatabase(db)
+	e.SwapROM(other)
+	e.SwapROM(rom)
+	e.Cycle(0)
+	if len(applied) != 1 || e.GetPalette().Name != "gameboy" {
+		t.Fatalf("palettes applied = %v", applied)
+	}
+
+	// Attaching a palette to the other ROM brings it back on every load.
+	e.SwapROM(other)
+	e.AttachPalette(Palette{Colors: []uint32{0x000000, 0x00FF00}})
+	e.SwapROM(rom)
+	e.SwapROM(other)
+	e.Cycle(0)
+	want := []string{"gameboy", "000000,00FF00", "gameboy", "000000,00FF00"}
+	if len(applied) != len(want) {
+		t.Fatalf("palettes applied = %v, want %v", applied, want)
+	}
+	for i := range want {
+		if applied[i] != want[i] {
+			t.Fatalf("palettes applied = %v, want %v", applied, want)
+		}
+	}
+	if m, ok := e.GetRomMetadata(); !ok || m.Palette.String() != "000000,00FF00" {
+		t.Errorf("GetRomMetadata() = %+v, %v", m, ok)
+	}
+}
+
+// TestBundledRomDatabase checks that every ROM the web frontend has
+// metadata for is one it ships.
+func TestBundledRomDatabase(t *testing.T) {
+	data, err := os.ReadFile("../../wasm/chipstation/assets/roms.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := ParseRomDatabase(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := filepath.Glob("../../wasm/chipstation/roms/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundled := make(map[[sha256.Size]byte]bool)
+	for _, path := range paths {
+		rom, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bundled[sha256.Sum256(rom)] = true
+	}
+	for hash, m := range db {
+		if !bundled[hash] {
+			t.Errorf("%s (%x) is not a ROM in wasm/chipstation/roms", m.Title, hash)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package chip8
+
+type Platform uint8
+
+const (
+	PlatformChip8 Platform = iota
+	PlatformSChip
+	PlatformXOChip
+)
+
+func (p Platform) MemorySize() int {
+	if p == PlatformXOChip {
+		return XO_MEMORY_SIZE
+	}
+	return MEMORY_SIZE
+}
+
+func (p Platform) String() string {
+	switch p {
+	case PlatformSChip:
+		return "SUPER-CHIP"
+	case PlatformXOChip:
+		return "XO-CHIP"
+	default:
+		return "CHIP-8"
+	}
+}
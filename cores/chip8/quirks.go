@@ -0,0 +1,68 @@
+package chip8
+
+// Quirks selects between the behaviours that differ across CHIP-8
+// interpreters. The flags up to Jumping are named after the matching check
+// in the Timendus quirks test ROM, the rest cover SUPER-CHIP 1.1 drawing it
+// does not test.
+type Quirks struct {
+	// Platform selects the memory size of the machine.
+	Platform Platform
+	// VfReset clears VF after 8XY1, 8XY2 and 8XY3.
+	VfReset bool
+	// Memory increments I by X+1 after FX55 and FX65.
+	Memory bool
+	// DisplayWait ends the frame after every DXYN, like waiting for vblank.
+	DisplayWait bool
+	// Clipping clips sprites at the screen edges instead of wrapping them.
+	Clipping bool
+	// Shifting makes 8XY6 and 8XYE shift VX in place and ignore VY.
+	Shifting bool
+	// Jumping makes BNNN behave as BXNN and jump to XNN+VX.
+	Jumping bool
+	// LoresTallSprites makes DXY0 draw an 8x16 sprite in lores instead of a
+	// 16x16 one.
+	LoresTallSprites bool
+	// RowCollisions sets VF to the number of sprite rows that collided or
+	// were clipped at the bottom in hires, instead of to 1 on any collision.
+	RowCollisions bool
+}
+
+var (
+	QuirksCosmacVIP = Quirks{
+		VfReset:     true,
+		Memory:      true,
+		DisplayWait: true,
+		Clipping:    true,
+	}
+	QuirksSChipLegacy = Quirks{
+		Platform:         PlatformSChip,
+		DisplayWait:      true,
+		Clipping:         true,
+		Shifting:         true,
+		Jumping:          true,
+		LoresTallSprites: true,
+		RowCollisions:    true,
+	}
+	QuirksSChipModern = Quirks{
+		Platform: PlatformSChip,
+		Clipping: true,
+		Shifting: true,
+		Jumping:  true,
+	}
+	QuirksXOChip = Quirks{
+		Platform: PlatformXOChip,
+		Memory:   true,
+	}
+)
+
+var QuirksPresets = map[string]Quirks{
+	"vip":          QuirksCosmacVIP,
+	"schip-legacy": QuirksSChipLegacy,
+	"schip-modern": QuirksSChipModern,
+	"xochip":       QuirksXOChip,
+}
+
+func GetQuirksPreset(name string) (Quirks, bool) {
+	q, ok := QuirksPresets[name]
+	return q, ok
+}
@@ -0,0 +1,86 @@
+package chip8
+
+import (
+	"bytes"
+	"testing"
+)
+
+func runFrames(e *Chip8Emulator, frames int) {
+	e.Resume()
+	for i := 0; i < frames; i++ {
+		e.Cycle(float64(i) * 1000 / 60)
+	}
+}
+
+func TestLoresTallSprites(t *testing.T) {
+	rom := append([]byte{
+		0xA2, 0x08, // 0x200: i := 0x208
+		0x60, 0x00, // 0x202: v0 := 0
+		0xD0, 0x00, // 0x204: sprite v0 v0 0
+		0x12, 0x06, // 0x206: jump 0x206
+	}, bytes.Repeat([]byte{0xFF}, 32)...)
+
+	for _, test := range []struct {
+		name   string
+		quirks Quirks
+		width  int
+	}{
+		{"schip-legacy", QuirksSChipLegacy, 8},
+		{"schip-modern", QuirksSChipModern, 16},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			e := NewChip8Emulator(Hooks{}, test.quirks)
+			e.SwapROM(rom)
+			runFrames(e, 4)
+
+			for x := 0; x < 16; x++ {
+				lit := e.display.Pixel(x, 15) != 0
+				if want := x < test.width; lit != want {
+					t.Errorf("pixel (%d, 15) lit = %v, want %v", x, lit, want)
+				}
+			}
+			if e.display.Pixel(0, 16) != 0 {
+				t.Error("sprite is taller than 16 rows")
+			}
+		})
+	}
+}
+
+func TestRowCollisions(t *testing.T) {
+	rom := append([]byte{
+		0x00, 0xFF, // 0x200: hires
+		0xA2, 0x12, // 0x202: i := 0x212
+		0x60, 0x00, // 0x204: v0 := 0
+		0x61, 0x38, // 0x206: v1 := 56
+		0xD0, 0x10, // 0x208: sprite v0 v1 0
+		0x82, 0xF0, // 0x20A: v2 := vF
+		0xD0, 0x10, // 0x20C: sprite v0 v1 0
+		0x83, 0xF0, // 0x20E: v3 := vF
+		0x12, 0x10, // 0x210: jump 0x210
+	}, bytes.Repeat([]byte{0xFF}, 32)...)
+
+	for _, test := range []struct {
+		name   string
+		quirks Quirks
+		first  uint8
+		second uint8
+	}{
+		// 8 of the 16 rows fall off the bottom, all 8 others collide the
+		// second time.
+		{"schip-legacy", QuirksSChipLegacy, 8, 16},
+		{"schip-modern", QuirksSChipModern, 0, 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			e := NewChip8Emulator(Hooks{}, test.quirks)
+			e.SwapROM(rom)
+			runFrames(e, 4)
+
+			if e.v[2] != test.first {
+				t.Errorf("VF after the first draw = %d, want %d", e.v[2], test.first)
+			}
+			if e.v[3] != test.second {
+				t.Errorf("VF after the second draw = %d, want %d", e.v[3], test.second)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package render
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image/png"
+	"io"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+type pngChunk struct {
+	kind string
+	data []byte
+}
+
+// EncodeAPNG writes a looping animated PNG. Every image is encoded as a
+// PNG of its own and its image data moved into the frame chunks of the
+// animation.
+func (r *Recorder) EncodeAPNG(w io.Writer) error {
+	if len(r.images) == 0 {
+		return ErrNoFrames
+	}
+	if _, err := w.Write(pngSignature); err != nil {
+		return err
+	}
+
+	size := r.images[0].Bounds().Size()
+	sequence := uint32(0)
+	for i, img := range r.images {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return err
+		}
+		chunks, err := readChunks(buf.Bytes())
+		if err != nil {
+			return err
+		}
+
+		if i == 0 {
+			for _, c := range chunks {
+				if c.kind == "IHDR" {
+					if err := writeChunk(w, c.kind, c.data); err != nil {
+						return err
+					}
+				}
+			}
+			// acTL: the number of frames and 0 to loop forever.
+			if err := writeChunk(w, "acTL", be32(uint32(len(r.images)), 0)); err != nil {
+				return err
+			}
+		}
+
+		// fcTL: the frame covers the whole image, lasts durations[i]
+		// 60ths of a second and replaces the one before it.
+		fcTL := be32(sequence, uint32(size.X), uint32(size.Y), 0, 0)
+		fcTL = binary.BigEndian.AppendUint16(fcTL, uint16(min(r.durations[i], 0xFFFF)))
+		fcTL = binary.BigEndian.AppendUint16(fcTL, FRAME_RATE)
+		fcTL = append(fcTL, 0, 0)
+		if err := writeChunk(w, "fcTL", fcTL); err != nil {
+			return err
+		}
+		sequence++
+
+		for _, c := range chunks {
+			if c.kind != "IDAT" {
+				continue
+			}
+			var err error
+			if i == 0 {
+				err = writeChunk(w, "IDAT", c.data)
+			} else {
+				err = writeChunk(w, "fdAT", append(be32(sequence), c.data...))
+				sequence++
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return writeChunk(w, "IEND", nil)
+}
+
+func readChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	data = data[len(pngSignature):]
+	var chunks []pngChunk
+	for len(data) >= 12 {
+		length := int(binary.BigEndian.Uint32(data))
+		if len(data) < 12+length {
+			return nil, io.ErrUnexpectedEOF
+		}
+		chunks = append(chunks, pngChunk{kind: string(data[4:8]), data: data[8 : 8+length]})
+		data = data[12+length:]
+	}
+	return chunks, nil
+}
+
+func writeChunk(w io.Writer, kind string, data []byte) error {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, kind...)
+	chunk = append(chunk, data...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	_, err := w.Write(chunk)
+	return err
+}
+
+func be32(values ...uint32) []byte {
+	var b []byte
+	for _, v := range values {
+		b = binary.BigEndian.AppendUint32(b, v)
+	}
+	return b
+}
@@ -0,0 +1,146 @@
+package render
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+
+	"github.com/mrchip53/chip-station/utilities"
+)
+
+// FRAME_RATE is the rate frames are added to a Recorder at.
+const FRAME_RATE = 60
+
+type Format uint8
+
+const (
+	FormatGIF Format = iota
+	FormatAPNG
+)
+
+var ErrNoFrames = errors.New("no frames recorded")
+
+// Recorder collects the frames of a run into an animation. A frame equal
+// to the one before it only makes that one last longer.
+type Recorder struct {
+	renderer *Renderer
+
+	images []*image.RGBA
+	// durations is how many frames each image lasts.
+	durations []int
+
+	// source is the last bitmap added, to skip rendering frames that did
+	// not change.
+	source []uint8
+}
+
+func NewRecorder(palette Palette, options Options) *Recorder {
+	return &Recorder{renderer: NewRenderer(palette, options)}
+}
+
+// Add records b as the next frame, 1/60 of a second after the last one.
+// Frames of another size than the first, e.g. after switching to hires,
+// are scaled to its size.
+func (r *Recorder) Add(b Bitmap) {
+	w, h := b.Width(), b.Height()
+	fading, _ := b.(Fading)
+	source := make([]uint8, 0, w*h*2+2)
+	source = append(source, uint8(w), uint8(h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			source = append(source, b.Pixel(x, y))
+			if fading != nil {
+				source = append(source, uint8(fading.Light(x, y)*0xFF))
+			}
+		}
+	}
+	// Without persistence an unchanged bitmap renders the same image.
+	if r.renderer.Options.Persistence == 0 && bytes.Equal(source, r.source) {
+		r.durations[len(r.durations)-1]++
+		return
+	}
+	r.source = source
+
+	img := r.renderer.Render(b)
+	if len(r.images) > 0 {
+		size := r.images[0].Bounds().Size()
+		if img.Bounds().Size() != size {
+			img = toRGBA(utilities.ScaleImage(img, size.X, size.Y))
+		}
+		if last := len(r.images) - 1; bytes.Equal(img.Pix, r.images[last].Pix) {
+			r.durations[last]++
+			return
+		}
+	}
+	r.images = append(r.images, img)
+	r.durations = append(r.durations, 1)
+}
+
+// Frames is the number of frames added so far.
+func (r *Recorder) Frames() int {
+	frames := 0
+	for _, d := range r.durations {
+		frames += d
+	}
+	return frames
+}
+
+func (r *Recorder) Encode(w io.Writer, format Format) error {
+	if format == FormatAPNG {
+		return r.EncodeAPNG(w)
+	}
+	return r.EncodeGIF(w)
+}
+
+// EncodeGIF writes a looping GIF. GIF delays are in hundredths of a second
+// and players stretch anything below two, so images lasting a single frame
+// run a little slow.
+func (r *Recorder) EncodeGIF(w io.Writer) error {
+	if len(r.images) == 0 {
+		return ErrNoFrames
+	}
+	anim := &gif.GIF{}
+	frames, elapsed := 0, 0
+	for i, img := range r.images {
+		frames += r.durations[i]
+		delay := max(frames*100/FRAME_RATE-elapsed, 2)
+		elapsed += delay
+		anim.Image = append(anim.Image, toPaletted(img))
+		anim.Delay = append(anim.Delay, delay)
+	}
+	return gif.EncodeAll(w, anim)
+}
+
+// toPaletted converts img to its exact colors, or the closest colors of a
+// fixed palette if it has more than a GIF can hold.
+func toPaletted(img *image.RGBA) *image.Paletted {
+	var colors color.Palette
+	seen := make(map[color.RGBA]bool)
+	for i := 0; i < len(img.Pix) && len(colors) <= 256; i += 4 {
+		c := color.RGBA{R: img.Pix[i], G: img.Pix[i+1], B: img.Pix[i+2], A: img.Pix[i+3]}
+		if !seen[c] {
+			seen[c] = true
+			colors = append(colors, c)
+		}
+	}
+	if len(colors) > 256 {
+		colors = palette.Plan9
+	}
+	p := image.NewPaletted(img.Bounds(), colors)
+	draw.Draw(p, p.Bounds(), img, image.Point{}, draw.Src)
+	return p
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+	rgba := image.NewRGBA(img.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	return rgba
+}
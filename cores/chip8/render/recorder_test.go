@@ -0,0 +1,109 @@
+package render
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/gif"
+	"image/png"
+	"testing"
+)
+
+func recordTestFrames() *Recorder {
+	a := bitmap{w: 4, h: 2, lit: map[[2]int]uint8{{0, 0}: 1}}
+	b := bitmap{w: 4, h: 2, lit: map[[2]int]uint8{{3, 1}: 1}}
+	r := NewRecorder(testPalette, Options{Scale: 2})
+	for _, frame := range []bitmap{a, a, a, b, a, a} {
+		r.Add(frame)
+	}
+	return r
+}
+
+func TestRecorderGIF(t *testing.T) {
+	r := recordTestFrames()
+	if r.Frames() != 6 {
+		t.Errorf("recorded %d frames, want 6", r.Frames())
+	}
+
+	var buf bytes.Buffer
+	if err := r.Encode(&buf, FormatGIF); err != nil {
+		t.Fatal(err)
+	}
+	anim, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 3, 1 and 2 frames at 60 Hz, with the single frame stretched to the
+	// shortest delay players respect.
+	want := []int{5, 2, 3}
+	if len(anim.Delay) != len(want) {
+		t.Fatalf("GIF has delays %v, want %v", anim.Delay, want)
+	}
+	for i := range want {
+		if anim.Delay[i] != want[i] {
+			t.Errorf("GIF has delays %v, want %v", anim.Delay, want)
+			break
+		}
+	}
+	if size := anim.Image[0].Bounds().Size(); size.X != 8 || size.Y != 4 {
+		t.Errorf("GIF is %v, want 8x4", size)
+	}
+	if got := anim.Image[1].At(7, 3); got != testPalette[1] {
+		t.Errorf("GIF pixel = %v, want %v", got, testPalette[1])
+	}
+}
+
+func TestRecorderAPNG(t *testing.T) {
+	r := recordTestFrames()
+	var buf bytes.Buffer
+	if err := r.Encode(&buf, FormatAPNG); err != nil {
+		t.Fatal(err)
+	}
+
+	chunks, err := readChunks(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var delays []uint16
+	fdAT := 0
+	for _, c := range chunks {
+		switch c.kind {
+		case "acTL":
+			if frames := binary.BigEndian.Uint32(c.data); frames != 3 {
+				t.Errorf("acTL has %d frames, want 3", frames)
+			}
+		case "fcTL":
+			delays = append(delays, binary.BigEndian.Uint16(c.data[20:]))
+		case "fdAT":
+			fdAT++
+		}
+	}
+	if len(delays) != 3 || delays[0] != 3 || delays[1] != 1 || delays[2] != 2 || fdAT < 2 {
+		t.Errorf("fcTL delays = %v with %d fdAT chunks", delays, fdAT)
+	}
+
+	// Viewers without APNG support show the first frame.
+	img, err := png.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.At(0, 0); got != testPalette[1] {
+		t.Errorf("first frame pixel = %v, want %v", got, testPalette[1])
+	}
+}
+
+func TestRecorderResize(t *testing.T) {
+	r := NewRecorder(testPalette, Options{})
+	r.Add(bitmap{w: 4, h: 2})
+	r.Add(bitmap{w: 8, h: 4, lit: map[[2]int]uint8{{6, 2}: 1}})
+	if len(r.images) != 2 || r.images[1].Bounds() != r.images[0].Bounds() {
+		t.Fatalf("hires frame was not scaled to the first frame")
+	}
+	if got := r.images[1].RGBAAt(3, 1); got != testPalette[1] {
+		t.Errorf("scaled pixel = %v, want %v", got, testPalette[1])
+	}
+
+	var buf bytes.Buffer
+	if err := NewRecorder(testPalette, Options{}).EncodeGIF(&buf); err != ErrNoFrames {
+		t.Errorf("encoding an empty recording = %v, want ErrNoFrames", err)
+	}
+}
@@ -0,0 +1,196 @@
+// Package render draws CHIP-8 frames into images in pure Go, so headless
+// tools, screenshots and tests share one look with the web frontend.
+package render
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Bitmap is a display to draw, such as a chip8.Frame or chip8.Display.
+// Pixels hold one bit per XO-CHIP plane.
+type Bitmap interface {
+	Width() int
+	Height() int
+	Pixel(x, y int) uint8
+}
+
+// Fading is a Bitmap whose pixels can be partly lit, such as a chip8.Frame
+// fading pixels out against flicker. Light is 1 for a pixel in its palette
+// color and 0 for one in the color of unlit pixels.
+type Fading interface {
+	Bitmap
+	Light(x, y int) float64
+}
+
+// Palette maps the plane bits of a pixel to its color, so index 2 is the
+// second XO-CHIP plane and index 3 both planes overlapping.
+type Palette [4]color.RGBA
+
+// RGB converts a 0xRRGGBB value to an opaque color.
+func RGB(rgb uint32) color.RGBA {
+	return color.RGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 0xFF}
+}
+
+// NewPalette converts 0xRRGGBB colors, such as those of an expanded
+// chip8.Palette.
+func NewPalette(colors [4]uint32) Palette {
+	var p Palette
+	for i, c := range colors {
+		p[i] = RGB(c)
+	}
+	return p
+}
+
+var (
+	// DefaultPalette is the amber palette of the web frontend.
+	DefaultPalette = Palette{RGB(0x8E6903), RGB(0xF2CE03), RGB(0xFF6600), RGB(0x662200)}
+	// GrayPalette keeps single plane displays black and white.
+	GrayPalette = Palette{RGB(0x000000), RGB(0xFFFFFF), RGB(0xAAAAAA), RGB(0x555555)}
+)
+
+// GRID_SHADE is how much of a pixel's light its grid lines keep.
+const GRID_SHADE = 0.6
+
+// Options selects the size of the image and the effects drawn over it. The
+// zero value draws one image pixel per CHIP-8 pixel with no effects.
+type Options struct {
+	// Scale is the size of a CHIP-8 pixel in image pixels. Zero means 1.
+	Scale int
+	// Scanlines is the strength of the scanline ripple, 0.2 in the web
+	// display shader.
+	Scanlines float64
+	// Grid darkens the top row and left column of every CHIP-8 pixel. It
+	// needs a Scale of at least 3 to leave the pixels visible.
+	Grid bool
+	// Persistence is the share of its light a pixel keeps per frame after
+	// turning dark, like a slow phosphor. Only a Renderer drawing frame
+	// after frame shows it.
+	Persistence float64
+	// Curvature bends the picture like a CRT tube, 0 keeps it flat. Any
+	// curvature also darkens the edges like the web display shader.
+	Curvature float64
+}
+
+// Renderer draws frame after frame, keeping the light of earlier frames
+// for phosphor persistence.
+type Renderer struct {
+	Palette Palette
+	Options Options
+
+	// light is the color of every CHIP-8 pixel as last drawn, three
+	// channels each.
+	light         []float64
+	width, height int
+}
+
+func NewRenderer(palette Palette, options Options) *Renderer {
+	return &Renderer{Palette: palette, Options: options}
+}
+
+// Render draws b once, without the history persistence needs.
+func Render(b Bitmap, palette Palette, options Options) *image.RGBA {
+	return NewRenderer(palette, options).Render(b)
+}
+
+// Reset forgets the earlier frames.
+func (r *Renderer) Reset() {
+	r.light = nil
+}
+
+func (r *Renderer) Render(b Bitmap) *image.RGBA {
+	w, h := b.Width(), b.Height()
+	r.updateLight(b)
+
+	scale := max(r.Options.Scale, 1)
+	iw, ih := w*scale, h*scale
+	img := image.NewRGBA(image.Rect(0, 0, iw, ih))
+	for py := 0; py < ih; py++ {
+		for px := 0; px < iw; px++ {
+			// The pixel center in [-1, 1], bent outwards on a curved screen.
+			nx := (float64(px)+0.5)/float64(iw)*2 - 1
+			ny := (float64(py)+0.5)/float64(ih)*2 - 1
+			if k := r.Options.Curvature; k > 0 {
+				r2 := nx*nx + ny*ny
+				nx *= 1 + k*r2
+				ny *= 1 + k*r2
+				if nx < -1 || nx >= 1 || ny < -1 || ny >= 1 {
+					img.SetRGBA(px, py, color.RGBA{A: 0xFF})
+					continue
+				}
+			}
+			fx := (nx + 1) / 2 * float64(iw)
+			fy := (ny + 1) / 2 * float64(ih)
+			sx, sy := min(int(fx)/scale, w-1), min(int(fy)/scale, h-1)
+
+			i := (sy*w + sx) * 3
+			c := [3]float64{r.light[i], r.light[i+1], r.light[i+2]}
+			if r.Options.Grid && (int(fx)%scale == 0 || int(fy)%scale == 0) {
+				for ch := range c {
+					c[ch] *= GRID_SHADE
+				}
+			}
+			if dark := r.shade(px, py, iw, ih); dark > 0 {
+				for ch := range c {
+					c[ch] -= dark * 255
+				}
+			}
+			img.SetRGBA(px, py, color.RGBA{R: clamp(c[0]), G: clamp(c[1]), B: clamp(c[2]), A: 0xFF})
+		}
+	}
+	return img
+}
+
+// updateLight moves the light of every pixel to its palette color. Pixels
+// light up at once but fade out by the persistence.
+func (r *Renderer) updateLight(b Bitmap) {
+	w, h := b.Width(), b.Height()
+	fresh := r.light == nil || r.width != w || r.height != h
+	if fresh {
+		r.light = make([]float64, w*h*3)
+		r.width, r.height = w, h
+	}
+	keep := r.Options.Persistence
+	fading, _ := b.(Fading)
+	off := r.Palette[0]
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := r.Palette[b.Pixel(x, y)&0x3]
+			colors := [3]float64{float64(c.R), float64(c.G), float64(c.B)}
+			if fading != nil {
+				l := fading.Light(x, y)
+				for ch, v := range [3]float64{float64(off.R), float64(off.G), float64(off.B)} {
+					colors[ch] = v + (colors[ch]-v)*l
+				}
+			}
+			i := (y*w + x) * 3
+			for ch, target := range colors {
+				if fresh || r.light[i+ch] <= target {
+					r.light[i+ch] = target
+				} else {
+					r.light[i+ch] = target + (r.light[i+ch]-target)*keep
+				}
+			}
+		}
+	}
+}
+
+// shade is how much darker the image pixel at px, py is made by scanlines
+// and the screen edge, following the display fragment shader.
+func (r *Renderer) shade(px, py, iw, ih int) float64 {
+	// Distance from the center, doubled, as in the shader's fragCoord.
+	fx := math.Abs(float64(2*px+1) - float64(iw))
+	fy := math.Abs(float64(2*py+1) - float64(ih))
+
+	dark := r.Options.Scanlines * math.Abs(math.Sin(fy))
+	if r.Options.Curvature > 0 {
+		w := float64(iw)
+		dark += math.Pow(fx/w, 70) + math.Pow((fy+w-float64(ih))/w, 70)
+	}
+	return min(dark, 1)
+}
+
+func clamp(v float64) uint8 {
+	return uint8(min(max(v, 0), 255))
+}
@@ -0,0 +1,111 @@
+package render
+
+import (
+	"image/color"
+	"testing"
+)
+
+// bitmap is a test display with every pixel lit that is set in lit.
+type bitmap struct {
+	w, h int
+	lit  map[[2]int]uint8
+}
+
+func (b bitmap) Width() int  { return b.w }
+func (b bitmap) Height() int { return b.h }
+
+func (b bitmap) Pixel(x, y int) uint8 {
+	return b.lit[[2]int{x, y}]
+}
+
+var testPalette = Palette{RGB(0x000000), RGB(0xFFFFFF), RGB(0xFF0000), RGB(0x0000FF)}
+
+func TestRenderScale(t *testing.T) {
+	b := bitmap{w: 4, h: 2, lit: map[[2]int]uint8{{1, 0}: 1, {2, 1}: 3}}
+	img := Render(b, testPalette, Options{Scale: 3})
+
+	if got := img.Bounds().Size(); got.X != 12 || got.Y != 6 {
+		t.Fatalf("image is %v, want 12x6", got)
+	}
+	tests := []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{0, 0, testPalette[0]},
+		{3, 0, testPalette[1]},
+		{5, 2, testPalette[1]},
+		{6, 3, testPalette[3]},
+		{11, 5, testPalette[0]},
+	}
+	for _, test := range tests {
+		if got := img.RGBAAt(test.x, test.y); got != test.want {
+			t.Errorf("pixel (%d, %d) = %v, want %v", test.x, test.y, got, test.want)
+		}
+	}
+}
+
+func TestRenderGrid(t *testing.T) {
+	b := bitmap{w: 1, h: 1, lit: map[[2]int]uint8{{0, 0}: 1}}
+	img := Render(b, testPalette, Options{Scale: 4, Grid: true})
+	if got := img.RGBAAt(0, 2).R; got != uint8(255*GRID_SHADE) {
+		t.Errorf("grid line = %d, want %d", got, uint8(255*GRID_SHADE))
+	}
+	if got := img.RGBAAt(2, 2).R; got != 255 {
+		t.Errorf("pixel inside the grid = %d, want 255", got)
+	}
+}
+
+func TestRenderPersistence(t *testing.T) {
+	r := NewRenderer(testPalette, Options{Persistence: 0.5})
+	on := bitmap{w: 1, h: 1, lit: map[[2]int]uint8{{0, 0}: 1}}
+	off := bitmap{w: 1, h: 1}
+
+	r.Render(on)
+	for _, want := range []uint8{127, 63, 31} {
+		if got := r.Render(off).RGBAAt(0, 0).R; got != want {
+			t.Errorf("fading pixel = %d, want %d", got, want)
+		}
+	}
+	if got := r.Render(on).RGBAAt(0, 0).R; got != 255 {
+		t.Errorf("pixel lit again = %d, want 255", got)
+	}
+
+	// A stateless render doesn't remember anything.
+	if got := Render(off, testPalette, r.Options).RGBAAt(0, 0).R; got != 0 {
+		t.Errorf("stateless render = %d, want 0", got)
+	}
+}
+
+func TestRenderCurvature(t *testing.T) {
+	b := bitmap{w: 8, h: 4, lit: map[[2]int]uint8{}}
+	for x := 0; x < 8; x++ {
+		for y := 0; y < 4; y++ {
+			b.lit[[2]int{x, y}] = 1
+		}
+	}
+	img := Render(b, testPalette, Options{Scale: 8, Curvature: 0.2})
+	if got := img.RGBAAt(0, 0); got != (color.RGBA{A: 0xFF}) {
+		t.Errorf("corner of a curved screen = %v, want black", got)
+	}
+	if got := img.RGBAAt(32, 16); got != testPalette[1] {
+		t.Errorf("center of a curved screen = %v, want %v", got, testPalette[1])
+	}
+}
+
+// fading is a bitmap with every lit pixel at the same light.
+type fading struct {
+	bitmap
+	light float64
+}
+
+func (f fading) Light(x, y int) float64 {
+	return f.light
+}
+
+func TestRenderFading(t *testing.T) {
+	b := fading{bitmap{w: 1, h: 1, lit: map[[2]int]uint8{{0, 0}: 2}}, 0.5}
+	palette := Palette{RGB(0x000000), RGB(0xFFFFFF), RGB(0x804020), RGB(0x0000FF)}
+	if got := Render(b, palette, Options{}).RGBAAt(0, 0); got != RGB(0x402010) {
+		t.Errorf("half lit pixel = %v, want %v", got, RGB(0x402010))
+	}
+}
@@ -0,0 +1,243 @@
+package chip8
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const (
+	REWIND_FRAMES = 60 * 60
+	REWIND_BUDGET = 4 * 1024 * 1024
+	// Runs of changed bytes closer than this are merged into one run.
+	rewindRunGap = 8
+	// Approximate bookkeeping cost of a run on top of its data.
+	rewindRunOverhead = 32
+)
+
+type rewindRun struct {
+	offset int
+	data   []byte
+}
+
+// rewindDelta turns a frame's state back into the one before it. It only
+// holds the older bytes that changed, unless the state changed size.
+type rewindDelta struct {
+	size int
+	runs []rewindRun
+	cost int
+}
+
+// RewindBuffer is a ring buffer of per-frame deltas bounded both by frame
+// count and by a memory budget in bytes. The budget covers the deltas and
+// the copy of the latest state they are applied to.
+type RewindBuffer struct {
+	deltas  []rewindDelta
+	head    int
+	count   int
+	used    int
+	budget  int
+	current []byte
+}
+
+func NewRewindBuffer(frames, budget int) *RewindBuffer {
+	return &RewindBuffer{
+		deltas: make([]rewindDelta, frames),
+		budget: budget,
+	}
+}
+
+func (r *RewindBuffer) SetBudget(budget int) {
+	r.budget = budget
+	r.evict()
+}
+
+func (r *RewindBuffer) GetBudget() int {
+	return r.budget
+}
+
+// Enabled reports whether pushed states are kept at all.
+func (r *RewindBuffer) Enabled() bool {
+	return r.budget > 0 && len(r.deltas) > 0
+}
+
+// Frames returns how many frames can currently be rewound.
+func (r *RewindBuffer) Frames() int {
+	return r.count
+}
+
+func (r *RewindBuffer) Used() int {
+	return r.used
+}
+
+func (r *RewindBuffer) Reset() {
+	for i := range r.deltas {
+		r.deltas[i] = rewindDelta{}
+	}
+	r.head = 0
+	r.count = 0
+	r.used = 0
+	r.current = nil
+}
+
+// Push records the state of a new frame, given as parts that are read as
+// if they were joined. The parts are compared against the previous state
+// where they are and not kept.
+func (r *RewindBuffer) Push(parts ...[]byte) {
+	if !r.Enabled() {
+		return
+	}
+	size := 0
+	for _, part := range parts {
+		size += len(part)
+	}
+	if size > r.budget {
+		r.Reset()
+		return
+	}
+	if r.current == nil {
+		r.setCurrent(size, parts)
+		return
+	}
+
+	delta := r.diff(size, parts)
+	if delta.cost+size > r.budget {
+		r.Reset()
+		r.setCurrent(size, parts)
+		return
+	}
+
+	if r.count == len(r.deltas) {
+		r.dropOldest()
+	}
+	r.deltas[(r.head+r.count)%len(r.deltas)] = delta
+	r.count++
+	r.used += delta.cost
+	r.evict()
+}
+
+// Pop steps back up to frames frames and returns the state reached and the
+// number of frames actually rewound. The state is only valid until the next
+// Push or Pop.
+func (r *RewindBuffer) Pop(frames int) ([]byte, int) {
+	rewound := 0
+	for rewound < frames && r.count > 0 {
+		i := (r.head + r.count - 1) % len(r.deltas)
+		r.used -= len(r.current)
+		r.current = applyDelta(r.current, r.deltas[i])
+		r.used += len(r.current)
+		r.used -= r.deltas[i].cost
+		r.deltas[i] = rewindDelta{}
+		r.count--
+		rewound++
+	}
+	return r.current, rewound
+}
+
+func (r *RewindBuffer) evict() {
+	for r.count > 0 && r.used > r.budget {
+		r.dropOldest()
+	}
+	if r.used > r.budget {
+		r.Reset()
+	}
+}
+
+func (r *RewindBuffer) dropOldest() {
+	r.used -= r.deltas[r.head].cost
+	r.deltas[r.head] = rewindDelta{}
+	r.head = (r.head + 1) % len(r.deltas)
+	r.count--
+}
+
+func (r *RewindBuffer) setCurrent(size int, parts [][]byte) {
+	r.used -= len(r.current)
+	r.current = make([]byte, 0, size)
+	for _, part := range parts {
+		r.current = append(r.current, part...)
+	}
+	r.used += size
+}
+
+// diff returns the delta from the new state back to the current one and
+// makes the new state current.
+func (r *RewindBuffer) diff(size int, parts [][]byte) rewindDelta {
+	older := r.current
+	if len(older) != size {
+		r.setCurrent(size, parts)
+		return rewindDelta{
+			size: len(older),
+			runs: []rewindRun{{offset: 0, data: older}},
+			cost: len(older) + rewindRunOverhead,
+		}
+	}
+
+	delta := rewindDelta{size: size}
+	offset := 0
+	for _, part := range parts {
+		diffRuns(&delta, older[offset:offset+len(part)], part, offset)
+		offset += len(part)
+	}
+	return delta
+}
+
+// diffRuns adds the runs of older that differ from newer to delta and
+// copies them over from newer. Equal blocks are skipped whole.
+func diffRuns(delta *rewindDelta, older, newer []byte, offset int) {
+	const block = 64
+	for i := 0; i < len(older); {
+		if end := min(i+block, len(older)); bytes.Equal(older[i:end], newer[i:end]) {
+			i = end
+			continue
+		}
+		for ; i < len(older) && older[i] == newer[i]; i++ {
+		}
+		if i == len(older) {
+			break
+		}
+		start, end := i, i+1
+		for j := end; j < len(older) && j < end+rewindRunGap; j++ {
+			if older[j] != newer[j] {
+				end = j + 1
+			}
+		}
+		data := make([]byte, end-start)
+		copy(data, older[start:end])
+		copy(older[start:end], newer[start:end])
+		delta.runs = append(delta.runs, rewindRun{offset: offset + start, data: data})
+		delta.cost += len(data) + rewindRunOverhead
+		i = end
+	}
+}
+
+// applyDelta turns state into the one before it, in place when the size
+// did not change.
+func applyDelta(state []byte, delta rewindDelta) []byte {
+	older := state
+	if len(state) != delta.size {
+		older = make([]byte, delta.size)
+	}
+	for _, run := range delta.runs {
+		copy(older[run.offset:], run.data)
+	}
+	return older
+}
+
+// pushRewind records the frame in the rewind buffer, laid out as
+// machineState.marshal would. Memory and the display are diffed where they
+// are instead of being copied first.
+func (e *Chip8Emulator) pushRewind() {
+	registers := e.captureRegisters()
+	buf, err := binary.Append(e.rewindRegisters[:0], binary.BigEndian, &registers)
+	if err != nil {
+		e.rewind.Reset()
+		return
+	}
+	e.rewindRegisters = buf
+
+	parts := append(e.rewindParts[:0], buf, e.memory)
+	for x := range e.display.pixels {
+		parts = append(parts, e.display.pixels[x][:])
+	}
+	e.rewindParts = parts
+	e.rewind.Push(parts...)
+}
@@ -0,0 +1,150 @@
+package chip8
+
+import (
+	"bytes"
+	"testing"
+)
+
+// rewindStates returns count states of size bytes, each changing one byte
+// of the one before.
+func rewindStates(count, size int) [][]byte {
+	states := make([][]byte, count)
+	for i := range states {
+		states[i] = make([]byte, size)
+		if i > 0 {
+			copy(states[i], states[i-1])
+			states[i][i*7%size]++
+		}
+	}
+	return states
+}
+
+func TestRewindRoundTrip(t *testing.T) {
+	r := NewRewindBuffer(10, 1024)
+	states := rewindStates(5, 100)
+	for _, s := range states {
+		// Parts are read as if they were joined.
+		r.Push(s[:30], s[30:])
+	}
+	if r.Frames() != 4 {
+		t.Fatalf("Frames() = %d, want 4", r.Frames())
+	}
+
+	for _, pop := range []struct {
+		frames  int
+		rewound int
+		want    int
+	}{
+		{1, 1, 3},
+		{2, 2, 1},
+		{10, 1, 0},
+		{1, 0, 0},
+	} {
+		got, rewound := r.Pop(pop.frames)
+		if rewound != pop.rewound {
+			t.Errorf("Pop(%d) rewound %d frames, want %d", pop.frames, rewound, pop.rewound)
+		}
+		if !bytes.Equal(got, states[pop.want]) {
+			t.Errorf("Pop(%d) did not return state %d", pop.frames, pop.want)
+		}
+	}
+	if r.Used() != 100 {
+		t.Errorf("Used() = %d, want only the current state", r.Used())
+	}
+}
+
+func TestRewindSizeChange(t *testing.T) {
+	r := NewRewindBuffer(10, 1024)
+	small := bytes.Repeat([]byte{1}, 100)
+	r.Push(small)
+	r.Push(bytes.Repeat([]byte{2}, 120))
+
+	got, rewound := r.Pop(1)
+	if rewound != 1 || !bytes.Equal(got, small) {
+		t.Errorf("Pop(1) = %d bytes after %d frames, want the 100 byte state", len(got), rewound)
+	}
+}
+
+func TestRewindBudgetEviction(t *testing.T) {
+	// The current state and two one byte deltas fit.
+	delta := 1 + rewindRunOverhead
+	r := NewRewindBuffer(10, 100+2*delta)
+	states := rewindStates(5, 100)
+	for _, s := range states {
+		r.Push(s)
+	}
+	if r.Frames() != 2 {
+		t.Errorf("Frames() = %d, want 2", r.Frames())
+	}
+	if r.Used() != 100+2*delta {
+		t.Errorf("Used() = %d, want %d", r.Used(), 100+2*delta)
+	}
+
+	got, rewound := r.Pop(5)
+	if rewound != 2 || !bytes.Equal(got, states[2]) {
+		t.Errorf("Pop(5) rewound %d frames, want 2 back to state 2", rewound)
+	}
+
+	// Lowering the budget evicts the oldest deltas.
+	r.Push(states[3])
+	r.Push(states[4])
+	r.SetBudget(100 + delta)
+	if r.Frames() != 1 {
+		t.Errorf("Frames() = %d after lowering the budget, want 1", r.Frames())
+	}
+}
+
+func TestRewindDeltaOverBudget(t *testing.T) {
+	r := NewRewindBuffer(10, 150)
+	r.Push(bytes.Repeat([]byte{1}, 100))
+	r.Push(bytes.Repeat([]byte{1}, 100))
+	if r.Frames() != 1 {
+		t.Fatalf("Frames() = %d, want 1", r.Frames())
+	}
+
+	// A delta of every byte does not fit next to the state, so the history
+	// starts over from the new state.
+	changed := bytes.Repeat([]byte{2}, 100)
+	r.Push(changed)
+	if r.Frames() != 0 {
+		t.Errorf("Frames() = %d, want 0", r.Frames())
+	}
+	if r.Used() != 100 {
+		t.Errorf("Used() = %d, want 100", r.Used())
+	}
+	if got, rewound := r.Pop(1); rewound != 0 || !bytes.Equal(got, changed) {
+		t.Errorf("Pop(1) rewound %d frames, want to stay on the new state", rewound)
+	}
+
+	// States larger than the budget are not kept at all.
+	r.Push(make([]byte, 200))
+	if r.Used() != 0 {
+		t.Errorf("Used() = %d after a state over budget, want 0", r.Used())
+	}
+}
+
+func TestRewindEmulator(t *testing.T) {
+	e := NewChip8Emulator(Hooks{}, QuirksCosmacVIP)
+	e.SwapROM(counterRom)
+	runFrames(e, 5)
+	want := e.State()
+
+	runFrames(e, 5)
+	e.Rewind(5)
+	e.Pause()
+	e.Cycle(0)
+	if got := e.State(); got.PC != want.PC || got.V != want.V || got.Display != want.Display {
+		t.Errorf("rewound to %+v, want %+v", got.Registers, want.Registers)
+	}
+}
+
+func TestRewindDisabled(t *testing.T) {
+	e := NewChip8Emulator(Hooks{}, QuirksCosmacVIP)
+	e.SetRewindBudget(0)
+	e.SwapROM(counterRom)
+	runFrames(e, 5)
+
+	if e.GetRewindFrames() != 0 || e.rewind.current != nil {
+		t.Errorf("rewind kept %d frames with a budget of zero", e.GetRewindFrames())
+	}
+}
@@ -0,0 +1,81 @@
+package chip8
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// RomMetadata is what is known about a ROM beyond its bytes.
+type RomMetadata struct {
+	Title string `json:"title,omitempty"`
+	// Palette is applied when the ROM is loaded, nil keeps the palette in
+	// use.
+	Palette *Palette `json:"palette,omitempty"`
+}
+
+// RomDatabase holds the metadata of ROMs by the SHA-256 of their bytes, the
+// hash movies identify ROMs by.
+type RomDatabase map[[sha256.Size]byte]RomMetadata
+
+func (db RomDatabase) Add(rom []byte, m RomMetadata) {
+	db[sha256.Sum256(rom)] = m
+}
+
+func (db RomDatabase) Lookup(rom []byte) (RomMetadata, bool) {
+	m, ok := db[sha256.Sum256(rom)]
+	return m, ok
+}
+
+// ParseRomDatabase reads a JSON object of metadata keyed by the hex
+// SHA-256 of each ROM, e.g.
+//
+//	{"3b7c...": {"title": "Tetris", "palette": "gameboy"}}
+func ParseRomDatabase(data []byte) (RomDatabase, error) {
+	var entries map[string]RomMetadata
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	db := make(RomDatabase, len(entries))
+	for key, m := range entries {
+		hash, err := hex.DecodeString(key)
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("invalid ROM hash %q", key)
+		}
+		db[[sha256.Size]byte(hash)] = m
+	}
+	return db, nil
+}
+
+func (db RomDatabase) MarshalJSON() ([]byte, error) {
+	entries := make(map[string]RomMetadata, len(db))
+	for hash, m := range db {
+		entries[hex.EncodeToString(hash[:])] = m
+	}
+	return json.Marshal(entries)
+}
+
+// SetRomDatabase makes SwapROM apply the metadata found in db.
+func (e *Chip8Emulator) SetRomDatabase(db RomDatabase) {
+	e.EnqueueMessage(RomDatabaseMessage{db: db})
+}
+
+// AttachPalette stores p in the metadata of the running ROM, so it comes
+// back whenever the ROM is loaded, and applies it.
+func (e *Chip8Emulator) AttachPalette(p Palette) {
+	e.EnqueueMessage(AttachPaletteMessage{palette: p})
+}
+
+// GetRomMetadata returns the metadata of the running ROM.
+func (e *Chip8Emulator) GetRomMetadata() (RomMetadata, bool) {
+	return e.romDatabase.Lookup(e.GetRom())
+}
+
+// applyRomMetadata sets up the frontend for a ROM that was just loaded.
+func (e *Chip8Emulator) applyRomMetadata() {
+	m, ok := e.romDatabase.Lookup(e.GetRom())
+	if ok && m.Palette != nil {
+		e.setPalette(*m.Palette)
+	}
+}
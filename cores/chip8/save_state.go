@@ -0,0 +1,243 @@
+package chip8
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+const SAVE_STATE_VERSION = 3
+
+var saveStateMagic = [4]byte{'C', 'S', 'S', 'T'}
+
+var (
+	ErrInvalidSaveState  = errors.New("invalid save state")
+	ErrSaveStateVersion  = errors.New("unsupported save state version")
+	ErrSaveStateChecksum = errors.New("save state checksum mismatch")
+)
+
+// A save state is a header, the machine state payload and a CRC-32 of
+// everything before it. Every field is big endian.
+type saveStateHeader struct {
+	Magic   [4]byte
+	Version uint16
+	Length  uint32
+}
+
+type stateRegisters struct {
+	Quirks          Quirks
+	PC              uint16
+	I               uint16
+	V               [NUM_REGISTERS]uint8
+	RPL             [NUM_RPL_FLAGS]uint8
+	StackPointer    uint8
+	Stack           [STACK_SIZE]uint16
+	DelayTimer      uint8
+	SoundTimer      uint8
+	Keys            [NUM_KEYS]bool
+	LastKeyReleased uint8
+	IPF             uint32
+	Timing          Timing
+	VipBudget       int32
+	CycleCount      uint64
+	DrawCount       uint64
+	Hires           bool
+	Planes          uint8
+	Pitch           uint8
+	HasAudioPattern bool
+	AudioPattern    [AUDIO_PATTERN_SIZE]uint8
+	RomSize         uint32
+	MemorySize      uint32
+}
+
+type machineState struct {
+	registers stateRegisters
+	memory    []byte
+	pixels    [HIRES_SCREEN_WIDTH][HIRES_SCREEN_HEIGHT]uint8
+}
+
+// captureState copies the machine into s, reusing its memory buffer when
+// the size still fits.
+func (e *Chip8Emulator) captureState(s *machineState) {
+	s.registers = e.captureRegisters()
+	if len(s.memory) != len(e.memory) {
+		s.memory = make([]byte, len(e.memory))
+	}
+	copy(s.memory, e.memory)
+	s.pixels = e.display.pixels
+}
+
+func (e *Chip8Emulator) captureRegisters() stateRegisters {
+	r := stateRegisters{
+		Quirks:          e.quirks,
+		PC:              e.pc,
+		I:               e.i,
+		V:               e.v,
+		RPL:             e.rpl,
+		StackPointer:    uint8(e.stack.Pointer()),
+		DelayTimer:      e.delayTimer.GetTimer(),
+		SoundTimer:      e.soundTimer.GetTimer(),
+		Keys:            e.keyState.keys,
+		LastKeyReleased: e.keyState.lastKeyReleased,
+		IPF:             uint32(e.ipf),
+		Timing:          e.timing,
+		VipBudget:       int32(e.vip.budget),
+		CycleCount:      e.cycleCount,
+		DrawCount:       e.drawCount,
+		Hires:           e.display.hires,
+		Planes:          e.planes,
+		Pitch:           e.pitch,
+		HasAudioPattern: e.audioPattern != nil,
+		RomSize:         uint32(e.lastRomSize),
+		MemorySize:      uint32(len(e.memory)),
+	}
+	copy(r.Stack[:], e.stack.Contents())
+	copy(r.AudioPattern[:], e.audioPattern)
+	return r
+}
+
+// restoreState replaces the machine with s. The stack is restored first, so
+// a state it rejects leaves the machine as it was.
+func (e *Chip8Emulator) restoreState(s *machineState) error {
+	r := &s.registers
+	if err := e.stack.Restore(r.Stack[:], int(r.StackPointer)); err != nil {
+		return err
+	}
+	e.setQuirks(r.Quirks)
+	copy(e.memory, s.memory)
+	e.display.pixels = s.pixels
+	e.display.hires = r.Hires
+	e.planes = r.Planes
+	e.pc = r.PC
+	e.i = r.I
+	e.v = r.V
+	e.rpl = r.RPL
+	e.delayTimer.SetTimer(r.DelayTimer)
+	e.soundTimer.timer = r.SoundTimer
+	e.keyState.keys = r.Keys
+	e.keyState.lastKeyReleased = r.LastKeyReleased
+	e.ipf = int(r.IPF)
+	e.timing = r.Timing
+	e.vip = vipTiming{budget: int(r.VipBudget)}
+	e.cycleCount = r.CycleCount
+	e.drawCount = r.DrawCount
+	e.lastRomSize = int(r.RomSize)
+	e.fault = nil
+
+	var pattern []uint8
+	if r.HasAudioPattern {
+		pattern = append(pattern, r.AudioPattern[:]...)
+	}
+	e.setAudio(pattern, r.Pitch)
+
+	if e.soundTimer.GetTimer() > 0 && !e.paused {
+		e.soundTimer.Resume(e.hooks.PlaySound)
+	} else if e.hooks.StopSound != nil {
+		e.hooks.StopSound()
+	}
+	return nil
+}
+
+func (s *machineState) marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.BigEndian, &s.registers); err != nil {
+		return nil, err
+	}
+	buf.Write(s.memory)
+	if err := binary.Write(&buf, binary.BigEndian, &s.pixels); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func unmarshalState(data []byte) (*machineState, error) {
+	s := &machineState{}
+	r := bytes.NewReader(data)
+	if err := binary.Read(r, binary.BigEndian, &s.registers); err != nil {
+		return nil, ErrInvalidSaveState
+	}
+
+	size := int(s.registers.MemorySize)
+	if size != s.registers.Quirks.Platform.MemorySize() ||
+		int(s.registers.RomSize) > size-ROM_START_ADDRESS ||
+		int(s.registers.StackPointer) > STACK_SIZE {
+		return nil, ErrInvalidSaveState
+	}
+
+	s.memory = make([]byte, size)
+	if _, err := io.ReadFull(r, s.memory); err != nil {
+		return nil, ErrInvalidSaveState
+	}
+	if err := binary.Read(r, binary.BigEndian, &s.pixels); err != nil {
+		return nil, ErrInvalidSaveState
+	}
+	if r.Len() != 0 {
+		return nil, ErrInvalidSaveState
+	}
+	return s, nil
+}
+
+// SaveState serializes the machine as it was at the end of the last frame.
+// It is safe to call from any goroutine.
+func (e *Chip8Emulator) SaveState() ([]byte, error) {
+	e.stateMu.Lock()
+	payload, err := e.saved.marshal()
+	e.stateMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	header := saveStateHeader{
+		Magic:   saveStateMagic,
+		Version: SAVE_STATE_VERSION,
+		Length:  uint32(len(payload)),
+	}
+	if err := binary.Write(&buf, binary.BigEndian, &header); err != nil {
+		return nil, err
+	}
+	buf.Write(payload)
+	if err := binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(buf.Bytes())); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// LoadState validates a save state and queues it to be applied before the
+// next frame.
+func (e *Chip8Emulator) LoadState(data []byte) error {
+	state, err := decodeSaveState(data)
+	if err != nil {
+		return err
+	}
+	e.EnqueueMessage(LoadStateMessage{state: state})
+	return nil
+}
+
+func decodeSaveState(data []byte) (*machineState, error) {
+	var header saveStateHeader
+	headerSize := binary.Size(header)
+	if len(data) < headerSize+4 {
+		return nil, ErrInvalidSaveState
+	}
+	if err := binary.Read(bytes.NewReader(data), binary.BigEndian, &header); err != nil {
+		return nil, ErrInvalidSaveState
+	}
+	if header.Magic != saveStateMagic {
+		return nil, ErrInvalidSaveState
+	}
+	if header.Version != SAVE_STATE_VERSION {
+		return nil, ErrSaveStateVersion
+	}
+	if int(header.Length) != len(data)-headerSize-4 {
+		return nil, ErrInvalidSaveState
+	}
+
+	body := data[:len(data)-4]
+	if binary.BigEndian.Uint32(data[len(data)-4:]) != crc32.ChecksumIEEE(body) {
+		return nil, ErrSaveStateChecksum
+	}
+	return unmarshalState(body[headerSize:])
+}
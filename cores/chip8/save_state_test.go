@@ -0,0 +1,133 @@
+package chip8
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// counterRom counts in v0 and draws the digit of v1, counting frames, so
+// every frame changes registers, memory and the display.
+var counterRom = []byte{
+	0x70, 0x01, // 0x200: v0 += 1
+	0x00, 0xE0, // 0x202: clear
+	0xF1, 0x29, // 0x204: i := hex v1
+	0xD2, 0x25, // 0x206: sprite v2 v2 5
+	0xA3, 0x00, // 0x208: i := 0x300
+	0xF0, 0x55, // 0x20A: save v0
+	0x71, 0x01, // 0x20C: v1 += 1
+	0x12, 0x00, // 0x20E: jump 0x200
+}
+
+func TestSaveStateRoundTrip(t *testing.T) {
+	e := NewChip8Emulator(Hooks{}, QuirksCosmacVIP)
+	e.SwapROM(counterRom)
+	runFrames(e, 5)
+
+	saved, err := e.SaveState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := e.State()
+	wantMemory := e.memory[0x300]
+
+	runFrames(e, 5)
+	if e.State().PC == want.PC && e.State().V == want.V {
+		t.Fatal("machine did not change after the save")
+	}
+
+	if err := e.LoadState(saved); err != nil {
+		t.Fatal(err)
+	}
+	e.Pause()
+	e.Cycle(0)
+
+	got := e.State()
+	if got.PC != want.PC || got.I != want.I || got.V != want.V {
+		t.Errorf("registers = %+v, want %+v", got.Registers, want.Registers)
+	}
+	if got.Display != want.Display {
+		t.Error("display was not restored")
+	}
+	if e.memory[0x300] != wantMemory {
+		t.Errorf("memory at 0x300 = %d, want %d", e.memory[0x300], wantMemory)
+	}
+}
+
+func TestSaveStateChecksum(t *testing.T) {
+	e := NewChip8Emulator(Hooks{}, QuirksCosmacVIP)
+	e.SwapROM(counterRom)
+	runFrames(e, 2)
+	saved, err := e.SaveState()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved[len(saved)/2] ^= 0xFF
+	if err := e.LoadState(saved); err != ErrSaveStateChecksum {
+		t.Errorf("LoadState returned %v, want %v", err, ErrSaveStateChecksum)
+	}
+}
+
+func TestSaveStateVersion(t *testing.T) {
+	e := NewChip8Emulator(Hooks{}, QuirksCosmacVIP)
+	saved, err := e.SaveState()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	binary.BigEndian.PutUint16(saved[4:], SAVE_STATE_VERSION+1)
+	if err := e.LoadState(saved); err != ErrSaveStateVersion {
+		t.Errorf("LoadState returned %v, want %v", err, ErrSaveStateVersion)
+	}
+}
+
+func TestSaveStateWhileRunning(t *testing.T) {
+	e := NewChip8Emulator(Hooks{}, QuirksCosmacVIP)
+	e.SwapROM(counterRom)
+	e.Resume()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- e.Run(ctx)
+	}()
+
+	// Saving reads the end of frame copy, never the running machine.
+	deadline := time.Now().Add(5 * time.Second)
+	for e.State().Frame < 5 {
+		if time.Now().After(deadline) {
+			t.Fatal("emulator did not run 5 frames")
+		}
+		saved, err := e.SaveState()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := decodeSaveState(saved); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	<-done
+}
+
+func TestRestoreStateBadStack(t *testing.T) {
+	e := NewChip8Emulator(Hooks{}, QuirksCosmacVIP)
+	e.SwapROM(counterRom)
+	runFrames(e, 2)
+
+	var s machineState
+	e.captureState(&s)
+	s.registers.PC = 0x400
+	s.registers.StackPointer = STACK_SIZE + 1
+	want := e.State()
+	if err := e.restoreState(&s); err == nil {
+		t.Fatal("restored a state with the stack pointer past the stack")
+	}
+	if e.pc != want.PC || e.v != want.V {
+		t.Errorf("registers changed to pc %X, v %v on a failed restore", e.pc, e.v)
+	}
+}
@@ -0,0 +1,69 @@
+package chip8
+
+const (
+	FRAME_RATE = 60
+	// MAX_CATCHUP_FRAMES is the most frames run for a single host frame.
+	// Time beyond that is dropped, so a stalled host doesn't make the
+	// emulator race to catch up afterwards.
+	MAX_CATCHUP_FRAMES = 4
+)
+
+// FRAME_TIME is the length of a frame in milliseconds.
+const FRAME_TIME = 1000.0 / FRAME_RATE
+
+// Scheduler runs the emulator at a steady 60 frames a second however often
+// the host calls it, e.g. from requestAnimationFrame on a 144 Hz display.
+// Every emulated frame runs one batch of instructions and one timer tick.
+type Scheduler struct {
+	e       *Chip8Emulator
+	started bool
+	last    float64
+	// lag is the time that passed and has not been emulated yet.
+	lag     float64
+	dropped uint64
+}
+
+func NewScheduler(e *Chip8Emulator) *Scheduler {
+	return &Scheduler{e: e}
+}
+
+// Advance runs the frames that are due at now, in milliseconds. It returns
+// false when a decode hook stopped the emulator.
+func (s *Scheduler) Advance(now float64) bool {
+	if !s.started {
+		// Run the first frame right away.
+		s.started = true
+		s.last = now
+		s.lag = FRAME_TIME
+	}
+	s.lag = max(s.lag+now-s.last, 0)
+	s.last = now
+
+	frames := int(s.lag / FRAME_TIME)
+	if frames > MAX_CATCHUP_FRAMES {
+		s.dropped += uint64(frames - MAX_CATCHUP_FRAMES)
+		s.lag -= float64(frames-MAX_CATCHUP_FRAMES) * FRAME_TIME
+		frames = MAX_CATCHUP_FRAMES
+	}
+	for ; frames > 0; frames-- {
+		s.lag -= FRAME_TIME
+		if !s.e.Cycle(now) {
+			return false
+		}
+	}
+	return true
+}
+
+// Until returns the milliseconds until the next frame is due.
+func (s *Scheduler) Until() float64 {
+	return FRAME_TIME - s.lag
+}
+
+// Dropped counts the frames skipped because the host fell too far behind.
+func (s *Scheduler) Dropped() uint64 {
+	return s.dropped
+}
+
+func (s *Scheduler) Reset() {
+	*s = Scheduler{e: s.e}
+}
@@ -0,0 +1,43 @@
+package chip8
+
+import "testing"
+
+func TestSchedulerHostRates(t *testing.T) {
+	for _, hz := range []float64{30, 60, 144} {
+		e := NewChip8Emulator(Hooks{}, QuirksCosmacVIP)
+		e.SwapROM([]byte{0x12, 0x00})
+		e.Resume()
+		s := NewScheduler(e)
+		for frame := 0; frame <= int(hz); frame++ {
+			if !s.Advance(float64(frame) * 1000 / hz) {
+				t.Fatal("Advance stopped")
+			}
+		}
+		// One second of host frames, plus the frame run on the first call.
+		if got := e.GetDrawCount(); got < 60 || got > 61 {
+			t.Errorf("%v Hz host ran %d frames in a second, want 60", hz, got)
+		}
+		if s.Dropped() != 0 {
+			t.Errorf("%v Hz host dropped %d frames", hz, s.Dropped())
+		}
+	}
+}
+
+func TestSchedulerCatchUp(t *testing.T) {
+	e := NewChip8Emulator(Hooks{}, QuirksCosmacVIP)
+	s := NewScheduler(e)
+	s.Advance(0)
+	frames := e.GetDrawCount()
+
+	// A second long stall only catches up MAX_CATCHUP_FRAMES frames.
+	s.Advance(1010)
+	if got := e.GetDrawCount() - frames; got != MAX_CATCHUP_FRAMES {
+		t.Errorf("ran %d frames after a stall, want %d", got, MAX_CATCHUP_FRAMES)
+	}
+	if got := s.Dropped(); got != 60-MAX_CATCHUP_FRAMES {
+		t.Errorf("dropped %d frames, want %d", got, 60-MAX_CATCHUP_FRAMES)
+	}
+	if until := s.Until(); until <= 0 || until > FRAME_TIME {
+		t.Errorf("next frame due in %vms", until)
+	}
+}
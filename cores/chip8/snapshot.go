@@ -0,0 +1,114 @@
+package chip8
+
+import (
+	"context"
+	"time"
+)
+
+// State is a snapshot of the emulator taken at the end of every frame. The
+// Get methods read the live machine and are only safe on the goroutine
+// driving it, State can be called from any goroutine.
+type State struct {
+	Registers
+	Opcode  uint16
+	Display Display
+	Fps     float64
+	Paused  bool
+	// Fault is a copy of the fault that halted the emulator, if any.
+	Fault     *EmulatorError
+	Quirks    Quirks
+	IPF       int
+	Timing    Timing
+	Deflicker Deflicker
+	RomSize   int
+}
+
+func (e *Chip8Emulator) publishState() {
+	s := State{
+		Registers: e.GetRegisters(),
+		Opcode:    e.GetOpCode(),
+		Display:   e.display,
+		Fps:       e.fps.GetFps(),
+		Paused:    e.paused,
+		Quirks:    e.quirks,
+		IPF:       e.ipf,
+		Timing:    e.timing,
+		Deflicker: e.deflicker,
+		RomSize:   e.lastRomSize,
+	}
+	// The stack slice points into the live stack.
+	s.Stack = append([]uint16(nil), s.Stack...)
+	if e.fault != nil {
+		fault := *e.fault
+		s.Fault = &fault
+	}
+
+	e.stateMu.Lock()
+	e.state = s
+	e.captureState(&e.saved)
+	e.stateMu.Unlock()
+}
+
+// State returns the machine as it was at the end of the last frame.
+func (e *Chip8Emulator) State() State {
+	e.stateMu.Lock()
+	defer e.stateMu.Unlock()
+	return e.state
+}
+
+// EnqueueMessage queues m for the start of the next frame, waiting for room
+// when the queue is full so the message is never lost. It must not be
+// called from the goroutine driving the emulator while the queue may be
+// full, input and other messages that may pile up go through
+// TryEnqueueMessage.
+func (e *Chip8Emulator) EnqueueMessage(m Message) {
+	e.messageChan <- m
+}
+
+// TryEnqueueMessage queues m for the start of the next frame without
+// blocking. When the queue is full the message is dropped, counted and
+// false returned.
+func (e *Chip8Emulator) TryEnqueueMessage(m Message) bool {
+	select {
+	case e.messageChan <- m:
+		return true
+	default:
+		e.droppedMessages.Add(1)
+		return false
+	}
+}
+
+// GetDroppedMessages counts the messages TryEnqueueMessage dropped because
+// the queue was full. It is safe to call from any goroutine.
+func (e *Chip8Emulator) GetDroppedMessages() uint64 {
+	return e.droppedMessages.Load()
+}
+
+// Run runs the emulator at 60 frames a second on the calling goroutine. It
+// returns ctx.Err() once ctx is done, the fault when the program faults
+// and nil when a decode hook stops the emulator.
+func (e *Chip8Emulator) Run(ctx context.Context) error {
+	s := NewScheduler(e)
+	start := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+		if !s.Advance(float64(time.Since(start).Microseconds()) / 1000) {
+			return nil
+		}
+		if e.fault != nil {
+			return e.fault
+		}
+		timer.Reset(time.Duration(s.Until() * float64(time.Millisecond)))
+	}
+}
+
+// Loop runs the emulator until it faults or a decode hook stops it.
+func (e *Chip8Emulator) Loop() {
+	e.Run(context.Background())
+}
@@ -0,0 +1,126 @@
+package chip8
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunCancel(t *testing.T) {
+	e := NewChip8Emulator(Hooks{}, QuirksCosmacVIP)
+	e.SwapROM([]byte{0x12, 0x00})
+	e.Resume()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- e.Run(ctx)
+	}()
+
+	// Snapshots are read while the emulator runs on another goroutine.
+	deadline := time.Now().Add(5 * time.Second)
+	for e.State().Frame < 5 {
+		if time.Now().After(deadline) {
+			t.Fatal("emulator did not run 5 frames")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if s := e.State(); s.Paused || s.PC != 0x200 {
+		t.Errorf("state = %+v", s.Registers)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run returned %v, want context.Canceled", err)
+	}
+}
+
+func TestRunFault(t *testing.T) {
+	e := NewChip8Emulator(Hooks{}, QuirksCosmacVIP)
+	e.SwapROM([]byte{0x00, 0xEE})
+	e.Resume()
+
+	var fault *EmulatorError
+	if err := e.Run(context.Background()); !errors.As(err, &fault) || fault.Kind != ErrStackUnderflow {
+		t.Fatalf("Run returned %v, want a stack underflow", err)
+	}
+	if s := e.State(); s.Fault == nil || s.Fault.PC != 0x200 || !s.Paused {
+		t.Errorf("state fault = %v, paused = %v", s.Fault, s.Paused)
+	}
+}
+
+func TestTryEnqueueMessageDrops(t *testing.T) {
+	e := NewChip8Emulator(Hooks{}, QuirksCosmacVIP)
+	// The constructor already queued a pause.
+	for i := 1; i < MESSAGE_QUEUE_SIZE; i++ {
+		if !e.TryEnqueueMessage(ResumeMessage{}) {
+			t.Fatalf("message %d was dropped", i)
+		}
+	}
+	if e.TryEnqueueMessage(ResumeMessage{}) {
+		t.Error("a message was queued on a full queue")
+	}
+	if got := e.GetDroppedMessages(); got != 1 {
+		t.Errorf("dropped %d messages, want 1", got)
+	}
+}
+
+func TestEnqueueMessageWaits(t *testing.T) {
+	e := NewChip8Emulator(Hooks{}, QuirksCosmacVIP)
+	for e.TryEnqueueMessage(ResumeMessage{}) {
+	}
+
+	// A ROM swap sent to a full queue waits for room instead of being lost.
+	done := make(chan struct{})
+	go func() {
+		e.SwapROM([]byte{0x60, 0x2A, 0x12, 0x02})
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for e.State().V[0] != 0x2A {
+		if time.Now().After(deadline) {
+			t.Fatal("the ROM swap was not applied")
+		}
+		e.Cycle(0)
+		time.Sleep(time.Millisecond)
+	}
+	<-done
+	if got := e.GetDroppedMessages(); got != 1 {
+		t.Errorf("dropped %d messages, want only the one that found the queue full", got)
+	}
+}
+
+func TestInputNeverBlocks(t *testing.T) {
+	e := NewChip8Emulator(Hooks{}, QuirksCosmacVIP)
+	e.SwapROM([]byte{0x12, 0x00})
+
+	// Everything is queued from the goroutine that drives the emulator, so
+	// a blocking enqueue would hang here.
+	pokes := make(map[uint16]uint8)
+	for i := 0; i < 2*MESSAGE_QUEUE_SIZE; i++ {
+		pokes[uint16(0x300+i)] = uint8(i)
+	}
+	e.Poke(pokes)
+	queued := 0
+	for i := 0; i < 2*MESSAGE_QUEUE_SIZE; i++ {
+		if e.SetKeyState(uint8(i%NUM_KEYS), uint8(i%2)) {
+			queued++
+		}
+	}
+	if queued == 2*MESSAGE_QUEUE_SIZE {
+		t.Fatal("every key change fit in the queue")
+	}
+	if got, want := e.GetDroppedMessages(), uint64(2*MESSAGE_QUEUE_SIZE-queued); got != want {
+		t.Errorf("dropped %d messages, want %d", got, want)
+	}
+
+	for i := 0; i <= MESSAGE_QUEUE_SIZE/MESSAGES_PER_FRAME; i++ {
+		e.Cycle(0)
+	}
+	for i := 0; i < 2*MESSAGE_QUEUE_SIZE; i++ {
+		if e.memory[0x300+i] != uint8(i) {
+			t.Fatalf("memory at 0x%X = %d, want %d", 0x300+i, e.memory[0x300+i], i)
+		}
+	}
+}
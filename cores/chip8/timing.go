@@ -0,0 +1,167 @@
+package chip8
+
+// Timing selects how much code the emulator runs per frame.
+type Timing uint8
+
+const (
+	// TimingFixed runs IPF instructions per frame whatever they are.
+	TimingFixed Timing = iota
+	// TimingVIP gives every instruction the cost it has in the COSMAC VIP
+	// interpreter and runs as many as fit in a VIP frame.
+	TimingVIP
+)
+
+// The VIP counts in 1802 machine cycles of 8 clock cycles at 1.76064 MHz,
+// 3668 of them per 60 Hz frame. The CDP1861 steals 1024 of those for the
+// display DMA and its interrupt routine, which also runs the timers, takes
+// another 46. Instruction costs below are machine cycles.
+const (
+	VIP_FRAME_CYCLES     = 3668
+	VIP_DMA_CYCLES       = 1024
+	VIP_INTERRUPT_CYCLES = 46
+	VIP_FETCH_CYCLES     = 40
+	VIP_SKIP_CYCLES      = 4
+	// Opcodes the VIP interpreter does not have, e.g. SUPER-CHIP ones, are
+	// charged like an average instruction.
+	VIP_DEFAULT_CYCLES = 20
+)
+
+var timingNames = map[string]Timing{
+	"fixed": TimingFixed,
+	"vip":   TimingVIP,
+}
+
+func ParseTiming(name string) (Timing, bool) {
+	t, ok := timingNames[name]
+	return t, ok
+}
+
+func (t Timing) String() string {
+	if t == TimingVIP {
+		return "vip"
+	}
+	return "fixed"
+}
+
+// vipCycles is the execution cost of each opcode the VIP interpreter
+// has, on top of VIP_FETCH_CYCLES. Draws, BCD and register loads and stores
+// are missing as their cost depends on their operands.
+var vipCycles = map[uint16]int{
+	0x00E0: 2072,
+	0x00EE: 10,
+	0x1000: 12,
+	0x2000: 26,
+	0x3000: 10,
+	0x4000: 10,
+	0x5000: 14,
+	0x6000: 6,
+	0x7000: 10,
+	0x8000: 44,
+	0x8001: 44,
+	0x8002: 44,
+	0x8003: 44,
+	0x8004: 44,
+	0x8005: 44,
+	0x8006: 44,
+	0x8007: 44,
+	0x800E: 44,
+	0x9000: 14,
+	0xA000: 12,
+	0xB000: 22,
+	0xC000: 36,
+	0xE09E: 14,
+	0xE0A1: 14,
+	0xF007: 10,
+	0xF00A: 10,
+	0xF015: 10,
+	0xF018: 10,
+	0xF01E: 16,
+	0xF029: 20,
+}
+
+// vipTiming is the cycle budget of the frame being run.
+type vipTiming struct {
+	// budget is what is left of the frame, negative when the last
+	// instruction ran over into the next one.
+	budget int
+	// last is the cost of the last instruction.
+	last int
+}
+
+// instructionCycles is the cost of opcode on the VIP, apart from the extra
+// cycles of a taken skip. It has to be called before the instruction runs.
+func (e *Chip8Emulator) instructionCycles(opcode uint16) int {
+	x := opcode >> 8 & 0xF
+	switch getOpKey(opcode) {
+	case 0xD000:
+		return VIP_FETCH_CYCLES + e.drawCycles(int(e.v[x]), int(opcode&0xF))
+	case 0xF033:
+		// Each digit is found by repeated subtraction.
+		v := e.v[x]
+		return VIP_FETCH_CYCLES + 80 + 16*int(v/100+v/10%10+v%10)
+	case 0xF055, 0xF065:
+		return VIP_FETCH_CYCLES + 14 + 14*int(x+1)
+	}
+	if cycles, ok := vipCycles[getOpKey(opcode)]; ok {
+		return VIP_FETCH_CYCLES + cycles
+	}
+	return VIP_FETCH_CYCLES + VIP_DEFAULT_CYCLES
+}
+
+// drawCycles is the cost of drawing rows of a sprite at column x. The VIP
+// shifts every row into place one bit at a time, and a sprite that is not
+// byte aligned touches two bytes of the display per row.
+func (e *Chip8Emulator) drawCycles(x, rows int) int {
+	if rows == 0 {
+		rows = 16
+	}
+	shift := x % 8
+	if shift == 0 {
+		return 26 + rows*20
+	}
+	return 26 + rows*(34+4*shift)
+}
+
+// chargeCycles takes the cost of the instruction that ran at pc from the
+// frame budget.
+func (e *Chip8Emulator) chargeCycles(pc, opcode uint16, cycles int) {
+	switch opcode >> 12 {
+	case 0x3, 0x4, 0x5, 0x9, 0xE:
+		if e.pc != pc+2 {
+			cycles += VIP_SKIP_CYCLES
+		}
+	}
+	e.vip.budget -= cycles
+	e.vip.last = cycles
+}
+
+// runVipFrame runs instructions until the frame's machine cycles are used
+// up. An instruction that runs over the end of the frame is paid from the
+// next one.
+func (e *Chip8Emulator) runVipFrame() bool {
+	e.vip.budget = min(e.vip.budget, 0) + VIP_FRAME_CYCLES - VIP_DMA_CYCLES - VIP_INTERRUPT_CYCLES
+	for e.vip.budget > 0 {
+		opcode, ok := e.cycle()
+		if !ok {
+			return false
+		}
+		if e.paused {
+			break
+		}
+		if opcode&0xF000 == 0xD000 && e.quirks.DisplayWait {
+			// DXYN first waits for the interrupt, so the rest of this
+			// frame is spent idle and the draw itself runs in the next.
+			e.vip.budget = -e.vip.last
+			break
+		}
+	}
+	return true
+}
+
+func (e *Chip8Emulator) SetTiming(t Timing) {
+	e.EnqueueMessage(TimingMessage{timing: t})
+}
+
+func (e *Chip8Emulator) GetTiming() Timing {
+	return e.timing
+}
@@ -0,0 +1,53 @@
+package chip8
+
+import "testing"
+
+func TestVipTiming(t *testing.T) {
+	e := NewChip8Emulator(Hooks{}, QuirksCosmacVIP)
+	e.SetTiming(TimingVIP)
+	e.SwapROM([]byte{
+		0x60, 0x01, // 0x200: v0 := 1, 46 cycles
+		0x12, 0x00, // 0x202: jump 0x200, 52 cycles
+	})
+	e.Resume()
+	e.Cycle(0)
+
+	// 2598 cycles fit 26 loops and the first half of the next, with 4
+	// cycles left for the jump that runs over.
+	if got := e.GetCycleCount(); got != 54 {
+		t.Errorf("ran %d instructions in a frame, want 54", got)
+	}
+	if e.vip.budget != -48 {
+		t.Errorf("budget = %d, want -48", e.vip.budget)
+	}
+
+	e.Cycle(0)
+	if got := e.GetCycleCount(); got != 54+53 {
+		t.Errorf("ran %d instructions in the second frame, want 53", got-54)
+	}
+}
+
+func TestVipDisplayWait(t *testing.T) {
+	e := NewChip8Emulator(Hooks{}, QuirksCosmacVIP)
+	e.SetTiming(TimingVIP)
+	e.SwapROM([]byte{
+		0xD0, 0x05, // 0x200: sprite v0 v0 5
+		0x12, 0x02, // 0x202: jump 0x202
+	})
+	e.Resume()
+	e.Cycle(0)
+
+	if got := e.GetCycleCount(); got != 1 {
+		t.Fatalf("ran %d instructions before the vblank wait, want 1", got)
+	}
+	// The draw is paid from the next frame.
+	if want := -(VIP_FETCH_CYCLES + 26 + 5*20); e.vip.budget != want {
+		t.Errorf("budget = %d, want %d", e.vip.budget, want)
+	}
+
+	e.SetTiming(TimingFixed)
+	e.Cycle(0)
+	if e.vip.budget != 0 {
+		t.Errorf("switching timing kept a budget of %d", e.vip.budget)
+	}
+}
@@ -0,0 +1,255 @@
+package chip8
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const TRACE_VERSION = 1
+
+var traceMagic = [4]byte{'C', 'S', 'T', 'R'}
+
+var ErrInvalidTrace = errors.New("invalid trace")
+
+type TraceFormat uint8
+
+const (
+	TraceText TraceFormat = iota
+	TraceBinary
+)
+
+// TraceRecord is the machine state just before an instruction runs. In the
+// binary format each record is written big endian as it is laid out here.
+type TraceRecord struct {
+	Cycle      uint64
+	PC         uint16
+	Opcode     uint16
+	I          uint16
+	V          [NUM_REGISTERS]uint8
+	DelayTimer uint8
+	SoundTimer uint8
+}
+
+// String renders the record as a line of the text format.
+func (r TraceRecord) String() string {
+	return fmt.Sprintf("%d pc=%04X op=%04X i=%04X v=%X dt=%02X st=%02X",
+		r.Cycle, r.PC, r.Opcode, r.I, r.V[:], r.DelayTimer, r.SoundTimer)
+}
+
+// ParseTraceRecord parses a line of the text format.
+func ParseTraceRecord(line string) (TraceRecord, error) {
+	var r TraceRecord
+	var v []byte
+	_, err := fmt.Sscanf(line, "%d pc=%X op=%X i=%X v=%X dt=%X st=%X",
+		&r.Cycle, &r.PC, &r.Opcode, &r.I, &v, &r.DelayTimer, &r.SoundTimer)
+	if err != nil || len(v) != NUM_REGISTERS {
+		return TraceRecord{}, fmt.Errorf("%w: bad line %q", ErrInvalidTrace, line)
+	}
+	copy(r.V[:], v)
+	return r, nil
+}
+
+// TraceFilter selects the instructions that are traced. A zero filter traces
+// everything.
+type TraceFilter struct {
+	// StartPC and EndPC limit tracing to an inclusive address range when
+	// EndPC is non-zero.
+	StartPC uint16
+	EndPC   uint16
+	// Classes is a bit mask of opcode classes, the high nibble of the
+	// opcode, to trace. Zero traces every class.
+	Classes uint16
+}
+
+func (f TraceFilter) matches(pc, opcode uint16) bool {
+	if f.EndPC != 0 && (pc < f.StartPC || pc > f.EndPC) {
+		return false
+	}
+	return f.Classes == 0 || f.Classes&(1<<(opcode>>12)) != 0
+}
+
+// Tracer writes a trace record for every instruction the emulator runs that
+// passes its filter. Write errors stop the trace and are kept for Err.
+type Tracer struct {
+	w      io.Writer
+	format TraceFormat
+	filter TraceFilter
+	header bool
+	err    error
+}
+
+func NewTracer(w io.Writer, format TraceFormat, filter TraceFilter) *Tracer {
+	return &Tracer{w: w, format: format, filter: filter}
+}
+
+func (t *Tracer) Trace(r TraceRecord) {
+	if t.err != nil || !t.filter.matches(r.PC, r.Opcode) {
+		return
+	}
+	if t.format == TraceText {
+		_, t.err = fmt.Fprintln(t.w, r)
+		return
+	}
+	if !t.header {
+		t.header = true
+		if t.err = binary.Write(t.w, binary.BigEndian, traceMagic); t.err != nil {
+			return
+		}
+		if t.err = binary.Write(t.w, binary.BigEndian, uint16(TRACE_VERSION)); t.err != nil {
+			return
+		}
+	}
+	t.err = binary.Write(t.w, binary.BigEndian, r)
+}
+
+// Err returns the first error writing the trace.
+func (t *Tracer) Err() error {
+	return t.err
+}
+
+// TraceReader reads a trace in either format, telling them apart by the
+// binary header.
+type TraceReader struct {
+	r      *bufio.Reader
+	format TraceFormat
+}
+
+func NewTraceReader(r io.Reader) (*TraceReader, error) {
+	t := &TraceReader{r: bufio.NewReader(r), format: TraceText}
+	magic, err := t.r.Peek(len(traceMagic))
+	if err != nil || !bytes.Equal(magic, traceMagic[:]) {
+		return t, nil
+	}
+	t.format = TraceBinary
+	t.r.Discard(len(traceMagic))
+	var version uint16
+	if err := binary.Read(t.r, binary.BigEndian, &version); err != nil {
+		return nil, ErrInvalidTrace
+	}
+	if version != TRACE_VERSION {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidTrace, version)
+	}
+	return t, nil
+}
+
+func (t *TraceReader) Format() TraceFormat {
+	return t.format
+}
+
+// Next returns the next record, or io.EOF at the end of the trace. Blank
+// lines in text traces are skipped.
+func (t *TraceReader) Next() (TraceRecord, error) {
+	var r TraceRecord
+	if t.format == TraceBinary {
+		err := binary.Read(t.r, binary.BigEndian, &r)
+		if err == io.ErrUnexpectedEOF {
+			err = fmt.Errorf("%w: truncated record", ErrInvalidTrace)
+		}
+		return r, err
+	}
+	for {
+		line, err := t.r.ReadString('\n')
+		if line = strings.TrimSpace(line); line != "" {
+			return ParseTraceRecord(line)
+		}
+		if err != nil {
+			return r, err
+		}
+	}
+}
+
+// TraceDivergence is the first pair of records two traces disagree on. A is
+// nil when the first trace ended early and B when the second one did.
+type TraceDivergence struct {
+	Index  int
+	A, B   *TraceRecord
+	Fields []string
+}
+
+func (d *TraceDivergence) String() string {
+	switch {
+	case d.A == nil:
+		return fmt.Sprintf("record %d: first trace ended, second has %v", d.Index, *d.B)
+	case d.B == nil:
+		return fmt.Sprintf("record %d: second trace ended, first has %v", d.Index, *d.A)
+	}
+	return fmt.Sprintf("record %d differs in %s:\n< %v\n> %v",
+		d.Index, strings.Join(d.Fields, ", "), *d.A, *d.B)
+}
+
+// DiffTraces compares two traces record by record and returns where they
+// first diverge, or nil if they are identical.
+func DiffTraces(a, b *TraceReader) (*TraceDivergence, error) {
+	for index := 0; ; index++ {
+		ra, errA := a.Next()
+		if errA != nil && errA != io.EOF {
+			return nil, errA
+		}
+		rb, errB := b.Next()
+		if errB != nil && errB != io.EOF {
+			return nil, errB
+		}
+		switch {
+		case errA == io.EOF && errB == io.EOF:
+			return nil, nil
+		case errA == io.EOF:
+			return &TraceDivergence{Index: index, B: &rb}, nil
+		case errB == io.EOF:
+			return &TraceDivergence{Index: index, A: &ra}, nil
+		}
+		if fields := diffRecords(ra, rb); len(fields) > 0 {
+			return &TraceDivergence{Index: index, A: &ra, B: &rb, Fields: fields}, nil
+		}
+	}
+}
+
+func diffRecords(a, b TraceRecord) []string {
+	var fields []string
+	if a.Cycle != b.Cycle {
+		fields = append(fields, "cycle")
+	}
+	if a.PC != b.PC {
+		fields = append(fields, "pc")
+	}
+	if a.Opcode != b.Opcode {
+		fields = append(fields, "opcode")
+	}
+	if a.I != b.I {
+		fields = append(fields, "i")
+	}
+	for i := range a.V {
+		if a.V[i] != b.V[i] {
+			fields = append(fields, fmt.Sprintf("v%x", i))
+		}
+	}
+	if a.DelayTimer != b.DelayTimer {
+		fields = append(fields, "dt")
+	}
+	if a.SoundTimer != b.SoundTimer {
+		fields = append(fields, "st")
+	}
+	return fields
+}
+
+func (e *Chip8Emulator) trace(pc, opcode uint16) {
+	e.tracer.Trace(TraceRecord{
+		Cycle:      e.cycleCount,
+		PC:         pc,
+		Opcode:     opcode,
+		I:          e.i,
+		V:          e.v,
+		DelayTimer: e.delayTimer.GetTimer(),
+		SoundTimer: e.soundTimer.GetTimer(),
+	})
+}
+
+// SetTracer starts tracing every instruction to t. A nil tracer stops
+// tracing.
+func (e *Chip8Emulator) SetTracer(t *Tracer) {
+	e.EnqueueMessage(TracerMessage{tracer: t})
+}
@@ -0,0 +1,100 @@
+package chip8
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func traceRom(t *testing.T, rom []byte, format TraceFormat, filter TraceFilter) *bytes.Buffer {
+	t.Helper()
+	var out bytes.Buffer
+	tracer := NewTracer(&out, format, filter)
+	e := NewChip8Emulator(Hooks{}, QuirksCosmacVIP)
+	e.SetTracer(tracer)
+	e.SwapROM(rom)
+	e.Resume()
+	for frame := 0; frame < 3; frame++ {
+		e.Cycle(0)
+	}
+	if err := tracer.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return &out
+}
+
+func readTrace(t *testing.T, trace *bytes.Buffer) []TraceRecord {
+	t.Helper()
+	r, err := NewTraceReader(bytes.NewReader(trace.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []TraceRecord
+	for {
+		record, err := r.Next()
+		if err == io.EOF {
+			return records
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+}
+
+func TestTraceFormats(t *testing.T) {
+	// v1 := 5; v2 := 0x10; i := 0x300; v1 += v2; jump 0x208
+	rom := []byte{0x61, 0x05, 0x62, 0x10, 0xA3, 0x00, 0x81, 0x24, 0x12, 0x08}
+
+	text := readTrace(t, traceRom(t, rom, TraceText, TraceFilter{}))
+	binary := readTrace(t, traceRom(t, rom, TraceBinary, TraceFilter{}))
+	if len(text) != 3*IPF || len(binary) != len(text) {
+		t.Fatalf("got %d text and %d binary records, want %d", len(text), len(binary), 3*IPF)
+	}
+	for i := range text {
+		if text[i] != binary[i] {
+			t.Fatalf("record %d: text %v, binary %v", i, text[i], binary[i])
+		}
+	}
+
+	want := TraceRecord{Cycle: 4, PC: 0x208, Opcode: 0x1208, I: 0x300}
+	want.V[1], want.V[2] = 0x15, 0x10
+	if text[4] != want {
+		t.Errorf("record 4 = %v, want %v", text[4], want)
+	}
+}
+
+func TestTraceFilter(t *testing.T) {
+	rom := []byte{0x61, 0x05, 0x62, 0x10, 0xA3, 0x00, 0x81, 0x24, 0x12, 0x08}
+
+	records := readTrace(t, traceRom(t, rom, TraceText, TraceFilter{StartPC: 0x200, EndPC: 0x207}))
+	if len(records) != 4 {
+		t.Errorf("pc filter traced %d records, want 4", len(records))
+	}
+	records = readTrace(t, traceRom(t, rom, TraceText, TraceFilter{Classes: 1 << 0x6}))
+	if len(records) != 2 || records[1].Opcode != 0x6210 {
+		t.Errorf("class filter traced %v", records)
+	}
+}
+
+func TestDiffTraces(t *testing.T) {
+	a := traceRom(t, []byte{0x61, 0x05, 0x62, 0x10, 0x12, 0x04}, TraceText, TraceFilter{})
+	b := traceRom(t, []byte{0x61, 0x05, 0x62, 0x11, 0x12, 0x04}, TraceBinary, TraceFilter{})
+
+	ra, _ := NewTraceReader(a)
+	rb, _ := NewTraceReader(b)
+	d, err := DiffTraces(ra, rb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d == nil || d.Index != 1 || len(d.Fields) != 1 || d.Fields[0] != "opcode" {
+		t.Fatalf("divergence = %+v", d)
+	}
+
+	trace := traceRom(t, []byte{0x12, 0x00}, TraceText, TraceFilter{}).Bytes()
+	ra, _ = NewTraceReader(bytes.NewReader(trace))
+	rb, _ = NewTraceReader(bytes.NewReader(trace))
+	if d, err := DiffTraces(ra, rb); d != nil || err != nil {
+		t.Errorf("identical traces diverge: %v, %v", d, err)
+	}
+}
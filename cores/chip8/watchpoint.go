@@ -0,0 +1,111 @@
+package chip8
+
+import "reflect"
+
+type WatchKind uint8
+
+const (
+	WatchRead WatchKind = 1 << iota
+	WatchWrite
+
+	WatchReadWrite = WatchRead | WatchWrite
+)
+
+func (k WatchKind) String() string {
+	switch k {
+	case WatchRead:
+		return "read"
+	case WatchWrite:
+		return "write"
+	case WatchReadWrite:
+		return "read/write"
+	default:
+		return "none"
+	}
+}
+
+// Watchpoint pauses the emulator after an instruction accesses memory from
+// Start to End inclusive. Instruction fetches are not watched.
+type Watchpoint struct {
+	Start uint16
+	End   uint16
+	Kind  WatchKind
+}
+
+func (w Watchpoint) contains(address int) bool {
+	return address >= int(w.Start) && address <= int(w.End)
+}
+
+// WatchHit describes a watched memory access. Reads report the value read as
+// both Old and New.
+type WatchHit struct {
+	Watchpoint  Watchpoint
+	Access      WatchKind
+	Address     uint16
+	PC          uint16
+	Opcode      uint16
+	Instruction string
+	Old         uint8
+	New         uint8
+}
+
+func (e *Chip8Emulator) watch(access WatchKind, address int, old, new uint8) {
+	for _, w := range e.debugger.watchpoints {
+		if w.Kind&access == 0 || !w.contains(address) {
+			continue
+		}
+		e.debugger.watchHits = append(e.debugger.watchHits, WatchHit{
+			Watchpoint:  w,
+			Access:      access,
+			Address:     uint16(address),
+			PC:          e.debugger.pc,
+			Opcode:      e.debugger.opcode,
+			Instruction: instructionName(e.debugger.opcode),
+			Old:         old,
+			New:         new,
+		})
+		return
+	}
+}
+
+// hitWatchpoint reports the watched accesses of the instruction that just
+// finished and pauses the emulator if there were any.
+func (e *Chip8Emulator) hitWatchpoint() bool {
+	if len(e.debugger.watchHits) == 0 {
+		return false
+	}
+	hits := e.debugger.watchHits
+	e.debugger.watchHits = nil
+	if e.hooks.Watch != nil {
+		for _, hit := range hits {
+			e.hooks.Watch(hit)
+		}
+	}
+	e.breakAt(BreakWatchpoint)
+	return true
+}
+
+func instructionName(opcode uint16) string {
+	instruction, ok := instructions[getOpKey(opcode)]
+	if !ok {
+		return "Unknown"
+	}
+	return reflect.TypeOf(instruction).Elem().Name()
+}
+
+func (e *Chip8Emulator) AddWatchpoint(start, end uint16, kind WatchKind) {
+	e.EnqueueMessage(WatchpointMessage{watchpoint: Watchpoint{Start: start, End: end, Kind: kind}})
+}
+
+// RemoveWatchpoint removes the watchpoints covering exactly start to end.
+func (e *Chip8Emulator) RemoveWatchpoint(start, end uint16) {
+	e.EnqueueMessage(WatchpointMessage{watchpoint: Watchpoint{Start: start, End: end}, remove: true})
+}
+
+func (e *Chip8Emulator) ClearWatchpoints() {
+	e.EnqueueMessage(ClearWatchpointsMessage{})
+}
+
+func (e *Chip8Emulator) GetWatchpoints() []Watchpoint {
+	return append([]Watchpoint(nil), e.debugger.watchpoints...)
+}
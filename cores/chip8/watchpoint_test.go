@@ -0,0 +1,77 @@
+package chip8
+
+import (
+	"reflect"
+	"testing"
+)
+
+// memoryRom stores v0-v2 at 0x300, loads them back and draws them.
+var memoryRom = []byte{
+	0xA3, 0x00, // 0x200: i := 0x300
+	0x60, 0x11, // 0x202: v0 := 0x11
+	0x61, 0x22, // 0x204: v1 := 0x22
+	0x62, 0x33, // 0x206: v2 := 0x33
+	0xF2, 0x55, // 0x208: save v2
+	0xA3, 0x00, // 0x20A: i := 0x300
+	0xF2, 0x65, // 0x20C: load v2
+	0xA3, 0x00, // 0x20E: i := 0x300
+	0xD0, 0x13, // 0x210: sprite v0 v1 3
+	0x12, 0x12, // 0x212: jump 0x212
+}
+
+// runWatched runs memoryRom until the next watchpoint and returns its hits.
+func runWatched(t *testing.T, e *Chip8Emulator, hits *[]WatchHit) []WatchHit {
+	t.Helper()
+	*hits = nil
+	e.Resume()
+	for i := 0; i < 10 && len(*hits) == 0; i++ {
+		e.Cycle(0)
+	}
+	if !e.IsPaused() {
+		t.Fatal("watchpoint did not pause the emulator")
+	}
+	return *hits
+}
+
+func TestWatchpointWrite(t *testing.T) {
+	var hits []WatchHit
+	e := NewChip8Emulator(Hooks{Watch: func(hit WatchHit) {
+		hits = append(hits, hit)
+	}}, QuirksCosmacVIP)
+	e.SwapROM(memoryRom)
+	e.AddWatchpoint(0x301, 0x302, WatchWrite)
+
+	w := Watchpoint{Start: 0x301, End: 0x302, Kind: WatchWrite}
+	want := []WatchHit{
+		{Watchpoint: w, Access: WatchWrite, Address: 0x301, PC: 0x208, Opcode: 0xF255, Instruction: "StoreRegisters", Old: 0, New: 0x22},
+		{Watchpoint: w, Access: WatchWrite, Address: 0x302, PC: 0x208, Opcode: 0xF255, Instruction: "StoreRegisters", Old: 0, New: 0x33},
+	}
+	if got := runWatched(t, e, &hits); !reflect.DeepEqual(got, want) {
+		t.Errorf("hits = %+v, want %+v", got, want)
+	}
+	if e.pc != 0x20A {
+		t.Errorf("paused at %X, want after the store at 20A", e.pc)
+	}
+}
+
+func TestWatchpointRead(t *testing.T) {
+	var hits []WatchHit
+	e := NewChip8Emulator(Hooks{Watch: func(hit WatchHit) {
+		hits = append(hits, hit)
+	}}, QuirksCosmacVIP)
+	e.SwapROM(memoryRom)
+	e.AddWatchpoint(0x301, 0x301, WatchRead)
+
+	w := Watchpoint{Start: 0x301, End: 0x301, Kind: WatchRead}
+	for _, want := range []WatchHit{
+		// FX65 loads the watched byte into v1.
+		{Watchpoint: w, Access: WatchRead, Address: 0x301, PC: 0x20C, Opcode: 0xF265, Instruction: "LoadRegisters", Old: 0x22, New: 0x22},
+		// DXYN reads the second row of the sprite from it.
+		{Watchpoint: w, Access: WatchRead, Address: 0x301, PC: 0x210, Opcode: 0xD013, Instruction: "Draw", Old: 0x22, New: 0x22},
+	} {
+		got := runWatched(t, e, &hits)
+		if len(got) != 1 || got[0] != want {
+			t.Errorf("hits = %+v, want %+v", got, want)
+		}
+	}
+}
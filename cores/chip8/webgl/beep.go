@@ -2,11 +2,21 @@
 
 package chip8web
 
-import "syscall/js"
+import (
+	"math"
+	"syscall/js"
+)
 
 type Beep struct {
 	audio              js.Value
 	timeUpdateListener js.Func
+
+	// XO-CHIP programs supply their own 1-bit waveform, which is played
+	// through WebAudio instead of the audio element.
+	context js.Value
+	buffer  js.Value
+	source  js.Value
+	playing bool
 }
 
 func NewBeep() *Beep {
@@ -35,14 +45,78 @@ func NewBeepWithSource(beepSource string) *Beep {
 	return &Beep{
 		audio:              audio,
 		timeUpdateListener: timeUpdateListener,
+		context:            js.Undefined(),
+		buffer:             js.Undefined(),
+		source:             js.Undefined(),
 	}
 }
 
 func (b *Beep) Play() {
-	b.audio.Call("play")
+	b.playing = true
+	if b.buffer.IsUndefined() {
+		b.audio.Call("play")
+		return
+	}
+	b.source = b.context.Call("createBufferSource")
+	b.source.Set("buffer", b.buffer)
+	b.source.Set("loop", true)
+	b.source.Call("connect", b.context.Get("destination"))
+	b.source.Call("start")
 }
 
 func (b *Beep) Stop() {
+	b.playing = false
 	b.audio.Call("pause")
 	b.audio.Set("currentTime", 0)
+	if !b.source.IsUndefined() {
+		b.source.Call("stop")
+		b.source = js.Undefined()
+	}
+}
+
+// SetPattern switches to a 128 sample XO-CHIP waveform played back at
+// 4000*2^((pitch-64)/48) Hz. A nil pattern restores the default beep.
+func (b *Beep) SetPattern(pattern []uint8, pitch uint8) {
+	playing := b.playing
+	if playing {
+		b.Stop()
+	}
+
+	if pattern == nil {
+		b.buffer = js.Undefined()
+	} else {
+		if b.context.IsUndefined() {
+			b.context = js.Global().Get("AudioContext").New()
+		}
+		b.buffer = b.createBuffer(pattern, pitch)
+	}
+
+	if playing {
+		b.Play()
+	}
+}
+
+func (b *Beep) createBuffer(pattern []uint8, pitch uint8) js.Value {
+	sampleRate := b.context.Get("sampleRate").Float()
+	patternRate := 4000 * math.Pow(2, (float64(pitch)-64)/48)
+
+	bits := len(pattern) * 8
+	length := int(float64(bits) * sampleRate / patternRate)
+	if length < 1 {
+		length = 1
+	}
+
+	samples := js.Global().Get("Float32Array").New(length)
+	for i := 0; i < length; i++ {
+		bit := int(float64(i)*patternRate/sampleRate) % bits
+		sample := -0.25
+		if pattern[bit/8]&(0x80>>(bit%8)) != 0 {
+			sample = 0.25
+		}
+		samples.SetIndex(i, sample)
+	}
+
+	buffer := b.context.Call("createBuffer", 1, length, sampleRate)
+	buffer.Call("copyToChannel", samples, 0)
+	return buffer
 }
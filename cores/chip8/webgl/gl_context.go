@@ -3,40 +3,53 @@
 package chip8web
 
 import (
+	"bytes"
 	"fmt"
 
 	"github.com/seqsense/webgl-go"
 
 	"github.com/mrchip53/chip-station/cores/chip8"
+	"github.com/mrchip53/chip-station/cores/chip8/disasm"
 	"github.com/mrchip53/chip-station/cores/chip8/webgl/programs"
 )
 
 type GlContext struct {
 	gl *webgl.WebGL
 
-	colors   []float32
-	onColor  Color
-	offColor Color
+	colors  []float32
+	palette [4]Color
+
+	// frame is the last frame the emulator finished, stale is set until
+	// its colors were uploaded.
+	frame *chip8.Frame
+	stale bool
 
 	fullScreen bool
 
+	program    *disasm.Program
+	programRom []byte
+
 	glPrograms *programs.Programs
 }
 
 func NewGlContext(gl *webgl.WebGL, fontSource string) *GlContext {
 	context := &GlContext{
 		gl:         gl,
-		colors:     make([]float32, chip8.SCREEN_WIDTH*chip8.SCREEN_HEIGHT*3*2*3),
-		onColor:    NewColor(0xF2CE03),
-		offColor:   NewColor(0x8E6903),
+		colors:     make([]float32, chip8.HIRES_SCREEN_WIDTH*chip8.HIRES_SCREEN_HEIGHT*3*2*3),
 		glPrograms: programs.NewPrograms(gl, fontSource),
 	}
+	context.setPalette(chip8.DefaultPalette)
 	return context
 }
 
-func (c *GlContext) Draw(e *Chip8WebEmulator) {
-	c.calculateColors(e.GetDisplay())
+func (c *GlContext) setPalette(p chip8.Palette) {
+	for i, rgb := range p.Expand() {
+		c.palette[i] = NewColor(rgb)
+	}
+	c.stale = true
+}
 
+func (c *GlContext) Draw(e *Chip8WebEmulator) {
 	scale := float32(1)
 	x := float32(0)
 	y := float32(0)
@@ -45,20 +58,37 @@ func (c *GlContext) Draw(e *Chip8WebEmulator) {
 		scale = 0.5
 	}
 	_, _, _ = scale, x, y
-	c.glPrograms.DisplayProgram.Draw(c.gl, c.colors, scale, x, y)
+	if frame := c.frame; frame != nil {
+		c.glPrograms.DisplayProgram.SetResolution(c.gl, frame.Width(), frame.Height())
+		if c.stale {
+			c.calculateColors(frame)
+			c.glPrograms.DisplayProgram.SetColors(c.gl, c.colors[:frame.Width()*frame.Height()*3*2*3])
+			c.stale = false
+		}
+		display := c.glPrograms.DisplayProgram
+		display.Draw(c.gl)
+		c.glPrograms.PostProgram.Draw(c.gl, display.Texture(), display.Width(), display.Height(), scale, x, y)
+	}
 	if !c.fullScreen {
 		h := c.gl.Canvas.ClientHeight()
 		w := c.gl.Canvas.ClientWidth()
 		// textHeight := programs.CHAR_SIZE / float32(h)
 
-		c.DrawWindow("ChipStation CHIP-8 Emulator", 0, 0, float32(w)/4.0, float32(h), []string{
+		lines := []string{
 			"Toggle Fullscreen: 'u'",
-			fmt.Sprintf("FPS: %.2f", e.GetFps()),
+			fmt.Sprintf("FPS: %.2f (%d dropped)", e.GetFps(), e.GetDroppedFrames()),
+			fmt.Sprintf("Dropped Input: %d messages", e.GetDroppedMessages()),
 			fmt.Sprintf("PC: 0x%04X", e.GetPc()),
 			fmt.Sprintf("Opcode: 0x%04X", e.GetOpCode()),
 			fmt.Sprintf("IPF: %d cycles/frame", e.GetIPF()),
 			fmt.Sprintf("ROM Size: %d bytes", e.GetRomSize()),
-		})
+			fmt.Sprintf("Rewind: %.1fs (hold Backspace)", float64(e.GetRewindFrames())/60),
+		}
+		if fault := e.GetFault(); fault != nil {
+			lines = append(lines, fmt.Sprintf("Halted: %s", fault.Kind))
+		}
+		c.DrawWindow("ChipStation CHIP-8 Emulator", 0, 0, float32(w)/4.0, float32(h), lines)
+		c.DrawWindow("Disassembly", float32(w)*3/4.0, 0, float32(w)/4.0, float32(h), c.disassembly(e))
 
 		// c.glPrograms.TextProgram.Draw(c.gl, "ChipStation CHIP-8 Emulator - Press 'u' to toggle the UI", -1, 1)
 		// c.glPrograms.TextProgram.Draw(c.gl, fmt.Sprintf("FPS: %.2f", e.GetFps()), -1, 1-textHeight, 1)
@@ -69,6 +99,31 @@ func (c *GlContext) Draw(e *Chip8WebEmulator) {
 	}
 }
 
+// disassembly lists the code around the PC. The ROM is only disassembled
+// again when its bytes or the platform change.
+func (c *GlContext) disassembly(e *Chip8WebEmulator) []string {
+	rom := e.GetRom()
+	platform := e.GetQuirks().Platform
+	if c.program == nil || c.program.Platform != platform || !bytes.Equal(rom, c.programRom) {
+		c.programRom = bytes.Clone(rom)
+		c.program = disasm.Disassemble(c.programRom, platform)
+	}
+
+	pc := e.GetPc()
+	var lines []string
+	for _, line := range c.program.Around(pc, 8, 16) {
+		if line.Label != "" {
+			lines = append(lines, ": "+line.Label)
+		}
+		marker := "  "
+		if line.Address == pc {
+			marker = "> "
+		}
+		lines = append(lines, fmt.Sprintf("%s%04X %s", marker, line.Address, line.Text(c.program.Labels)))
+	}
+	return lines
+}
+
 func (c *GlContext) DrawWindow(title string, x, y, w, h float32, text []string) {
 	ch := float32(c.gl.Canvas.ClientHeight())
 	cw := float32(c.gl.Canvas.ClientWidth())
@@ -88,15 +143,27 @@ func (c *GlContext) DrawWindow(title string, x, y, w, h float32, text []string)
 	}
 }
 
-func (c *GlContext) calculateColors(display chip8.Display) {
-	for y := 0; y < 32; y++ {
-		for x := 0; x < 64; x++ {
-			offset := (y*64 + x) * 3 * 2 * 3
-			if display[x][y] == 1 {
-				c.setGeometryColor(offset, 3, 2, c.onColor)
-			} else {
-				c.setGeometryColor(offset, 3, 2, c.offColor)
+// SetFrame replaces the frame on screen. Frames only arrive when the
+// display changed, so the colors are only uploaded then.
+func (c *GlContext) SetFrame(f *chip8.Frame) {
+	c.frame = f
+	c.stale = true
+}
+
+func (c *GlContext) calculateColors(frame *chip8.Frame) {
+	w, h := frame.Width(), frame.Height()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			offset := (y*w + x) * 3 * 2 * 3
+			color := c.palette[frame.Pixel(x, y)&0x3]
+			if l := float32(frame.Light(x, y)); l < 1 {
+				// A pixel fading out against flicker.
+				off := c.palette[0]
+				color.R = off.R + (color.R-off.R)*l
+				color.G = off.G + (color.G-off.G)*l
+				color.B = off.B + (color.B-off.B)*l
 			}
+			c.setGeometryColor(offset, 3, 2, color)
 		}
 	}
 }
@@ -11,15 +11,12 @@ type Message interface {
 type ChangeColorMessage struct {
 	chip8.CustomMessage
 	color Color
-	off   bool
+	index int
 }
 
 func (m ChangeColorMessage) Handle(e *Chip8WebEmulator) {
-	if m.off {
-		e.glContext.offColor = m.color
-	} else {
-		e.glContext.onColor = m.color
-	}
+	e.glContext.palette[m.index] = m.color
+	e.glContext.stale = true
 }
 
 type ToggleUiMessage struct {
@@ -30,3 +27,23 @@ func (m ToggleUiMessage) Handle(e *Chip8WebEmulator) {
 	e.ResetFps()
 	e.glContext.fullScreen = !e.glContext.fullScreen
 }
+
+type EffectsMessage struct {
+	chip8.CustomMessage
+	chain []string
+}
+
+func (m EffectsMessage) Handle(e *Chip8WebEmulator) {
+	e.glContext.glPrograms.PostProgram.SetChain(m.chain)
+}
+
+type EffectParamMessage struct {
+	chip8.CustomMessage
+	effect string
+	param  string
+	value  float32
+}
+
+func (m EffectParamMessage) Handle(e *Chip8WebEmulator) {
+	e.glContext.glPrograms.PostProgram.SetParam(m.effect, m.param, m.value)
+}
@@ -3,67 +3,46 @@
 package programs
 
 import (
-	"time"
-
 	"github.com/seqsense/webgl-go"
 
 	"github.com/mrchip53/chip-station/cores/chip8"
 )
 
+// The display is drawn one quad per CHIP-8 pixel into a texture of its
+// native size, which the PostProgram then runs through its effects.
 const vsSource = `
 attribute vec3 position;
 attribute vec3 color;
-uniform float scale;
-uniform vec2 scaleOffset;
-uniform vec2 offset;
 varying vec3 vColor;
-varying vec2 vPosition;
 
 void main(void) {
-  gl_Position = vec4(position*scale+vec3(scaleOffset, 0.0)+vec3(offset, 0.0), 1.0);
+  gl_Position = vec4(position, 1.0);
   vColor = color;
-  vPosition = position.xy;
 }
 `
 
 const fsSource = `
 precision mediump float;
 varying vec3 vColor;
-varying vec2 vPosition;
-
-uniform vec2 resolution;
-uniform float time;
 
 void main(void) {
-  vec2 fragPixelCoord = (vPosition.xy + 1.0) / 2.0 * resolution;
-  vec2 fragCoord = abs(fragPixelCoord*2.0-resolution.xy/1.0);
-
-  float line = pow(fragCoord.x/resolution.x, 70.0) + pow((fragCoord.y + (resolution.x - resolution.y))/resolution.x, 70.0);
-  float minphase = abs(0.02*sin(time*10.0)+0.2*sin(fragCoord.y));
-  float frame = max(min(line+minphase,1.0),0.0);
-
-  gl_FragColor = vec4(vColor-vec3(frame), 1.0);
-  //gl_FragColor = vec4(vColor, 1.0);
+  gl_FragColor = vec4(vColor, 1.0);
 }
 `
 
 type DisplayProgram struct {
 	program webgl.Program
 
-	position    int
-	color       int
-	scale       webgl.Location
-	scaleOffset webgl.Location
-	offset      webgl.Location
-	resolution  webgl.Location
-	time        webgl.Location
+	position int
+	color    int
 
 	vertexBuffer webgl.Buffer
 	colorBuffer  webgl.Buffer
+	target       *framebuffer
 
 	polygonCount int
-
-	start time.Time
+	width        int
+	height       int
 }
 
 func NewDisplayProgram(gl *webgl.WebGL) *DisplayProgram {
@@ -72,7 +51,7 @@ func NewDisplayProgram(gl *webgl.WebGL) *DisplayProgram {
 
 		vertexBuffer: gl.CreateBuffer(),
 		colorBuffer:  gl.CreateBuffer(),
-		start:        time.Now(),
+		target:       newFramebuffer(gl),
 	}
 	c.init(gl)
 	return c
@@ -97,26 +76,33 @@ func (c *DisplayProgram) init(gl *webgl.WebGL) {
 	c.program = program
 	c.color = gl.GetAttribLocation(program, "color")
 	c.position = gl.GetAttribLocation(program, "position")
-	c.scale = gl.GetUniformLocation(program, "scale")
-	c.offset = gl.GetUniformLocation(program, "offset")
-	c.scaleOffset = gl.GetUniformLocation(program, "scaleOffset")
-	c.resolution = gl.GetUniformLocation(program, "resolution")
-	c.time = gl.GetUniformLocation(program, "time")
-	c.generateVertices(gl)
+	c.SetResolution(gl, chip8.SCREEN_WIDTH, chip8.SCREEN_HEIGHT)
+}
+
+func (p *DisplayProgram) SetResolution(gl *webgl.WebGL, width, height int) {
+	if p.width == width && p.height == height {
+		return
+	}
+	p.width = width
+	p.height = height
+	p.generateVertices(gl)
+	p.target.resize(gl, width, height)
 }
 
 func (p *DisplayProgram) generateVertices(gl *webgl.WebGL) {
 	vertices := []float32{}
 
-	for y := 0; y < chip8.SCREEN_HEIGHT; y++ {
-		fy := (chip8.SCREEN_HEIGHT - 1) - y
-		for x := 0; x < chip8.SCREEN_WIDTH; x++ {
-			vertices = append(vertices, float32(x)/32-1, float32(fy)/16-1, 0)
-			vertices = append(vertices, float32(x+1)/32-1, float32(fy)/16-1, 0)
-			vertices = append(vertices, float32(x)/32-1, float32(fy+1)/16-1, 0)
-			vertices = append(vertices, float32(x+1)/32-1, float32(fy)/16-1, 0)
-			vertices = append(vertices, float32(x+1)/32-1, float32(fy+1)/16-1, 0)
-			vertices = append(vertices, float32(x)/32-1, float32(fy+1)/16-1, 0)
+	hw := float32(p.width) / 2
+	hh := float32(p.height) / 2
+	for y := 0; y < p.height; y++ {
+		fy := (p.height - 1) - y
+		for x := 0; x < p.width; x++ {
+			vertices = append(vertices, float32(x)/hw-1, float32(fy)/hh-1, 0)
+			vertices = append(vertices, float32(x+1)/hw-1, float32(fy)/hh-1, 0)
+			vertices = append(vertices, float32(x)/hw-1, float32(fy+1)/hh-1, 0)
+			vertices = append(vertices, float32(x+1)/hw-1, float32(fy)/hh-1, 0)
+			vertices = append(vertices, float32(x+1)/hw-1, float32(fy+1)/hh-1, 0)
+			vertices = append(vertices, float32(x)/hw-1, float32(fy+1)/hh-1, 0)
 		}
 	}
 
@@ -125,10 +111,16 @@ func (p *DisplayProgram) generateVertices(gl *webgl.WebGL) {
 	p.polygonCount = len(vertices) / 3
 }
 
-func (c *DisplayProgram) Draw(gl *webgl.WebGL, colors []float32, scale float32, x, y float32) {
-	h := float32(gl.Canvas.ClientHeight())
-	w := float32(gl.Canvas.ClientWidth())
+// SetColors uploads the color of every vertex, which stays in use until the
+// next upload.
+func (c *DisplayProgram) SetColors(gl *webgl.WebGL, colors []float32) {
+	gl.BindBuffer(gl.ARRAY_BUFFER, c.colorBuffer)
+	gl.BufferData(gl.ARRAY_BUFFER, webgl.Float32ArrayBuffer(colors), gl.STATIC_DRAW)
+}
 
+// Draw renders the display into its texture at its native size.
+func (c *DisplayProgram) Draw(gl *webgl.WebGL) {
+	c.target.bind(gl)
 	gl.UseProgram(c.program)
 
 	gl.BindBuffer(gl.ARRAY_BUFFER, c.vertexBuffer)
@@ -136,21 +128,22 @@ func (c *DisplayProgram) Draw(gl *webgl.WebGL, colors []float32, scale float32,
 	gl.EnableVertexAttribArray(c.position)
 
 	gl.BindBuffer(gl.ARRAY_BUFFER, c.colorBuffer)
-	gl.BufferData(gl.ARRAY_BUFFER, webgl.Float32ArrayBuffer(colors), gl.STATIC_DRAW)
 	gl.VertexAttribPointer(c.color, 3, gl.FLOAT, false, 0, 0)
 	gl.EnableVertexAttribArray(c.color)
 
-	scaleOffX := float32(0)
-	scaleOffY := float32(0)
-	if scale != 1.0 {
-		scaleOffX = scale * -1
-		scaleOffY = scale
-	}
-	gl.Uniform1f(c.scale, scale)
-	gl.Uniform1f(c.time, float32(time.Since(c.start).Seconds()))
-	uniform2f(gl, c.scaleOffset, scaleOffX, scaleOffY)
-	uniform2f(gl, c.offset, x, y)
-	uniform2f(gl, c.resolution, w*scale, h*scale)
-
 	gl.DrawArrays(gl.TRIANGLES, 0, c.polygonCount)
+	bindScreen(gl)
+}
+
+// Texture is what Draw rendered, Width by Height pixels.
+func (c *DisplayProgram) Texture() webgl.Texture {
+	return c.target.texture
+}
+
+func (c *DisplayProgram) Width() int {
+	return c.width
+}
+
+func (c *DisplayProgram) Height() int {
+	return c.height
 }
@@ -0,0 +1,61 @@
+//go:build js && wasm
+
+package programs
+
+import (
+	"syscall/js"
+
+	"github.com/seqsense/webgl-go"
+)
+
+// framebuffer is a texture that can be drawn into. webgl-go has no
+// framebuffer calls, so they go to the context directly.
+type framebuffer struct {
+	fb      js.Value
+	texture webgl.Texture
+
+	width  int
+	height int
+}
+
+func newFramebuffer(gl *webgl.WebGL) *framebuffer {
+	f := &framebuffer{
+		fb:      gl.JS().Call("createFramebuffer"),
+		texture: gl.CreateTexture(),
+	}
+	gl.BindTexture(gl.TEXTURE_2D, f.texture)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	return f
+}
+
+// resize reallocates the texture if its size changed.
+func (f *framebuffer) resize(gl *webgl.WebGL, width, height int) {
+	if f.width == width && f.height == height {
+		return
+	}
+	f.width = width
+	f.height = height
+
+	bare := gl.JS()
+	gl.BindTexture(gl.TEXTURE_2D, f.texture)
+	bare.Call("texImage2D", int(gl.TEXTURE_2D), 0, int(gl.RGBA), width, height, 0, int(gl.RGBA), int(gl.UNSIGNED_BYTE), nil)
+	bare.Call("bindFramebuffer", bare.Get("FRAMEBUFFER"), f.fb)
+	bare.Call("framebufferTexture2D", bare.Get("FRAMEBUFFER"), bare.Get("COLOR_ATTACHMENT0"), int(gl.TEXTURE_2D), js.Value(*f.texture), 0)
+	bindScreen(gl)
+}
+
+// bind directs drawing into the texture.
+func (f *framebuffer) bind(gl *webgl.WebGL) {
+	bare := gl.JS()
+	bare.Call("bindFramebuffer", bare.Get("FRAMEBUFFER"), f.fb)
+	gl.Viewport(0, 0, f.width, f.height)
+}
+
+// bindScreen directs drawing back to the canvas.
+func bindScreen(gl *webgl.WebGL) {
+	bare := gl.JS()
+	bare.Call("bindFramebuffer", bare.Get("FRAMEBUFFER"), nil)
+}
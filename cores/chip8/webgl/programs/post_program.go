@@ -0,0 +1,390 @@
+//go:build js && wasm
+
+package programs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/seqsense/webgl-go"
+)
+
+// The display is drawn at its native resolution and then run through a
+// chain of effects, each a full screen pass reading the output of the one
+// before. The last pass draws onto the canvas.
+
+const vPostShader = `
+attribute vec2 position;
+varying vec2 vUv;
+
+void main(void) {
+  gl_Position = vec4(position, 0.0, 1.0);
+  vUv = position * 0.5 + 0.5;
+}
+`
+
+// fPostHeader is shared by all effects. resolution is the size of the
+// output in pixels and native the size of the display in CHIP-8 pixels.
+const fPostHeader = `
+precision mediump float;
+varying vec2 vUv;
+
+uniform sampler2D source;
+uniform vec2 resolution;
+uniform vec2 native;
+uniform float time;
+`
+
+const fCopyShader = `
+void main(void) {
+  gl_FragColor = vec4(texture2D(source, vUv).rgb, 1.0);
+}
+`
+
+const fScanlinesShader = `
+uniform float intensity;
+uniform float wobble;
+
+void main(void) {
+  vec2 fragCoord = abs(vUv * 2.0 * resolution - resolution);
+  float dark = abs(wobble * sin(time * 10.0) + intensity * sin(fragCoord.y));
+  gl_FragColor = vec4(texture2D(source, vUv).rgb - vec3(min(dark, 1.0)), 1.0);
+}
+`
+
+const fCrtShader = `
+uniform float curvature;
+uniform float vignette;
+
+void main(void) {
+  vec2 n = vUv * 2.0 - 1.0;
+  n *= 1.0 + curvature * dot(n, n);
+  if (abs(n.x) >= 1.0 || abs(n.y) >= 1.0) {
+    gl_FragColor = vec4(0.0, 0.0, 0.0, 1.0);
+    return;
+  }
+  vec3 color = texture2D(source, n * 0.5 + 0.5).rgb;
+
+  vec2 fragCoord = abs(vUv * 2.0 * resolution - resolution);
+  float edge = pow(fragCoord.x / resolution.x, 70.0) + pow((fragCoord.y + resolution.x - resolution.y) / resolution.x, 70.0);
+  gl_FragColor = vec4(color - vec3(min(edge * vignette, 1.0)), 1.0);
+}
+`
+
+const fBloomShader = `
+uniform float intensity;
+uniform float radius;
+uniform float threshold;
+
+void main(void) {
+  vec3 color = texture2D(source, vUv).rgb;
+  vec2 spread = radius / native;
+  vec3 glow = vec3(0.0);
+  for (int i = 0; i < 12; i++) {
+    vec2 dir = vec2(cos(float(i) * 0.5236), sin(float(i) * 0.5236));
+    glow += max(texture2D(source, vUv + dir * spread * 0.5).rgb - vec3(threshold), 0.0);
+    glow += max(texture2D(source, vUv + dir * spread).rgb - vec3(threshold), 0.0);
+  }
+  gl_FragColor = vec4(color + glow / 24.0 * intensity, 1.0);
+}
+`
+
+const fLcdShader = `
+uniform float gap;
+uniform float shade;
+
+void main(void) {
+  vec3 color = texture2D(source, vUv).rgb;
+  vec2 cell = fract(vUv * native);
+  if (cell.x < gap || cell.y > 1.0 - gap) {
+    color *= shade;
+  }
+  gl_FragColor = vec4(color, 1.0);
+}
+`
+
+// EffectParam is a uniform of an effect that can be adjusted.
+type EffectParam struct {
+	Name    string
+	Default float32
+	Min     float32
+	Max     float32
+}
+
+type Effect struct {
+	Name   string
+	Params []EffectParam
+	source string
+}
+
+// Effects are the passes the display can be run through.
+var Effects = []Effect{
+	{
+		Name: "scanlines",
+		Params: []EffectParam{
+			{Name: "intensity", Default: 0.2, Min: 0, Max: 1},
+			{Name: "wobble", Default: 0.02, Min: 0, Max: 1},
+		},
+		source: fScanlinesShader,
+	},
+	{
+		Name: "crt",
+		Params: []EffectParam{
+			{Name: "curvature", Default: 0.02, Min: 0, Max: 0.5},
+			{Name: "vignette", Default: 1, Min: 0, Max: 10},
+		},
+		source: fCrtShader,
+	},
+	{
+		Name: "bloom",
+		Params: []EffectParam{
+			{Name: "intensity", Default: 0.8, Min: 0, Max: 4},
+			{Name: "radius", Default: 1.5, Min: 0, Max: 8},
+			{Name: "threshold", Default: 0.4, Min: 0, Max: 1},
+		},
+		source: fBloomShader,
+	},
+	{
+		Name: "lcd",
+		Params: []EffectParam{
+			{Name: "gap", Default: 0.12, Min: 0, Max: 0.5},
+			{Name: "shade", Default: 0.6, Min: 0, Max: 1},
+		},
+		source: fLcdShader,
+	},
+}
+
+// DefaultEffects give the look of the original display shader.
+var DefaultEffects = []string{"scanlines", "crt"}
+
+func getEffect(name string) (Effect, bool) {
+	for _, effect := range Effects {
+		if effect.Name == name {
+			return effect, true
+		}
+	}
+	return Effect{}, false
+}
+
+// ParseEffects reads a comma separated chain of effects, run in order.
+// "none" or an empty chain shows the display as it is.
+func ParseEffects(chain string) ([]string, error) {
+	chain = strings.TrimSpace(chain)
+	if chain == "" || chain == "none" {
+		return nil, nil
+	}
+	var names []string
+	for _, name := range strings.Split(chain, ",") {
+		name = strings.TrimSpace(name)
+		if _, ok := getEffect(name); !ok {
+			return nil, fmt.Errorf("unknown effect %q", name)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// CheckEffectParam reports whether effect has the param.
+func CheckEffectParam(effect, param string) error {
+	e, ok := getEffect(effect)
+	if !ok {
+		return fmt.Errorf("unknown effect %q", effect)
+	}
+	for _, p := range e.Params {
+		if p.Name == param {
+			return nil
+		}
+	}
+	return fmt.Errorf("effect %s has no parameter %q", effect, param)
+}
+
+type effectPass struct {
+	program    webgl.Program
+	position   int
+	source     webgl.Location
+	resolution webgl.Location
+	native     webgl.Location
+	time       webgl.Location
+	params     map[string]webgl.Location
+}
+
+type PostProgram struct {
+	copy   *effectPass
+	passes map[string]*effectPass
+
+	chain  []string
+	values map[string]map[string]float32
+
+	quad webgl.Buffer
+	// buffers are drawn into by turns, each pass reading the other one.
+	buffers [2]*framebuffer
+
+	start time.Time
+}
+
+func NewPostProgram(gl *webgl.WebGL) *PostProgram {
+	p := &PostProgram{
+		passes: make(map[string]*effectPass),
+		chain:  DefaultEffects,
+		values: make(map[string]map[string]float32),
+		quad:   gl.CreateBuffer(),
+		start:  time.Now(),
+	}
+	p.init(gl)
+	return p
+}
+
+func (p *PostProgram) init(gl *webgl.WebGL) {
+	p.copy = newEffectPass(gl, fCopyShader, nil)
+	for _, effect := range Effects {
+		p.passes[effect.Name] = newEffectPass(gl, effect.source, effect.Params)
+		p.values[effect.Name] = make(map[string]float32)
+		for _, param := range effect.Params {
+			p.values[effect.Name][param.Name] = param.Default
+		}
+	}
+	for i := range p.buffers {
+		p.buffers[i] = newFramebuffer(gl)
+	}
+
+	gl.BindBuffer(gl.ARRAY_BUFFER, p.quad)
+	gl.BufferData(gl.ARRAY_BUFFER, webgl.Float32ArrayBuffer([]float32{
+		-1, -1, 1, -1, -1, 1,
+		1, -1, 1, 1, -1, 1,
+	}), gl.STATIC_DRAW)
+}
+
+func newEffectPass(gl *webgl.WebGL, source string, params []EffectParam) *effectPass {
+	var err error
+	var vs, fs webgl.Shader
+	if vs, err = initVertexShader(gl, vPostShader); err != nil {
+		panic(err)
+	}
+
+	if fs, err = initFragmentShader(gl, fPostHeader+source); err != nil {
+		panic(err)
+	}
+
+	program, err := linkShaders(gl, nil, vs, fs)
+	if err != nil {
+		panic(err)
+	}
+
+	pass := &effectPass{
+		program:    program,
+		position:   gl.GetAttribLocation(program, "position"),
+		source:     gl.GetUniformLocation(program, "source"),
+		resolution: gl.GetUniformLocation(program, "resolution"),
+		native:     gl.GetUniformLocation(program, "native"),
+		time:       gl.GetUniformLocation(program, "time"),
+		params:     make(map[string]webgl.Location),
+	}
+	for _, param := range params {
+		pass.params[param.Name] = gl.GetUniformLocation(program, param.Name)
+	}
+	return pass
+}
+
+// SetChain selects the effects to run, in order.
+func (p *PostProgram) SetChain(chain []string) {
+	p.chain = chain
+}
+
+func (p *PostProgram) Chain() []string {
+	return p.chain
+}
+
+// SetParam sets a uniform of an effect, kept within its range.
+func (p *PostProgram) SetParam(effect, param string, value float32) error {
+	if err := CheckEffectParam(effect, param); err != nil {
+		return err
+	}
+	e, _ := getEffect(effect)
+	for _, def := range e.Params {
+		if def.Name == param {
+			value = min(max(value, def.Min), def.Max)
+		}
+	}
+	p.values[effect][param] = value
+	return nil
+}
+
+// Params returns the uniforms of every effect by name.
+func (p *PostProgram) Params() map[string]map[string]float32 {
+	params := make(map[string]map[string]float32, len(p.values))
+	for effect, values := range p.values {
+		params[effect] = make(map[string]float32, len(values))
+		for name, v := range values {
+			params[effect][name] = v
+		}
+	}
+	return params
+}
+
+// Draw runs the texture of a display of width by height CHIP-8 pixels
+// through the chain onto the canvas. scale, x and y place it like the
+// DisplayProgram used to, in clip space.
+func (p *PostProgram) Draw(gl *webgl.WebGL, texture webgl.Texture, width, height int, scale, x, y float32) {
+	cw := gl.Canvas.ClientWidth()
+	ch := gl.Canvas.ClientHeight()
+
+	// The display covers -scale to scale around its offset.
+	offX, offY := x, y
+	if scale != 1.0 {
+		offX -= scale
+		offY += scale
+	}
+	left := int((offX - scale + 1) / 2 * float32(cw))
+	bottom := int((offY - scale + 1) / 2 * float32(ch))
+	w := max(int(scale*float32(cw)), 1)
+	h := max(int(scale*float32(ch)), 1)
+
+	type step struct {
+		pass   *effectPass
+		values map[string]float32
+	}
+	steps := []step{{pass: p.copy}}
+	if len(p.chain) > 0 {
+		steps = steps[:0]
+		for _, name := range p.chain {
+			steps = append(steps, step{p.passes[name], p.values[name]})
+		}
+	}
+
+	input := texture
+	for i, s := range steps {
+		if i == len(steps)-1 {
+			bindScreen(gl)
+			gl.Viewport(left, bottom, w, h)
+		} else {
+			out := p.buffers[i%2]
+			out.resize(gl, w, h)
+			out.bind(gl)
+		}
+		p.run(gl, s.pass, s.values, input, width, height, w, h)
+		input = p.buffers[i%2].texture
+	}
+
+	gl.Viewport(0, 0, cw, ch)
+}
+
+func (p *PostProgram) run(gl *webgl.WebGL, pass *effectPass, values map[string]float32, input webgl.Texture, width, height, w, h int) {
+	gl.UseProgram(pass.program)
+
+	gl.BindBuffer(gl.ARRAY_BUFFER, p.quad)
+	gl.VertexAttribPointer(pass.position, 2, gl.FLOAT, false, 0, 0)
+	gl.EnableVertexAttribArray(pass.position)
+
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindTexture(gl.TEXTURE_2D, input)
+	gl.Uniform1i(pass.source, 0)
+	uniform2f(gl, pass.resolution, float32(w), float32(h))
+	uniform2f(gl, pass.native, float32(width), float32(height))
+	gl.Uniform1f(pass.time, float32(time.Since(p.start).Seconds()))
+	for name, loc := range pass.params {
+		gl.Uniform1f(loc, values[name])
+	}
+
+	gl.DrawArrays(gl.TRIANGLES, 0, 6)
+}
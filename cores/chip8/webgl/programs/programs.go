@@ -6,6 +6,7 @@ import "github.com/seqsense/webgl-go"
 
 type Programs struct {
 	DisplayProgram *DisplayProgram
+	PostProgram    *PostProgram
 	WindowProgram  *WindowProgram
 	TextProgram    *TextProgram
 }
@@ -13,6 +14,7 @@ type Programs struct {
 func NewPrograms(gl *webgl.WebGL, fontSource string) *Programs {
 	return &Programs{
 		DisplayProgram: NewDisplayProgram(gl),
+		PostProgram:    NewPostProgram(gl),
 		WindowProgram:  NewWindowProgram(gl),
 		TextProgram:    NewTextProgramWithFontSource(gl, fontSource),
 	}
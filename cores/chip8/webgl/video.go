@@ -0,0 +1,59 @@
+//go:build js && wasm
+
+package chip8web
+
+import (
+	"bytes"
+
+	"github.com/mrchip53/chip-station/cores/chip8"
+	"github.com/mrchip53/chip-station/cores/chip8/render"
+)
+
+// videoRecording feeds the frames shown between StartVideo and StopVideo to
+// a recorder. The frame hook only reports changes, so a frame is added once
+// for every emulated frame it stayed on screen.
+type videoRecording struct {
+	recorder *render.Recorder
+	frame    *chip8.Frame
+}
+
+func (v *videoRecording) add(f *chip8.Frame) {
+	if v.frame != nil {
+		for n := v.frame.Number; n < f.Number; n++ {
+			v.recorder.Add(v.frame)
+		}
+	}
+	v.frame = f
+}
+
+// StartVideo starts recording the display with the current palette.
+func (e *Chip8WebEmulator) StartVideo() {
+	e.video = &videoRecording{
+		recorder: render.NewRecorder(e.renderPalette(), videoOptions),
+		frame:    e.GetFrame(),
+	}
+}
+
+func (e *Chip8WebEmulator) IsRecordingVideo() bool {
+	return e.video != nil
+}
+
+// StopVideo ends the recording and encodes it, or returns nil if nothing
+// was recorded.
+func (e *Chip8WebEmulator) StopVideo(format render.Format) []byte {
+	v := e.video
+	e.video = nil
+	if v == nil || v.frame == nil {
+		return nil
+	}
+	if f := e.GetFrame(); f != nil {
+		v.add(f)
+	}
+	v.recorder.Add(v.frame)
+
+	var buf bytes.Buffer
+	if err := v.recorder.Encode(&buf, format); err != nil {
+		return nil
+	}
+	return buf.Bytes()
+}
@@ -3,13 +3,24 @@
 package chip8web
 
 import (
+	"bytes"
+	"image/png"
+
 	webgl "github.com/seqsense/webgl-go"
 
 	"github.com/mrchip53/chip-station/cores/chip8"
+	"github.com/mrchip53/chip-station/cores/chip8/render"
+	"github.com/mrchip53/chip-station/cores/chip8/webgl/programs"
 )
 
+// screenshotOptions approximate the display shader.
+var screenshotOptions = render.Options{Scale: 10, Scanlines: 0.2, Curvature: 0.02}
+
+// videoOptions keep recordings small and within the colors a GIF holds.
+var videoOptions = render.Options{Scale: 4}
+
 type Chip8WebEmulator struct {
-	chip8.Chip8Emulator
+	*chip8.Chip8Emulator
 
 	beepSource string
 	fontSource string
@@ -17,19 +28,32 @@ type Chip8WebEmulator struct {
 	gl        *webgl.WebGL
 	glContext *GlContext
 	beep      *Beep
+	scheduler *chip8.Scheduler
+	video     *videoRecording
 }
 
-func NewChip8WebEmulator(gl *webgl.WebGL, hooks chip8.Hooks, fontSource, beepSource string) *Chip8WebEmulator {
+func NewChip8WebEmulator(gl *webgl.WebGL, hooks chip8.Hooks, quirks chip8.Quirks, fontSource, beepSource string) *Chip8WebEmulator {
 	e := &Chip8WebEmulator{
-		Chip8Emulator: *chip8.NewChip8Emulator(hooks),
+		Chip8Emulator: chip8.NewChip8Emulator(hooks, quirks),
 		gl:            gl,
 		glContext:     NewGlContext(gl, fontSource),
 		beepSource:    beepSource,
 		fontSource:    fontSource,
 	}
+	e.scheduler = chip8.NewScheduler(e.Chip8Emulator)
 	return e
 }
 
+// Advance runs the frames due at now, the requestAnimationFrame timestamp,
+// so the emulator keeps 60 frames a second at any display refresh rate.
+func (e *Chip8WebEmulator) Advance(now float64) bool {
+	return e.scheduler.Advance(now)
+}
+
+func (e *Chip8WebEmulator) GetDroppedFrames() uint64 {
+	return e.scheduler.Dropped()
+}
+
 func (e *Chip8WebEmulator) Draw() {
 	w := e.gl.Canvas.ClientWidth()
 	h := e.gl.Canvas.ClientHeight()
@@ -45,6 +69,35 @@ func (e *Chip8WebEmulator) Draw() {
 	e.glContext.Draw(e)
 }
 
+// SetFrame shows f from the next draw on. It is meant for the frame hook.
+func (e *Chip8WebEmulator) SetFrame(f *chip8.Frame) {
+	e.glContext.SetFrame(f)
+	if e.video != nil {
+		e.video.add(f)
+	}
+}
+
+// Screenshot renders the frame on screen with the current palette as a
+// PNG, or returns nil before the first frame.
+func (e *Chip8WebEmulator) Screenshot() []byte {
+	frame := e.GetFrame()
+	if frame == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, render.Render(frame, e.renderPalette(), screenshotOptions))
+	return buf.Bytes()
+}
+
+// renderPalette is the palette on screen for the render package.
+func (e *Chip8WebEmulator) renderPalette() render.Palette {
+	var palette render.Palette
+	for i, c := range e.glContext.palette {
+		palette[i] = render.RGB(c.RGB)
+	}
+	return palette
+}
+
 func (e *Chip8WebEmulator) PlayBeep() {
 	if e.beep == nil {
 		e.beep = NewBeepWithSource(e.beepSource)
@@ -52,6 +105,13 @@ func (e *Chip8WebEmulator) PlayBeep() {
 	e.beep.Play()
 }
 
+func (e *Chip8WebEmulator) SetAudio(pattern []uint8, pitch uint8) {
+	if e.beep == nil {
+		e.beep = NewBeepWithSource(e.beepSource)
+	}
+	e.beep.SetPattern(pattern, pitch)
+}
+
 func (e *Chip8WebEmulator) StopBeep() {
 	if e.beep != nil {
 		e.beep.Stop()
@@ -59,13 +119,55 @@ func (e *Chip8WebEmulator) StopBeep() {
 }
 
 func (e *Chip8WebEmulator) ToggleUi() {
-	e.EnqueueMessage(ToggleUiMessage{})
+	e.TryEnqueueMessage(ToggleUiMessage{})
+}
+
+// ApplyPalette shows the display in p from the next draw on. It is meant
+// for the palette hook, which runs whenever the emulator's palette changes.
+func (e *Chip8WebEmulator) ApplyPalette(p chip8.Palette) {
+	e.glContext.setPalette(p)
+}
+
+// SetEffects selects the post-processing chain of the display, a comma
+// separated list of effects run in order, or "none".
+func (e *Chip8WebEmulator) SetEffects(chain string) error {
+	effects, err := programs.ParseEffects(chain)
+	if err != nil {
+		return err
+	}
+	e.TryEnqueueMessage(EffectsMessage{chain: effects})
+	return nil
+}
+
+// SetEffectParam adjusts a uniform of an effect, whether it is in the chain
+// or not.
+func (e *Chip8WebEmulator) SetEffectParam(effect, param string, value float32) error {
+	if err := programs.CheckEffectParam(effect, param); err != nil {
+		return err
+	}
+	e.TryEnqueueMessage(EffectParamMessage{effect: effect, param: param, value: value})
+	return nil
+}
+
+// GetEffects returns the effect chain and the uniforms of every effect.
+func (e *Chip8WebEmulator) GetEffects() ([]string, map[string]map[string]float32) {
+	post := e.glContext.glPrograms.PostProgram
+	return post.Chain(), post.Params()
 }
 
 func (e *Chip8WebEmulator) SetOffColor(c Color) {
-	e.EnqueueMessage(ChangeColorMessage{color: c, off: true})
+	e.SetPaletteColor(0, c)
 }
 
 func (e *Chip8WebEmulator) SetOnColor(c Color) {
-	e.EnqueueMessage(ChangeColorMessage{color: c, off: false})
+	e.SetPaletteColor(1, c)
+}
+
+// SetPaletteColor sets the color used for a pixel's plane bits, so index 2
+// is the second XO-CHIP plane and index 3 is both planes overlapping.
+func (e *Chip8WebEmulator) SetPaletteColor(index int, c Color) {
+	if index < 0 || index > 3 {
+		return
+	}
+	e.TryEnqueueMessage(ChangeColorMessage{color: c, index: index})
 }
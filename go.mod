@@ -4,7 +4,10 @@ go 1.24.0
 
 toolchain go1.24.2
 
-require github.com/seqsense/webgl-go v0.0.0-20231106035007-6fa7160d45ce
+require (
+	github.com/seqsense/webgl-go v0.0.0-20231106035007-6fa7160d45ce
+	golang.org/x/term v0.34.0
+)
 
 require (
 	github.com/shurcooL/go v0.0.0-20200502201357-93f07166e636 // indirect
@@ -12,6 +15,7 @@ require (
 	github.com/shurcooL/goexec v0.0.0-20230709021537-96bada04ea2b // indirect
 	golang.org/x/mod v0.29.0 // indirect
 	golang.org/x/sync v0.17.0 // indirect
+	golang.org/x/sys v0.37.0 // indirect
 	golang.org/x/tools v0.38.0 // indirect
 )
 
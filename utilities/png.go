@@ -8,6 +8,16 @@ import (
 	"os"
 )
 
+// grayLevels maps a pixel's plane bits to a shade, keeping single plane
+// displays black and white.
+var grayLevels = [4]uint8{0x00, 0xFF, 0xAA, 0x55}
+
+type Bitmap interface {
+	Width() int
+	Height() int
+	Pixel(x, y int) uint8
+}
+
 func ScaleImage(img image.Image, width, height int) image.Image {
 	return resizeImage(img, width, height)
 }
@@ -22,26 +32,20 @@ func resizeImage(img image.Image, width, height int) image.Image {
 	return newImg
 }
 
-func GetPNG(display [64][32]uint8) image.Image {
-	img := image.NewGray(image.Rect(0, 0, 64, 32))
+func GetPNG(display Bitmap) image.Image {
+	img := image.NewGray(image.Rect(0, 0, display.Width(), display.Height()))
 
-	for y := 0; y < 32; y++ {
-		for x := 0; x < 64; x++ {
-			img.Set(x, y, color.Gray{Y: display[x][y] * 255})
+	for y := 0; y < display.Height(); y++ {
+		for x := 0; x < display.Width(); x++ {
+			img.Set(x, y, color.Gray{Y: grayLevels[display.Pixel(x, y)&0x3]})
 		}
 	}
 
 	return img
 }
 
-func SavePNG(display [64][32]uint8, filename string) {
-	img := image.NewGray(image.Rect(0, 0, 64, 32))
-
-	for y := 0; y < 32; y++ {
-		for x := 0; x < 64; x++ {
-			img.Set(x, y, color.Gray{Y: display[x][y] * 255})
-		}
-	}
+func SavePNG(display Bitmap, filename string) {
+	img := GetPNG(display)
 
 	f, err := os.Create(filename)
 	if err != nil {
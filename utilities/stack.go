@@ -1,5 +1,12 @@
 package utilities
 
+import "errors"
+
+var (
+	ErrStackOverflow  = errors.New("stack overflow")
+	ErrStackUnderflow = errors.New("stack underflow")
+)
+
 type Stack struct {
 	stack   []uint16
 	pointer int
@@ -12,20 +19,49 @@ func NewStack(size int) *Stack {
 	}
 }
 
-func (s *Stack) Push(value uint16) {
+func (s *Stack) Push(value uint16) error {
 	if s.pointer >= len(s.stack) {
-		panic("stack overflow")
+		return ErrStackOverflow
 	}
 
 	s.stack[s.pointer] = value
 	s.pointer++
+	return nil
 }
 
-func (s *Stack) Pop() uint16 {
+func (s *Stack) Pop() (uint16, error) {
 	if s.pointer == 0 {
-		panic("stack underflow")
+		return 0, ErrStackUnderflow
 	}
 
 	s.pointer--
-	return s.stack[s.pointer]
+	return s.stack[s.pointer], nil
+}
+
+func (s *Stack) Pointer() int {
+	return s.pointer
+}
+
+func (s *Stack) Size() int {
+	return len(s.stack)
+}
+
+// Contents returns a copy of the whole stack, including slots above the
+// pointer.
+func (s *Stack) Contents() []uint16 {
+	contents := make([]uint16, len(s.stack))
+	copy(contents, s.stack)
+	return contents
+}
+
+func (s *Stack) Restore(contents []uint16, pointer int) error {
+	if len(contents) != len(s.stack) {
+		return errors.New("stack size mismatch")
+	}
+	if pointer < 0 || pointer > len(s.stack) {
+		return ErrStackOverflow
+	}
+	copy(s.stack, contents)
+	s.pointer = pointer
+	return nil
 }
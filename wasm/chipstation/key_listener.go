@@ -4,15 +4,15 @@ package main
 
 import (
 	"syscall/js"
+
+	"github.com/mrchip53/chip-station/cores/chip8"
 )
 
 var (
-	keyMap = map[string]uint8{
-		"1": 0x1, "2": 0x2, "3": 0x3, "4": 0xC,
-		"q": 0x4, "w": 0x5, "e": 0x6, "r": 0xD,
-		"a": 0x7, "s": 0x8, "d": 0x9, "f": 0xE,
-		"z": 0xA, "x": 0x0, "c": 0xB, "v": 0xF,
-	}
+	keyMap = chip8.DefaultKeyMap
+
+	// Held down to rewind gameplay.
+	rewindKey = "Backspace"
 
 	// Keep references to prevent GC.
 	keyDownFunc js.Func
@@ -29,6 +29,13 @@ func attachKeyListeners() {
 		}
 		event := args[0]
 		key := event.Get("key").String()
+		if key == rewindKey {
+			event.Call("preventDefault")
+			if !event.Get("repeat").Bool() {
+				e.SetRewinding(true)
+			}
+			return nil
+		}
 		if chipKey, ok := keyMap[key]; ok {
 			e.SetKeyState(chipKey, 1)
 		}
@@ -45,6 +52,10 @@ func attachKeyListeners() {
 			e.ToggleUi()
 			return nil
 		}
+		if key == rewindKey {
+			e.SetRewinding(false)
+			return nil
+		}
 		if chipKey, ok := keyMap[key]; ok {
 			e.SetKeyState(chipKey, 0)
 		}
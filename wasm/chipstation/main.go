@@ -13,6 +13,8 @@ import (
 	webgl "github.com/seqsense/webgl-go"
 
 	"github.com/mrchip53/chip-station/cores/chip8"
+	"github.com/mrchip53/chip-station/cores/chip8/disasm"
+	"github.com/mrchip53/chip-station/cores/chip8/octo"
 	chip8web "github.com/mrchip53/chip-station/cores/chip8/webgl"
 )
 
@@ -31,22 +33,8 @@ var (
 
 var e *chip8web.Chip8WebEmulator
 
-var csRom = []byte{
-	0x63, 0x08, 0x81, 0x30, 0x62, 0x04, 0xA2, 0x4C, 0xD1, 0x2A, 0x71, 0x07, 0xA2, 0x56, 0xD1, 0x2A,
-	0x71, 0x07, 0xA2, 0x60, 0xD1, 0x2A, 0x71, 0x03, 0xA2, 0x6A, 0xD1, 0x2D, 0x72, 0x0B, 0x81, 0x30,
-	0x71, 0x05, 0xA2, 0x77, 0xD1, 0x2A, 0x71, 0x07, 0xA2, 0x81, 0xD1, 0x2A, 0x71, 0x07, 0xA2, 0x8B,
-	0xD1, 0x2A, 0x71, 0x07, 0xA2, 0x81, 0xD1, 0x2A, 0x71, 0x07, 0xA2, 0x60, 0xD1, 0x2A, 0x71, 0x03,
-	0xA2, 0x95, 0xD1, 0x2A, 0x71, 0x07, 0xA2, 0x9F, 0xD1, 0x2A, 0x12, 0x4A, 0xFC, 0xFC, 0xC0, 0xC0,
-	0xC0, 0xC0, 0xC0, 0xC0, 0xFC, 0xFC, 0xC0, 0xC0, 0xC0, 0xC0, 0xFC, 0xFC, 0xCC, 0xCC, 0xCC, 0xCC,
-	0xC0, 0xC0, 0x00, 0x00, 0xC0, 0xC0, 0xC0, 0xC0, 0xC0, 0xC0, 0x00, 0x00, 0x00, 0x00, 0xFF, 0xFF,
-	0xC3, 0xC3, 0xFF, 0xFF, 0xC0, 0xC0, 0xC0, 0xFC, 0xFC, 0xC0, 0xC0, 0xFC, 0xFC, 0x0C, 0x0C, 0xFC,
-	0xFC, 0x00, 0x00, 0x30, 0x30, 0xFC, 0xFC, 0x30, 0x30, 0x30, 0x30, 0x00, 0x00, 0xF8, 0xFC, 0x0C,
-	0x7C, 0xFC, 0xCC, 0xFC, 0x7C, 0x00, 0x00, 0x00, 0x00, 0xFC, 0xFC, 0xCC, 0xCC, 0xFC, 0xFC, 0x00,
-	0x00, 0x00, 0x00, 0xFC, 0xFC, 0xCC, 0xCC, 0xCC, 0xCC,
-}
-
 func cycle(this js.Value, p []js.Value) interface{} {
-	ok := e.Cycle(p[0].Float())
+	ok := e.Advance(p[0].Float())
 	if !ok {
 		log.Printf("told to stop")
 		return nil
@@ -80,21 +68,55 @@ func main() {
 		Draw: func() {
 			e.Draw()
 		},
+		Frame: func(f *chip8.Frame) {
+			e.SetFrame(f)
+		},
+		Palette: func(p chip8.Palette) {
+			e.ApplyPalette(p)
+			ui.ShowPalette(p)
+		},
 		PlaySound: func() {
 			e.PlayBeep()
 		},
 		StopSound: func() {
 			e.StopBeep()
 		},
+		Audio: func(pattern []uint8, pitch uint8) {
+			e.SetAudio(pattern, pitch)
+		},
+		Fault: func(err *chip8.EmulatorError) {
+			log.Printf("Emulator halted: %v", err)
+		},
+		Break: func(reason chip8.BreakReason, pc uint16) {
+			onBreak := js.Global().Get("emulator").Get("onBreak")
+			if onBreak.Type() == js.TypeFunction {
+				onBreak.Invoke(reason.String(), pc)
+			}
+		},
+		Watch: func(hit chip8.WatchHit) {
+			onWatch := js.Global().Get("emulator").Get("onWatch")
+			if onWatch.Type() == js.TypeFunction {
+				onWatch.Invoke(map[string]interface{}{
+					"access":      hit.Access.String(),
+					"address":     int(hit.Address),
+					"pc":          int(hit.PC),
+					"opcode":      int(hit.Opcode),
+					"instruction": hit.Instruction,
+					"old":         int(hit.Old),
+					"new":         int(hit.New),
+				})
+			}
+		},
 		CustomMessage: func(m chip8.Message) {
 			switch m := m.(type) {
 			case chip8web.Message:
 				m.Handle(e)
 			}
 		},
-	}, fontUrl, beepUrl)
+	}, chip8.QuirksCosmacVIP, fontUrl, beepUrl)
 
 	ui.SetEmulator(e)
+	e.SetRomDatabase(initRomDatabase())
 
 	e.ToggleUi()
 
@@ -107,13 +129,44 @@ func main() {
 	emulatorObj := js.Global().Get("Object").New()
 	emulatorObj.Set("setKeyState", js.FuncOf(setKeyState))
 	emulatorObj.Set("loadRom", js.FuncOf(loadRom))
+	emulatorObj.Set("loadSource", js.FuncOf(loadSource))
 	emulatorObj.Set("getRom", js.FuncOf(getRom))
 	emulatorObj.Set("setIpf", js.FuncOf(setIpf))
+	emulatorObj.Set("setTiming", js.FuncOf(setTiming))
+	emulatorObj.Set("setDeflicker", js.FuncOf(setDeflicker))
 	emulatorObj.Set("pause", js.FuncOf(pause))
 	emulatorObj.Set("resume", js.FuncOf(resume))
 	emulatorObj.Set("isPaused", js.FuncOf(isPaused))
+	emulatorObj.Set("getFault", js.FuncOf(getFault))
+	emulatorObj.Set("setQuirks", js.FuncOf(setQuirks))
+	emulatorObj.Set("saveState", js.FuncOf(saveState))
+	emulatorObj.Set("loadState", js.FuncOf(loadState))
+	emulatorObj.Set("playMovie", js.FuncOf(playMovie))
+	emulatorObj.Set("rewind", js.FuncOf(rewind))
+	emulatorObj.Set("setRewinding", js.FuncOf(setRewinding))
+	emulatorObj.Set("setRewindBudget", js.FuncOf(setRewindBudget))
+	emulatorObj.Set("addBreakpoint", js.FuncOf(addBreakpoint))
+	emulatorObj.Set("removeBreakpoint", js.FuncOf(removeBreakpoint))
+	emulatorObj.Set("clearBreakpoints", js.FuncOf(clearBreakpoints))
+	emulatorObj.Set("getBreakpoints", js.FuncOf(getBreakpoints))
+	emulatorObj.Set("addWatchpoint", js.FuncOf(addWatchpoint))
+	emulatorObj.Set("removeWatchpoint", js.FuncOf(removeWatchpoint))
+	emulatorObj.Set("clearWatchpoints", js.FuncOf(clearWatchpoints))
+	emulatorObj.Set("getWatchpoints", js.FuncOf(getWatchpoints))
+	emulatorObj.Set("step", js.FuncOf(step))
+	emulatorObj.Set("stepOver", js.FuncOf(stepOver))
+	emulatorObj.Set("stepOut", js.FuncOf(stepOut))
+	emulatorObj.Set("runToFrame", js.FuncOf(runToFrame))
+	emulatorObj.Set("getRegisters", js.FuncOf(getRegisters))
+	emulatorObj.Set("disassemble", js.FuncOf(disassemble))
 	emulatorObj.Set("setOnColor", js.FuncOf(setOnColor))
 	emulatorObj.Set("setOffColor", js.FuncOf(setOffColor))
+	emulatorObj.Set("setPaletteColor", js.FuncOf(setPaletteColor))
+	emulatorObj.Set("setPalette", js.FuncOf(setPalette))
+	emulatorObj.Set("setEffects", js.FuncOf(setEffects))
+	emulatorObj.Set("setEffectParam", js.FuncOf(setEffectParam))
+	emulatorObj.Set("getEffects", js.FuncOf(getEffects))
+	emulatorObj.Set("attachPalette", js.FuncOf(attachPalette))
 	emulatorObj.Set("toggleUi", js.FuncOf(toggleUi))
 	js.Global().Set("emulator", emulatorObj)
 
@@ -136,6 +189,19 @@ func initAssets() (string, string) {
 	return fontUrl, beepUrl
 }
 
+// initRomDatabase reads the metadata of the bundled ROMs.
+func initRomDatabase() chip8.RomDatabase {
+	data, err := fs.ReadFile(assets, "assets/roms.json")
+	if err != nil {
+		log.Fatalf("Failed to read ROM metadata: %v", err)
+	}
+	db, err := chip8.ParseRomDatabase(data)
+	if err != nil {
+		log.Fatalf("Failed to parse ROM metadata: %v", err)
+	}
+	return db
+}
+
 func createBlobUrl(data []byte) string {
 	uint8Array := js.Global().Get("Uint8Array").New(len(data))
 	js.CopyBytesToJS(uint8Array, data)
@@ -151,6 +217,212 @@ func setIpf(this js.Value, p []js.Value) interface{} {
 	return nil
 }
 
+func setTiming(this js.Value, p []js.Value) interface{} {
+	timing, ok := chip8.ParseTiming(p[0].String())
+	if !ok {
+		log.Printf("Unknown timing: %s", p[0].String())
+		return nil
+	}
+	e.SetTiming(timing)
+	return nil
+}
+
+func setDeflicker(this js.Value, p []js.Value) interface{} {
+	deflicker, ok := chip8.ParseDeflicker(p[0].String())
+	if !ok {
+		log.Printf("Unknown deflicker mode: %s", p[0].String())
+		return nil
+	}
+	e.SetDeflicker(deflicker)
+	return nil
+}
+
+func setQuirks(this js.Value, p []js.Value) interface{} {
+	quirks, ok := chip8.GetQuirksPreset(p[0].String())
+	if !ok {
+		log.Printf("Unknown quirks preset: %s", p[0].String())
+		return nil
+	}
+	e.SetQuirks(quirks)
+	return nil
+}
+
+func saveState(this js.Value, p []js.Value) interface{} {
+	state, err := e.SaveState()
+	if err != nil {
+		log.Printf("Error saving state: %v", err)
+		return nil
+	}
+	stateBytes := js.Global().Get("Uint8Array").New(len(state))
+	js.CopyBytesToJS(stateBytes, state)
+	return stateBytes
+}
+
+func loadState(this js.Value, p []js.Value) interface{} {
+	stateBytes := p[0]
+	state := make([]byte, stateBytes.Get("length").Int())
+	js.CopyBytesToGo(state, stateBytes)
+	if err := e.LoadState(state); err != nil {
+		return err.Error()
+	}
+	return nil
+}
+
+// playMovie replays a movie file against the loaded ROM and returns an error
+// message if the movie is invalid or was recorded with another ROM.
+func playMovie(this js.Value, p []js.Value) interface{} {
+	movieBytes := p[0]
+	data := make([]byte, movieBytes.Get("length").Int())
+	js.CopyBytesToGo(data, movieBytes)
+	movie, err := chip8.UnmarshalMovie(data)
+	if err != nil {
+		return err.Error()
+	}
+	rom := append([]byte(nil), e.GetRom()...)
+	if err := e.PlayMovie(movie, rom); err != nil {
+		return err.Error()
+	}
+	return nil
+}
+
+func rewind(this js.Value, p []js.Value) interface{} {
+	e.Rewind(p[0].Int())
+	return nil
+}
+
+func setRewinding(this js.Value, p []js.Value) interface{} {
+	e.SetRewinding(p[0].Bool())
+	return nil
+}
+
+func setRewindBudget(this js.Value, p []js.Value) interface{} {
+	e.SetRewindBudget(p[0].Int())
+	return nil
+}
+
+// addBreakpoint takes an address and an optional condition such as
+// "v3 == 0x10" and returns an error message if the condition is invalid.
+func addBreakpoint(this js.Value, p []js.Value) interface{} {
+	condition := ""
+	if len(p) > 1 && p[1].Type() == js.TypeString {
+		condition = p[1].String()
+	}
+	if err := e.AddBreakpoint(uint16(p[0].Int()), condition); err != nil {
+		return err.Error()
+	}
+	return nil
+}
+
+func removeBreakpoint(this js.Value, p []js.Value) interface{} {
+	e.RemoveBreakpoint(uint16(p[0].Int()))
+	return nil
+}
+
+func clearBreakpoints(this js.Value, p []js.Value) interface{} {
+	e.ClearBreakpoints()
+	return nil
+}
+
+func getBreakpoints(this js.Value, p []js.Value) interface{} {
+	breakpoints := []interface{}{}
+	for _, bp := range e.GetBreakpoints() {
+		condition := ""
+		if bp.Condition != nil {
+			condition = bp.Condition.String()
+		}
+		breakpoints = append(breakpoints, map[string]interface{}{
+			"address":   int(bp.Address),
+			"condition": condition,
+		})
+	}
+	return breakpoints
+}
+
+// addWatchpoint takes a start and end address and "r", "w" or "rw".
+func addWatchpoint(this js.Value, p []js.Value) interface{} {
+	kind := chip8.WatchReadWrite
+	if len(p) > 2 {
+		switch p[2].String() {
+		case "r":
+			kind = chip8.WatchRead
+		case "w":
+			kind = chip8.WatchWrite
+		}
+	}
+	e.AddWatchpoint(uint16(p[0].Int()), uint16(p[1].Int()), kind)
+	return nil
+}
+
+func removeWatchpoint(this js.Value, p []js.Value) interface{} {
+	e.RemoveWatchpoint(uint16(p[0].Int()), uint16(p[1].Int()))
+	return nil
+}
+
+func clearWatchpoints(this js.Value, p []js.Value) interface{} {
+	e.ClearWatchpoints()
+	return nil
+}
+
+func getWatchpoints(this js.Value, p []js.Value) interface{} {
+	watchpoints := []interface{}{}
+	for _, w := range e.GetWatchpoints() {
+		watchpoints = append(watchpoints, map[string]interface{}{
+			"start": int(w.Start),
+			"end":   int(w.End),
+			"kind":  w.Kind.String(),
+		})
+	}
+	return watchpoints
+}
+
+func step(this js.Value, p []js.Value) interface{} {
+	e.Step()
+	return nil
+}
+
+func stepOver(this js.Value, p []js.Value) interface{} {
+	e.StepOver()
+	return nil
+}
+
+func stepOut(this js.Value, p []js.Value) interface{} {
+	e.StepOut()
+	return nil
+}
+
+func runToFrame(this js.Value, p []js.Value) interface{} {
+	e.RunToFrame(uint64(p[0].Int()))
+	return nil
+}
+
+func getRegisters(this js.Value, p []js.Value) interface{} {
+	r := e.GetRegisters()
+	v := make([]interface{}, len(r.V))
+	for i, value := range r.V {
+		v[i] = int(value)
+	}
+	stack := make([]interface{}, len(r.Stack))
+	for i, address := range r.Stack {
+		stack[i] = int(address)
+	}
+	return map[string]interface{}{
+		"pc":         int(r.PC),
+		"i":          int(r.I),
+		"v":          v,
+		"stack":      stack,
+		"delayTimer": int(r.DelayTimer),
+		"soundTimer": int(r.SoundTimer),
+		"cycle":      r.Cycle,
+		"frame":      r.Frame,
+	}
+}
+
+// disassemble returns the loaded ROM as Octo source.
+func disassemble(this js.Value, p []js.Value) interface{} {
+	rom := append([]byte(nil), e.GetRom()...)
+	return disasm.Disassemble(rom, e.GetQuirks().Platform).String()
+}
+
 func getRom(this js.Value, p []js.Value) interface{} {
 	rom := e.GetRom()
 	romBytes := js.Global().Get("Uint8Array").New(len(rom))
@@ -179,6 +451,14 @@ func isPaused(this js.Value, p []js.Value) interface{} {
 	return e.IsPaused()
 }
 
+func getFault(this js.Value, p []js.Value) interface{} {
+	fault := e.GetFault()
+	if fault == nil {
+		return nil
+	}
+	return fault.Error()
+}
+
 func toggleUi(this js.Value, p []js.Value) interface{} {
 	e.ToggleUi()
 	return nil
@@ -196,6 +476,75 @@ func setOffColor(this js.Value, p []js.Value) interface{} {
 	return nil
 }
 
+func setPaletteColor(this js.Value, p []js.Value) interface{} {
+	index := p[0].Int()
+	rgb := p[1].Int()
+	e.SetPaletteColor(index, chip8web.NewColor(uint32(rgb)))
+	return nil
+}
+
+// setPalette takes a preset name or a comma separated list of two or four
+// hex colors.
+func setPalette(this js.Value, p []js.Value) interface{} {
+	palette, err := chip8.ParsePalette(p[0].String())
+	if err != nil {
+		log.Printf("Error setting palette: %v", err)
+		return nil
+	}
+	e.SetPalette(palette)
+	return nil
+}
+
+// attachPalette applies a palette like setPalette and keeps it for the
+// running ROM.
+func attachPalette(this js.Value, p []js.Value) interface{} {
+	palette, err := chip8.ParsePalette(p[0].String())
+	if err != nil {
+		log.Printf("Error attaching palette: %v", err)
+		return nil
+	}
+	e.AttachPalette(palette)
+	return nil
+}
+
+// setEffects takes a comma separated chain of display effects, e.g.
+// "lcd,bloom", or "none".
+func setEffects(this js.Value, p []js.Value) interface{} {
+	if err := e.SetEffects(p[0].String()); err != nil {
+		log.Printf("Error setting effects: %v", err)
+	}
+	return nil
+}
+
+func setEffectParam(this js.Value, p []js.Value) interface{} {
+	if err := e.SetEffectParam(p[0].String(), p[1].String(), float32(p[2].Float())); err != nil {
+		log.Printf("Error setting effect parameter: %v", err)
+	}
+	return nil
+}
+
+// getEffects returns the chain and the parameters of every effect, e.g.
+// {chain: ["scanlines", "crt"], params: {crt: {curvature: 0.02, ...}, ...}}.
+func getEffects(this js.Value, p []js.Value) interface{} {
+	chain, params := e.GetEffects()
+	names := make([]interface{}, len(chain))
+	for i, name := range chain {
+		names[i] = name
+	}
+	values := make(map[string]interface{}, len(params))
+	for effect, effectParams := range params {
+		v := make(map[string]interface{}, len(effectParams))
+		for name, value := range effectParams {
+			v[name] = float64(value)
+		}
+		values[effect] = v
+	}
+	return map[string]interface{}{
+		"chain":  names,
+		"params": values,
+	}
+}
+
 func loadRom(this js.Value, p []js.Value) interface{} {
 	romBytes := p[0]
 	length := romBytes.Get("length").Int()
@@ -205,8 +554,23 @@ func loadRom(this js.Value, p []js.Value) interface{} {
 	return nil
 }
 
+// loadSource assembles Octo source and runs it, returning the assembly error
+// message if it fails.
+func loadSource(this js.Value, p []js.Value) interface{} {
+	program, err := octo.Assemble(p[0].String())
+	if err != nil {
+		return err.Error()
+	}
+	e.SwapROM(program.ROM)
+	return nil
+}
+
 func runGameLoop() {
-	e.SwapROM(csRom)
+	splash, err := fs.ReadFile(romAssets, "roms/chipstation.ch8")
+	if err != nil {
+		log.Fatalf("Failed to read splash ROM: %v", err)
+	}
+	e.SwapROM(splash)
 	go func() {
 		time.Sleep(100 * time.Millisecond)
 		e.Resume()
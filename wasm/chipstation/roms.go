@@ -1,9 +1,15 @@
+//go:build js && wasm
+
 package main
 
 import (
 	"embed"
 )
 
+// The splash ROM is assembled from the Octo source shipped with the app,
+// built for the host rather than for wasm.
+//go:generate env GOOS= GOARCH= go run ../../cmd/chipstation-octo -o roms/chipstation.ch8 ../../app/chipstation.o8
+
 //go:embed roms
 var romAssets embed.FS
 
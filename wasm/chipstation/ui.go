@@ -4,12 +4,16 @@ package main
 
 import (
 	"bytes"
+	"encoding/base64"
+	"fmt"
 	"html/template"
 	"io/fs"
 	"log"
 	"strconv"
 	"syscall/js"
 
+	"github.com/mrchip53/chip-station/cores/chip8"
+	"github.com/mrchip53/chip-station/cores/chip8/render"
 	chip8web "github.com/mrchip53/chip-station/cores/chip8/webgl"
 )
 
@@ -22,6 +26,7 @@ type UI struct {
 	elements    map[string]js.Value
 	handlers    map[string]js.Func
 	template    *template.Template
+	recording   bool
 }
 
 // UIData holds data for template rendering
@@ -30,6 +35,8 @@ type UIData struct {
 	DisplayHeight int
 	Speeds        []SpeedOption
 	ROMs          []ROMOption
+	Palettes      []PaletteOption
+	SaveSlots     []int
 }
 
 type SpeedOption struct {
@@ -42,6 +49,19 @@ type ROMOption struct {
 	Label string
 }
 
+type PaletteOption struct {
+	Value string
+	Label string
+}
+
+var paletteLabels = map[string]string{
+	"amber":        "Amber",
+	"octo":         "Octo classic",
+	"lcd":          "LCD green",
+	"gameboy":      "Game Boy",
+	"highcontrast": "High contrast",
+}
+
 const styledTemplate = `
 <style>
 .chip8-btn {
@@ -81,11 +101,47 @@ const styledTemplate = `
 				<option value="{{.Value}}">{{.Label}}</option>
 				{{end}}
         	</select>
+			<select id="deflickerDropdown" class="chip8-select" style="width: 100px;">
+				<option value="off">No deflicker</option>
+				<option value="decay">Phosphor decay</option>
+				<option value="blend">Blend frames</option>
+				<option value="clear">Draw on clear</option>
+			</select>
+			<select id="paletteDropdown" class="chip8-select" style="width: 100px;">
+				{{range .Palettes}}
+				<option value="{{.Value}}">{{.Label}}</option>
+				{{end}}
+				<option value="" disabled>Custom</option>
+			</select>
+			<button type="button" id="attachPaletteBtn" class="chip8-btn" title="Use this palette whenever the ROM is loaded">Keep</button>
+			<select id="effectsDropdown" class="chip8-select" style="width: 100px;">
+				<option value="scanlines,crt">CRT</option>
+				<option value="none">No effects</option>
+				<option value="scanlines">Scanlines</option>
+				<option value="crt">CRT curvature</option>
+				<option value="bloom,scanlines,crt">CRT bloom</option>
+				<option value="lcd">LCD grid</option>
+				<option value="lcd,bloom">LCD glow</option>
+			</select>
 			<select id="romSelector" class="chip8-select" style="width: 100px;">
 				{{range .ROMs}}
 				<option value="{{.Value}}">{{.Label}}</option>
 				{{end}}
             </select>
+			<select id="slotSelector" class="chip8-select" style="width: 70px;">
+				{{range .SaveSlots}}
+				<option value="{{.}}">Slot {{.}}</option>
+				{{end}}
+			</select>
+			<button type="button" id="saveStateBtn" class="chip8-btn">Save</button>
+			<button type="button" id="loadStateBtn" class="chip8-btn">Load</button>
+			<button type="button" id="recordBtn" class="chip8-btn">Record</button>
+			<button type="button" id="screenshotBtn" class="chip8-btn">Screenshot</button>
+			<select id="videoFormat" class="chip8-select" style="width: 70px;">
+				<option value="gif">GIF</option>
+				<option value="apng">APNG</option>
+			</select>
+			<button type="button" id="videoBtn" class="chip8-btn">Video</button>
 		</div>
 		<div style="position:absolute; bottom:0; left:0; width:100%; padding:4px; background:rgba(0,0,0,0.4); color:white; font:12px monospace; box-sizing:border-box;">
 			<a href="https://github.com/mrchip53/chip-station" target="_blank" rel="noreferrer noopener">Chip Station Source</a> | <a href="https://www.shadertoy.com/view/XlVczc" target="_blank" rel="noreferrer noopener">CRT Shader Source</a>
@@ -153,15 +209,35 @@ func (ui *UI) Build() error {
 	ui.elements["stopBtn"] = ui.document.Call("getElementById", "stopBtn")
 	ui.elements["resetBtn"] = ui.document.Call("getElementById", "resetBtn")
 	ui.elements["speedDropdown"] = ui.document.Call("getElementById", "speedDropdown")
+	ui.elements["deflickerDropdown"] = ui.document.Call("getElementById", "deflickerDropdown")
+	ui.elements["paletteDropdown"] = ui.document.Call("getElementById", "paletteDropdown")
+	ui.elements["attachPaletteBtn"] = ui.document.Call("getElementById", "attachPaletteBtn")
+	ui.elements["effectsDropdown"] = ui.document.Call("getElementById", "effectsDropdown")
 	ui.elements["romSelector"] = ui.document.Call("getElementById", "romSelector")
 	ui.elements["cs-screen"] = ui.document.Call("getElementById", "cs-screen")
+	ui.elements["slotSelector"] = ui.document.Call("getElementById", "slotSelector")
+	ui.elements["saveStateBtn"] = ui.document.Call("getElementById", "saveStateBtn")
+	ui.elements["loadStateBtn"] = ui.document.Call("getElementById", "loadStateBtn")
+	ui.elements["recordBtn"] = ui.document.Call("getElementById", "recordBtn")
+	ui.elements["screenshotBtn"] = ui.document.Call("getElementById", "screenshotBtn")
+	ui.elements["videoFormat"] = ui.document.Call("getElementById", "videoFormat")
+	ui.elements["videoBtn"] = ui.document.Call("getElementById", "videoBtn")
 
 	// Attach event handlers
 	ui.attachHandler("startBtn", "click", ui.handleStart)
 	ui.attachHandler("stopBtn", "click", ui.handleStop)
 	ui.attachHandler("resetBtn", "click", ui.handleReset)
 	ui.attachHandler("speedDropdown", "change", ui.handleSpeedChange)
+	ui.attachHandler("deflickerDropdown", "change", ui.handleDeflickerChange)
+	ui.attachHandler("paletteDropdown", "change", ui.handlePaletteChange)
+	ui.attachHandler("attachPaletteBtn", "click", ui.handleAttachPalette)
+	ui.attachHandler("effectsDropdown", "change", ui.handleEffectsChange)
 	ui.attachHandler("romSelector", "change", ui.handleRomLoad)
+	ui.attachHandler("saveStateBtn", "click", ui.handleSaveState)
+	ui.attachHandler("loadStateBtn", "click", ui.handleLoadState)
+	ui.attachHandler("recordBtn", "click", ui.handleRecord)
+	ui.attachHandler("screenshotBtn", "click", ui.handleScreenshot)
+	ui.attachHandler("videoBtn", "click", ui.handleVideo)
 
 	return nil
 }
@@ -184,10 +260,16 @@ func (ui *UI) buildHTML() error {
 		}
 	}
 
+	palettes := make([]PaletteOption, 0, len(chip8.PalettePresets))
+	for _, p := range chip8.PalettePresets {
+		palettes = append(palettes, PaletteOption{Value: p.Name, Label: paletteLabels[p.Name]})
+	}
+
 	data := UIData{
 		DisplayWidth:  640,
 		DisplayHeight: 320,
 		Speeds: []SpeedOption{
+			{Value: 0, Label: "COSMAC VIP timing"},
 			{Value: 7, Label: "7 cycles/frame"},
 			{Value: 15, Label: "15 cycles/frame"},
 			{Value: 20, Label: "20 cycles/frame"},
@@ -197,7 +279,9 @@ func (ui *UI) buildHTML() error {
 			{Value: 500, Label: "500 cycles/frame"},
 			{Value: 1000, Label: "1000 cycles/frame"},
 		},
-		ROMs: roms,
+		ROMs:      roms,
+		Palettes:  palettes,
+		SaveSlots: []int{1, 2, 3, 4},
 	}
 
 	var buf bytes.Buffer
@@ -258,11 +342,62 @@ func (ui *UI) handleSpeedChange(this js.Value, args []js.Value) interface{} {
 		log.Print("Error setting speed, defaulting to 20")
 	}
 
-	ui.emulator.SetIPF(speed)
+	// Zero selects the VIP timing model instead of a fixed speed.
+	if speed == 0 {
+		ui.emulator.SetTiming(chip8.TimingVIP)
+	} else {
+		ui.emulator.SetTiming(chip8.TimingFixed)
+		ui.emulator.SetIPF(speed)
+	}
+	ui.focusScreen()
+	return nil
+}
+
+func (ui *UI) handleDeflickerChange(this js.Value, args []js.Value) interface{} {
+	val := args[0].Get("target").Get("value").String()
+	if deflicker, ok := chip8.ParseDeflicker(val); ok {
+		ui.emulator.SetDeflicker(deflicker)
+	}
+	ui.focusScreen()
+	return nil
+}
+
+func (ui *UI) handlePaletteChange(this js.Value, args []js.Value) interface{} {
+	val := args[0].Get("target").Get("value").String()
+	if palette, ok := chip8.GetPalettePreset(val); ok {
+		ui.emulator.SetPalette(palette)
+	}
+	ui.focusScreen()
+	return nil
+}
+
+// handleAttachPalette keeps the selected palette for the running ROM
+func (ui *UI) handleAttachPalette(this js.Value, args []js.Value) interface{} {
+	val := ui.elements["paletteDropdown"].Get("value").String()
+	if palette, ok := chip8.GetPalettePreset(val); ok {
+		ui.emulator.AttachPalette(palette)
+	}
+	ui.focusScreen()
+	return nil
+}
+
+func (ui *UI) handleEffectsChange(this js.Value, args []js.Value) interface{} {
+	val := args[0].Get("target").Get("value").String()
+	if err := ui.emulator.SetEffects(val); err != nil {
+		log.Printf("Error setting effects: %v", err)
+	}
 	ui.focusScreen()
 	return nil
 }
 
+// ShowPalette selects p in the palette dropdown, or Custom if it isn't a
+// preset
+func (ui *UI) ShowPalette(p chip8.Palette) {
+	if dropdown := ui.elements["paletteDropdown"]; !dropdown.IsUndefined() {
+		dropdown.Set("value", p.Name)
+	}
+}
+
 func (ui *UI) handleRomLoad(this js.Value, args []js.Value) interface{} {
 	event := args[0]
 	target := event.Get("target")
@@ -280,6 +415,103 @@ func (ui *UI) handleRomLoad(this js.Value, args []js.Value) interface{} {
 	return nil
 }
 
+// slotKey returns the localStorage key of the selected save slot
+func (ui *UI) slotKey() string {
+	slot := ui.elements["slotSelector"].Get("value").String()
+	return fmt.Sprintf("chipstation-state-%s", slot)
+}
+
+func (ui *UI) handleSaveState(this js.Value, args []js.Value) interface{} {
+	state, err := ui.emulator.SaveState()
+	if err != nil {
+		log.Printf("Error saving state: %v", err)
+		return nil
+	}
+	storage := js.Global().Get("localStorage")
+	storage.Call("setItem", ui.slotKey(), base64.StdEncoding.EncodeToString(state))
+	ui.focusScreen()
+	return nil
+}
+
+func (ui *UI) handleLoadState(this js.Value, args []js.Value) interface{} {
+	storage := js.Global().Get("localStorage")
+	item := storage.Call("getItem", ui.slotKey())
+	if item.IsNull() {
+		log.Printf("Save slot is empty")
+		return nil
+	}
+	state, err := base64.StdEncoding.DecodeString(item.String())
+	if err != nil {
+		log.Printf("Error reading save slot: %v", err)
+		return nil
+	}
+	if err := ui.emulator.LoadState(state); err != nil {
+		log.Printf("Error loading state: %v", err)
+	}
+	ui.focusScreen()
+	return nil
+}
+
+// handleRecord restarts the ROM and records input, or stops the recording
+// and downloads it as a movie file
+func (ui *UI) handleRecord(this js.Value, args []js.Value) interface{} {
+	button := ui.elements["recordBtn"]
+	if !ui.recording {
+		ui.recording = true
+		ui.emulator.StartRecording()
+		button.Set("textContent", "Stop Rec")
+		ui.focusScreen()
+		return nil
+	}
+
+	ui.recording = false
+	button.Set("textContent", "Record")
+	if movie := ui.emulator.StopRecording(); movie != nil {
+		data := movie.Marshal()
+		movieBytes := js.Global().Get("Uint8Array").New(len(data))
+		js.CopyBytesToJS(movieBytes, data)
+		js.Global().Call("downloadMovie", movieBytes)
+	}
+	ui.focusScreen()
+	return nil
+}
+
+// handleScreenshot downloads the display as a PNG
+func (ui *UI) handleScreenshot(this js.Value, args []js.Value) interface{} {
+	if data := ui.emulator.Screenshot(); data != nil {
+		pngBytes := js.Global().Get("Uint8Array").New(len(data))
+		js.CopyBytesToJS(pngBytes, data)
+		js.Global().Call("downloadScreenshot", pngBytes)
+	}
+	ui.focusScreen()
+	return nil
+}
+
+// handleVideo records the display, or stops the recording and downloads it
+// as an animated GIF or PNG
+func (ui *UI) handleVideo(this js.Value, args []js.Value) interface{} {
+	button := ui.elements["videoBtn"]
+	if !ui.emulator.IsRecordingVideo() {
+		ui.emulator.StartVideo()
+		button.Set("textContent", "Stop Video")
+		ui.focusScreen()
+		return nil
+	}
+
+	button.Set("textContent", "Video")
+	format, ext := render.FormatGIF, "gif"
+	if ui.elements["videoFormat"].Get("value").String() == "apng" {
+		format, ext = render.FormatAPNG, "png"
+	}
+	if data := ui.emulator.StopVideo(format); data != nil {
+		videoBytes := js.Global().Get("Uint8Array").New(len(data))
+		js.CopyBytesToJS(videoBytes, data)
+		js.Global().Call("downloadVideo", videoBytes, ext)
+	}
+	ui.focusScreen()
+	return nil
+}
+
 // Cleanup releases all event handlers
 func (ui *UI) Cleanup() {
 	for _, handler := range ui.handlers {